@@ -0,0 +1,261 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Applyがノードを訪れるたびに呼ぶ関数
+// preがfalseを返すとそのノードの子とpostを飛ばし、postがfalseを返すとApply全体を打ち切る
+type ApplyFunc func(*Cursor) bool
+
+// 構文木をたどりながらノードを置き換え・削除・挿入する(golang.org/x/tools/go/ast/astutilのApplyと同じ)
+// ノードごとに行きがけにpre、帰りがけにpostを呼ぶ。どちらもnilでよい
+// 子はWalkと同じ順に訪れる。preで置き換えた場合、たどるのは元のノードの子
+// 戻り値はrootを置き換えたノード
+func Apply(root Node, pre, post ApplyFunc) (result Node) {
+	parent := &struct{ Node }{root}
+	defer func() {
+		if r := recover(); r != nil && r != abort {
+			panic(r)
+		}
+		result = parent.Node
+	}()
+
+	a := &application{pre: pre, post: post}
+	a.apply(parent, "Node", nil, root)
+	return
+}
+
+var abort = new(int) // postがfalseを返したときのpanicの値
+
+// Applyで訪れているノードと、それが親のどのフィールドに入っているか
+type Cursor struct {
+	parent Node
+	name   string
+	iter   *iterator // スライスの要素でなければnil
+	node   Node
+}
+
+type iterator struct {
+	index int
+	step  int
+}
+
+// 今のノード
+func (c *Cursor) Node() Node { return c.node }
+
+// 今のノードを持っている親のノード。rootのときはrootを包んだ仮のノード
+func (c *Cursor) Parent() Node { return c.parent }
+
+// 親のフィールド名("Statements"や"Left"など)
+func (c *Cursor) Name() string { return c.name }
+
+// 今のノードがスライスの要素ならその添字、そうでなければ-1
+func (c *Cursor) Index() int {
+	if c.iter != nil {
+		return c.iter.index
+	}
+	return -1
+}
+
+func (c *Cursor) field() reflect.Value {
+	return reflect.Indirect(reflect.ValueOf(c.parent)).FieldByName(c.name)
+}
+
+// 今のノードをnに置き換える。nはたどらない
+// フィールドに入らない型なら panic する
+func (c *Cursor) Replace(n Node) {
+	v := c.field()
+	if i := c.Index(); i >= 0 {
+		v = v.Index(i)
+	}
+	v.Set(nodeValue(n, v.Type()))
+	c.node = n
+}
+
+// 今のノードをスライスから取り除く。スライスの要素でなければ panic する
+func (c *Cursor) Delete() {
+	i := c.Index()
+	if i < 0 {
+		panic("ast: Delete node not contained in slice")
+	}
+
+	v := c.field()
+	l := v.Len()
+	reflect.Copy(v.Slice(i, l), v.Slice(i+1, l))
+	v.Index(l - 1).Set(reflect.Zero(v.Type().Elem()))
+	v.SetLen(l - 1)
+	c.iter.step--
+}
+
+// 今のノードの後ろにnを挿入する。nはたどらない
+func (c *Cursor) InsertAfter(n Node) {
+	i := c.Index()
+	if i < 0 {
+		panic("ast: InsertAfter node not contained in slice")
+	}
+
+	v := c.field()
+	v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+	l := v.Len()
+	reflect.Copy(v.Slice(i+2, l), v.Slice(i+1, l))
+	v.Index(i + 1).Set(nodeValue(n, v.Type().Elem()))
+	c.iter.step++
+}
+
+// 今のノードの前にnを挿入する。nはたどらない
+func (c *Cursor) InsertBefore(n Node) {
+	i := c.Index()
+	if i < 0 {
+		panic("ast: InsertBefore node not contained in slice")
+	}
+
+	v := c.field()
+	v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+	l := v.Len()
+	reflect.Copy(v.Slice(i+1, l), v.Slice(i, l))
+	v.Index(i).Set(nodeValue(n, v.Type().Elem()))
+	c.iter.index++
+}
+
+func nodeValue(n Node, typ reflect.Type) reflect.Value {
+	if n == nil {
+		return reflect.Zero(typ)
+	}
+
+	v := reflect.ValueOf(n)
+	if !v.Type().AssignableTo(typ) {
+		panic(fmt.Sprintf("ast: cannot use %T as %s", n, typ))
+	}
+	return v
+}
+
+type application struct {
+	pre, post ApplyFunc
+}
+
+func (a *application) apply(parent Node, name string, iter *iterator, n Node) {
+	// 子がないフィールド(elseのないifなど)は訪れない
+	if n == nil || reflect.ValueOf(n).IsNil() {
+		return
+	}
+
+	c := &Cursor{parent: parent, name: name, iter: iter, node: n}
+	if a.pre != nil && !a.pre(c) {
+		return
+	}
+
+	switch n := n.(type) {
+	case *Program:
+		a.applyList(n, "Statements")
+
+	case *LetStatement:
+		a.apply(n, "Name", nil, n.Name)
+		a.apply(n, "Value", nil, n.Value)
+
+	case *ReturnStatement:
+		a.apply(n, "ReturnValue", nil, n.ReturnValue)
+
+	case *ThrowStatement:
+		a.apply(n, "Value", nil, n.Value)
+
+	case *ExpressionStatement:
+		a.apply(n, "Expression", nil, n.Expression)
+
+	case *ImportStatement:
+		a.apply(n, "Path", nil, n.Path)
+		a.apply(n, "Name", nil, n.Name)
+
+	case *ExportStatement:
+		a.apply(n, "Statement", nil, n.Statement)
+
+	case *BlockStatement:
+		a.applyList(n, "Statements")
+
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean:
+		// 子はない
+
+	case *ArrayLiteral:
+		a.applyList(n, "Elements")
+
+	case *HashLiteral:
+		a.applyList(n, "Pairs")
+
+	case *HashPair:
+		a.apply(n, "Key", nil, n.Key)
+		a.apply(n, "Value", nil, n.Value)
+
+	case *PrefixExpression:
+		a.apply(n, "Right", nil, n.Right)
+
+	case *InfixExpression:
+		a.apply(n, "Left", nil, n.Left)
+		a.apply(n, "Right", nil, n.Right)
+
+	case *IfExpression:
+		a.apply(n, "Condition", nil, n.Condition)
+		a.apply(n, "Consequence", nil, n.Consequence)
+		a.apply(n, "Alternative", nil, n.Alternative)
+
+	case *TryExpression:
+		a.apply(n, "Block", nil, n.Block)
+		a.apply(n, "CatchParam", nil, n.CatchParam)
+		a.apply(n, "Catch", nil, n.Catch)
+		a.apply(n, "Finally", nil, n.Finally)
+
+	case *SpawnExpression:
+		a.apply(n, "Call", nil, n.Call)
+
+	case *SelectExpression:
+		a.applyList(n, "Cases")
+		a.apply(n, "Default", nil, n.Default)
+
+	case *SelectCase:
+		a.apply(n, "Name", nil, n.Name)
+		a.apply(n, "Operation", nil, n.Operation)
+		a.apply(n, "Body", nil, n.Body)
+
+	case *FunctionLiteral:
+		a.applyList(n, "Parameters")
+		a.apply(n, "Body", nil, n.Body)
+
+	case *CallExpression:
+		a.apply(n, "Function", nil, n.Function)
+		a.applyList(n, "Arguments")
+
+	case *IndexExpression:
+		a.apply(n, "Left", nil, n.Left)
+		a.apply(n, "Index", nil, n.Index)
+
+	case *MemberExpression:
+		a.apply(n, "Object", nil, n.Object)
+		a.apply(n, "Member", nil, n.Member)
+
+	default:
+		panic(fmt.Sprintf("ast.Apply: unexpected node type %T", n))
+	}
+
+	if a.post != nil && !a.post(c) {
+		panic(abort)
+	}
+}
+
+// スライスの要素を順に訪れる。DeleteやInsertでスライスが変わるので毎回フィールドを読み直す
+func (a *application) applyList(parent Node, name string) {
+	iter := &iterator{}
+	for {
+		v := reflect.Indirect(reflect.ValueOf(parent)).FieldByName(name)
+		if iter.index >= v.Len() {
+			break
+		}
+
+		var x Node
+		if e := v.Index(iter.index); e.IsValid() && !e.IsNil() {
+			x = e.Interface().(Node)
+		}
+		iter.step = 1
+		a.apply(parent, name, iter, x)
+		iter.index += iter.step
+	}
+}
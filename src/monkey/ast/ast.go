@@ -28,6 +28,7 @@ type Expression interface {
 // Statementのインターフェイスを満たすことでProgram.Statementsに追加できるようになる
 type Program struct {
 	Statements []Statement
+	Comments   []token.Token // ソース中のコメント。出てきた順に並ぶ
 }
 
 func (p *Program) TokenLiteral() string {
@@ -136,6 +137,15 @@ func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
 type PrefixExpression struct {
 	Token    token.Token // 前置トークン、token.goから取ってくる。例えば「！」
 	Operator string      // "-"か"!" 文字列
@@ -216,8 +226,9 @@ func (ie *IfExpression) String() string {
 }
 
 type BlockStatement struct {
-	Token      token.Token
+	Token      token.Token // '{'トークン
 	Statements []Statement
+	Rbrace     token.Token // '}'トークン
 }
 
 func (bs *BlockStatement) statementNode() {}
@@ -237,6 +248,7 @@ type FunctionLiteral struct {
 	Token      token.Token // 'fn'トークン
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Name       string // let文で束縛された場合の名前。無名関数なら空
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -283,3 +295,257 @@ func (ce *CallExpression) String() string {
 
 	return out.String()
 }
+
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) String() string       { return sl.Token.Literal }
+
+type IndexExpression struct {
+	Token token.Token // '['トークン
+	Left  Expression  // 添字をつけられる側の式
+	Index Expression
+}
+
+func (ie *IndexExpression) expressionNode()      {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+
+	return out.String()
+}
+
+// throw文 throw "message"; みたいなやつ
+type ThrowStatement struct {
+	Token token.Token // 'throw'トークン
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ts.TokenLiteral() + " ")
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// try { } catch (e) { } finally { }
+// CatchとFinallyはどちらか片方を省略できる
+type TryExpression struct {
+	Token      token.Token // 'try'トークン
+	Block      *BlockStatement
+	CatchParam *Identifier // catch (e) のe。catchがなければnil
+	Catch      *BlockStatement
+	Finally    *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+
+	if te.Catch != nil {
+		out.WriteString(" catch(")
+		out.WriteString(te.CatchParam.String())
+		out.WriteString(") ")
+		out.WriteString(te.Catch.String())
+	}
+
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+
+	return out.String()
+}
+
+// spawn f(x) のように、関数呼び出しを新しいタスクで実行する
+type SpawnExpression struct {
+	Token token.Token // 'spawn'トークン
+	Call  Expression  // 構文解析ではCallExpressionだけが入る
+}
+
+func (se *SpawnExpression) expressionNode()      {}
+func (se *SpawnExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpawnExpression) String() string       { return "spawn " + se.Call.String() }
+
+// select { case let v = recv(ch) { } case send(ch, x) { } default { } }
+// 送受信できるケースを1つ選んで実行する。Defaultはなければnil
+type SelectExpression struct {
+	Token   token.Token // 'select'トークン
+	Cases   []*SelectCase
+	Default *BlockStatement
+	Rbrace  token.Token // 閉じる'}'トークン
+}
+
+func (se *SelectExpression) expressionNode()      {}
+func (se *SelectExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SelectExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("select {")
+	for _, c := range se.Cases {
+		out.WriteString(" " + c.String())
+	}
+	if se.Default != nil {
+		out.WriteString(" default ")
+		out.WriteString(se.Default.String())
+	}
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// selectの1つのケース
+type SelectCase struct {
+	Token     token.Token // 'case'トークン
+	Name      *Identifier // case let v = recv(ch) のv。なければnil
+	Operation Expression  // 構文解析ではrecv(ch)かsend(ch, v)のCallExpressionだけが入る
+	Body      *BlockStatement
+}
+
+func (sc *SelectCase) expressionNode()      {}
+func (sc *SelectCase) TokenLiteral() string { return sc.Token.Literal }
+func (sc *SelectCase) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("case ")
+	if sc.Name != nil {
+		out.WriteString("let " + sc.Name.String() + " = ")
+	}
+	out.WriteString(sc.Operation.String())
+	out.WriteString(" ")
+	out.WriteString(sc.Body.String())
+
+	return out.String()
+}
+
+type ArrayLiteral struct {
+	Token    token.Token // '['トークン
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// {"name": "monkey", 1: true} のようなハッシュ
+// Pairsはソースに書かれた順に並ぶ
+type HashLiteral struct {
+	Token token.Token // '{'トークン
+	Pairs []*HashPair
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// ハッシュリテラルの中のキーと値の組。HashLiteralの中にだけ現れる
+type HashPair struct {
+	Token token.Token // ':'トークン
+	Key   Expression
+	Value Expression
+}
+
+func (hp *HashPair) expressionNode()      {}
+func (hp *HashPair) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPair) String() string       { return hp.Key.String() + ":" + hp.Value.String() }
+
+// import "path/to/util" as u;
+type ImportStatement struct {
+	Token token.Token // 'import'トークン
+	Path  *StringLiteral
+	Name  *Identifier // モジュールを束縛する名前
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(is.TokenLiteral() + " ")
+	out.WriteString(`"` + is.Path.Value + `"`)
+	out.WriteString(" as ")
+	out.WriteString(is.Name.String())
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// export let x = 5; モジュールのトップレベルにだけ書ける
+type ExportStatement struct {
+	Token     token.Token // 'export'トークン
+	Statement *LetStatement
+}
+
+func (es *ExportStatement) statementNode()       {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExportStatement) String() string {
+	return es.TokenLiteral() + " " + es.Statement.String()
+}
+
+// u.helper のようなメンバーの参照
+type MemberExpression struct {
+	Token  token.Token // '.'トークン
+	Object Expression
+	Member *Identifier
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(me.Object.String())
+	out.WriteString(".")
+	out.WriteString(me.Member.String())
+	out.WriteString(")")
+
+	return out.String()
+}
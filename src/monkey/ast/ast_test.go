@@ -1,7 +1,12 @@
 package ast
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"monkey/token"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -26,3 +31,666 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+// テスト用に各種類のノードを1つ以上含むプログラムを組み立てる
+func ident(name string) *Identifier {
+	return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+}
+
+func integer(value int64) *IntegerLiteral {
+	return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: fmt.Sprint(value)}, Value: value}
+}
+
+func block(stmts ...Statement) *BlockStatement {
+	return &BlockStatement{Statements: stmts}
+}
+
+func expr(e Expression) *ExpressionStatement {
+	return &ExpressionStatement{Expression: e}
+}
+
+func TestInspect(t *testing.T) {
+	// let f = fn(a, b) { if (!a) { return b; } else { throw "x"; } };
+	// try { f(1, [2])[0] } catch (e) { -e + true } finally { f }
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Name: ident("f"),
+				Value: &FunctionLiteral{
+					Parameters: []*Identifier{ident("a"), ident("b")},
+					Body: block(expr(&IfExpression{
+						Condition:   &PrefixExpression{Operator: "!", Right: ident("a")},
+						Consequence: block(&ReturnStatement{ReturnValue: ident("b")}),
+						Alternative: block(&ThrowStatement{Value: &StringLiteral{Value: "x"}}),
+					})),
+				},
+			},
+			expr(&TryExpression{
+				Block: block(expr(&IndexExpression{
+					Left: &CallExpression{
+						Function:  ident("f"),
+						Arguments: []Expression{integer(1), &ArrayLiteral{Elements: []Expression{integer(2)}}},
+					},
+					Index: integer(0),
+				})),
+				CatchParam: ident("e"),
+				Catch: block(expr(&InfixExpression{
+					Left:     &PrefixExpression{Operator: "-", Right: ident("e")},
+					Operator: "+",
+					Right:    &Boolean{Value: true},
+				})),
+				Finally: block(expr(ident("f"))),
+			}),
+		},
+	}
+
+	expected := []string{
+		"*ast.Program",
+		"*ast.LetStatement",
+		"f",
+		"*ast.FunctionLiteral",
+		"a", "b",
+		"*ast.BlockStatement",
+		"*ast.ExpressionStatement",
+		"*ast.IfExpression",
+		"*ast.PrefixExpression", "a",
+		"*ast.BlockStatement", "*ast.ReturnStatement", "b",
+		"*ast.BlockStatement", "*ast.ThrowStatement", "*ast.StringLiteral",
+		"*ast.ExpressionStatement",
+		"*ast.TryExpression",
+		"*ast.BlockStatement",
+		"*ast.ExpressionStatement",
+		"*ast.IndexExpression",
+		"*ast.CallExpression", "f", "*ast.IntegerLiteral", "*ast.ArrayLiteral", "*ast.IntegerLiteral",
+		"*ast.IntegerLiteral",
+		"e",
+		"*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.InfixExpression",
+		"*ast.PrefixExpression", "e", "*ast.Boolean",
+		"*ast.BlockStatement", "*ast.ExpressionStatement", "f",
+	}
+
+	visited := []string{}
+	depth, maxDepth := 0, 0
+	Inspect(program, func(n Node) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+		depth++
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+
+		if id, ok := n.(*Identifier); ok {
+			visited = append(visited, id.Value)
+		} else {
+			visited = append(visited, fmt.Sprintf("%T", n))
+		}
+		return true
+	})
+
+	if len(visited) != len(expected) {
+		t.Fatalf("wrong number of nodes visited. want=%d, got=%d\n%v", len(expected), len(visited), visited)
+	}
+	for i, want := range expected {
+		if visited[i] != want {
+			t.Errorf("visited[%d] wrong. want=%s, got=%s", i, want, visited[i])
+		}
+	}
+
+	// 子を訪れ終わるたびにnilが渡されるので深さが元に戻る
+	if depth != 0 {
+		t.Errorf("Visit(nil) was not called for every node. depth=%d", depth)
+	}
+	if maxDepth != 9 {
+		t.Errorf("wrong max depth. want=9, got=%d", maxDepth)
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{Name: ident("f"), Value: &FunctionLiteral{
+				Parameters: []*Identifier{ident("x")},
+				Body:       block(expr(ident("x"))),
+			}},
+			expr(&CallExpression{Function: ident("f"), Arguments: []Expression{ident("y")}}),
+		},
+	}
+
+	names := []string{}
+	Inspect(program, func(n Node) bool {
+		if _, ok := n.(*FunctionLiteral); ok {
+			return false
+		}
+		if id, ok := n.(*Identifier); ok {
+			names = append(names, id.Value)
+		}
+		return true
+	})
+
+	if strings.Join(names, ",") != "f,f,y" {
+		t.Errorf("wrong identifiers. want=f,f,y, got=%s", strings.Join(names, ","))
+	}
+}
+
+type countVisitor map[string]int
+
+func (c countVisitor) Visit(node Node) Visitor {
+	if node != nil {
+		c[fmt.Sprintf("%T", node)]++
+	}
+	return c
+}
+
+func TestWalkAndChildren(t *testing.T) {
+	call := &CallExpression{
+		Function:  ident("add"),
+		Arguments: []Expression{integer(1), &InfixExpression{Left: integer(2), Operator: "*", Right: integer(3)}},
+	}
+
+	counts := countVisitor{}
+	Walk(counts, call)
+	if counts["*ast.IntegerLiteral"] != 3 || counts["*ast.Identifier"] != 1 || counts["*ast.InfixExpression"] != 1 {
+		t.Errorf("wrong counts. got=%v", counts)
+	}
+
+	children := Children(call)
+	if len(children) != 3 {
+		t.Fatalf("wrong number of children. want=3, got=%d", len(children))
+	}
+	if children[0] != call.Function || children[1] != call.Arguments[0] || children[2] != call.Arguments[1] {
+		t.Errorf("wrong children. got=%v", children)
+	}
+
+	// elseのないifは子が2つ
+	ifExp := &IfExpression{Condition: ident("x"), Consequence: block()}
+	if len(Children(ifExp)) != 2 {
+		t.Errorf("wrong number of children for if without else. got=%d", len(Children(ifExp)))
+	}
+
+	member := &MemberExpression{Object: ident("u"), Member: ident("helper")}
+	children = Children(member)
+	if len(children) != 2 || children[0] != member.Object || children[1] != member.Member {
+		t.Errorf("wrong children for member expression. got=%v", children)
+	}
+}
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok {
+			return node
+		}
+		if integer.Value != 1 {
+			return integer
+		}
+		integer.Value = 2
+		return integer
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{expr(one())}},
+			&Program{Statements: []Statement{expr(two())}},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&InfixExpression{Left: two(), Operator: "+", Right: one()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IndexExpression{Left: one(), Index: one()},
+			&IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&IfExpression{
+				Condition:   one(),
+				Consequence: block(expr(one())),
+				Alternative: block(expr(one())),
+			},
+			&IfExpression{
+				Condition:   two(),
+				Consequence: block(expr(two())),
+				Alternative: block(expr(two())),
+			},
+		},
+		{
+			&TryExpression{Block: block(expr(one())), CatchParam: ident("e"), Catch: block(expr(one())), Finally: block(expr(one()))},
+			&TryExpression{Block: block(expr(two())), CatchParam: ident("e"), Catch: block(expr(two())), Finally: block(expr(two()))},
+		},
+		{
+			&ReturnStatement{ReturnValue: one()},
+			&ReturnStatement{ReturnValue: two()},
+		},
+		{
+			&ThrowStatement{Value: one()},
+			&ThrowStatement{Value: two()},
+		},
+		{
+			&LetStatement{Name: ident("x"), Value: one()},
+			&LetStatement{Name: ident("x"), Value: two()},
+		},
+		{
+			&FunctionLiteral{Parameters: []*Identifier{}, Body: block(expr(one()))},
+			&FunctionLiteral{Parameters: []*Identifier{}, Body: block(expr(two()))},
+		},
+		{
+			&CallExpression{Function: ident("f"), Arguments: []Expression{one(), two()}},
+			&CallExpression{Function: ident("f"), Arguments: []Expression{two(), two()}},
+		},
+		{
+			&ArrayLiteral{Elements: []Expression{one(), one()}},
+			&ArrayLiteral{Elements: []Expression{two(), two()}},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+
+		if !reflect.DeepEqual(modified, tt.expected) {
+			t.Errorf("not equal. got=%#v, want=%#v", modified, tt.expected)
+		}
+	}
+}
+
+func TestModifyFoldAndRename(t *testing.T) {
+	// let x = fn(x) { x + 2 * 3 }
+	program := &Program{Statements: []Statement{
+		&LetStatement{Token: token.Token{Type: token.LET, Literal: "let"}, Name: ident("x"), Value: &FunctionLiteral{
+			Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+			Parameters: []*Identifier{ident("x")},
+			Body: block(expr(&InfixExpression{
+				Left:     ident("x"),
+				Operator: "+",
+				Right:    &InfixExpression{Left: integer(2), Operator: "*", Right: integer(3)},
+			})),
+		}},
+	}}
+
+	Modify(program, func(node Node) Node {
+		switch node := node.(type) {
+		case *Identifier:
+			return ident("renamed_" + node.Value)
+		case *InfixExpression:
+			left, lok := node.Left.(*IntegerLiteral)
+			right, rok := node.Right.(*IntegerLiteral)
+			if lok && rok && node.Operator == "*" {
+				return integer(left.Value * right.Value)
+			}
+		case *ExpressionStatement:
+			// 文の位置に式は入らないので無視される
+			return node.Expression
+		}
+		return node
+	})
+
+	expected := "let renamed_x = fn(renamed_x)(renamed_x + 6);"
+	if program.String() != expected {
+		t.Errorf("wrong program. want=%q, got=%q", expected, program.String())
+	}
+
+	folded := program.Statements[0].(*LetStatement).Value.(*FunctionLiteral).Body.Statements[0].(*ExpressionStatement).Expression.(*InfixExpression).Right
+	if lit, ok := folded.(*IntegerLiteral); !ok || lit.Value != 6 {
+		t.Errorf("2 * 3 was not folded. got=%#v", folded)
+	}
+}
+
+func TestApply(t *testing.T) {
+	// f(1); g(2); h(3);
+	call := func(name string, arg int64) *ExpressionStatement {
+		return expr(&CallExpression{Function: ident(name), Arguments: []Expression{integer(arg)}})
+	}
+	program := &Program{Statements: []Statement{call("f", 1), call("g", 2), call("h", 3)}}
+
+	type visit struct {
+		node   string
+		parent string
+		name   string
+		index  int
+	}
+	visits := []visit{}
+
+	Apply(program, func(c *Cursor) bool {
+		if id, ok := c.Node().(*Identifier); ok {
+			visits = append(visits, visit{id.Value, fmt.Sprintf("%T", c.Parent()), c.Name(), c.Index()})
+		}
+		if lit, ok := c.Node().(*IntegerLiteral); ok {
+			visits = append(visits, visit{fmt.Sprint(lit.Value), fmt.Sprintf("%T", c.Parent()), c.Name(), c.Index()})
+		}
+
+		stmt, ok := c.Node().(*ExpressionStatement)
+		if !ok {
+			return true
+		}
+		name := stmt.Expression.(*CallExpression).Function.(*Identifier).Value
+		switch name {
+		case "f":
+			// 挿入したノードはたどらない
+			c.InsertBefore(call("before", 0))
+			c.InsertAfter(call("after", 0))
+		case "g":
+			c.Delete()
+			return false
+		case "h":
+			c.Replace(call("replaced", 4))
+		}
+		return true
+	}, nil)
+
+	expected := "before(0)f(1)after(0)replaced(4)"
+	if program.String() != expected {
+		t.Errorf("wrong program. want=%q, got=%q", expected, program.String())
+	}
+
+	expectedVisits := []visit{
+		{"f", "*ast.CallExpression", "Function", -1},
+		{"1", "*ast.CallExpression", "Arguments", 0},
+		// preで置き換えても、たどるのは元のノードの子
+		{"h", "*ast.CallExpression", "Function", -1},
+		{"3", "*ast.CallExpression", "Arguments", 0},
+	}
+	if !reflect.DeepEqual(visits, expectedVisits) {
+		t.Errorf("wrong visits.\nwant=%v\ngot=%v", expectedVisits, visits)
+	}
+
+	replaced := program.Statements[3]
+	if replaced.String() != "replaced(4)" {
+		t.Errorf("statement was not replaced. got=%q", replaced.String())
+	}
+}
+
+func TestApplyReplaceRootAndAbort(t *testing.T) {
+	root := &InfixExpression{Left: integer(1), Operator: "+", Right: integer(2)}
+
+	result := Apply(root, nil, func(c *Cursor) bool {
+		if infix, ok := c.Node().(*InfixExpression); ok {
+			left := infix.Left.(*IntegerLiteral)
+			right := infix.Right.(*IntegerLiteral)
+			c.Replace(integer(left.Value + right.Value))
+		}
+		return true
+	})
+	if lit, ok := result.(*IntegerLiteral); !ok || lit.Value != 3 {
+		t.Errorf("root was not replaced. got=%#v", result)
+	}
+
+	// postがfalseを返すと以降のノードは訪れない
+	visited := 0
+	Apply(&ArrayLiteral{Elements: []Expression{integer(1), integer(2), integer(3)}}, nil, func(c *Cursor) bool {
+		visited++
+		return visited < 2
+	})
+	if visited != 2 {
+		t.Errorf("Apply was not aborted. visited=%d", visited)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("replacing a block with an identifier should panic")
+		}
+	}()
+	Apply(&IfExpression{Condition: ident("x"), Consequence: block()}, func(c *Cursor) bool {
+		if c.Name() == "Consequence" {
+			c.Replace(ident("y"))
+		}
+		return true
+	}, nil)
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let", Line: 1, Column: 1},
+				Name:  ident("f"),
+				Value: &FunctionLiteral{
+					Token:      token.Token{Type: token.FUNCTION, Literal: "fn", Line: 1, Column: 9},
+					Name:       "f",
+					Parameters: []*Identifier{ident("a")},
+					Body: &BlockStatement{
+						Token:  token.Token{Type: token.LBRACE, Literal: "{", Line: 1, Column: 15},
+						Rbrace: token.Token{Type: token.RBRACE, Literal: "}", Line: 3, Column: 1},
+						Statements: []Statement{expr(&IfExpression{
+							Condition:   &PrefixExpression{Operator: "!", Right: &Boolean{Value: true}},
+							Consequence: block(&ThrowStatement{Value: &StringLiteral{Value: "x"}}),
+						})},
+					},
+				},
+			},
+			&ReturnStatement{ReturnValue: &ArrayLiteral{Elements: []Expression{}}},
+			expr(&TryExpression{
+				Block:      block(expr(&IndexExpression{Left: ident("a"), Index: integer(-9007199254740993)})),
+				CatchParam: ident("e"),
+				Catch:      block(),
+			}),
+			expr(&CallExpression{
+				Function:  ident("f"),
+				Arguments: []Expression{&InfixExpression{Left: integer(1), Operator: "+", Right: integer(2)}},
+			}),
+			expr(&HashLiteral{Pairs: []*HashPair{
+				{Key: &StringLiteral{Value: "k"}, Value: &FloatLiteral{Value: 1.5}},
+			}}),
+			expr(&SpawnExpression{Call: &CallExpression{Function: ident("f"), Arguments: []Expression{}}}),
+			expr(&SelectExpression{
+				Cases: []*SelectCase{
+					{
+						Name:      ident("v"),
+						Operation: &CallExpression{Function: ident("recv"), Arguments: []Expression{ident("c")}},
+						Body:      block(expr(ident("v"))),
+					},
+					{
+						Operation: &CallExpression{Function: ident("send"), Arguments: []Expression{ident("c"), integer(1)}},
+						Body:      block(),
+					},
+				},
+				Default: block(),
+			}),
+			&ImportStatement{Path: &StringLiteral{Value: "util"}, Name: ident("u")},
+			&ExportStatement{Statement: &LetStatement{
+				Name:  ident("x"),
+				Value: &MemberExpression{Object: ident("u"), Member: ident("y")},
+			}},
+		},
+		Comments: []token.Token{{Type: token.COMMENT, Literal: "// note", Line: 2, Column: 3}},
+	}
+
+	data, err := EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("EncodeJSON returned error: %s", err)
+	}
+
+	decoded, err := DecodeJSON(data)
+	if err != nil {
+		t.Fatalf("DecodeJSON returned error: %s", err)
+	}
+
+	if decoded.String() != program.String() {
+		t.Errorf("String() differs.\nwant=%q\ngot=%q", program.String(), decoded.String())
+	}
+	if !reflect.DeepEqual(decoded, program) {
+		t.Errorf("decoded program is not equal to the original.\njson=%s", data)
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	node := &InfixExpression{
+		Token:    token.Token{Type: token.PLUS, Literal: "+", Line: 1, Column: 3},
+		Left:     &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1", Line: 1, Column: 1}, Value: 1},
+		Operator: "+",
+		Right:    &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x", Line: 1, Column: 5}, Value: "x"},
+	}
+
+	data, err := EncodeJSON(node)
+	if err != nil {
+		t.Fatalf("EncodeJSON returned error: %s", err)
+	}
+
+	expected := `{"kind":"InfixExpression",` +
+		`"left":{"kind":"IntegerLiteral","token":{"type":"INT","literal":"1","line":1,"column":1},"value":1},` +
+		`"operator":"+",` +
+		`"right":{"kind":"Identifier","token":{"type":"INDENT","literal":"x","line":1,"column":5},"value":"x"},` +
+		`"token":{"type":"+","literal":"+","line":1,"column":3}}`
+	if string(data) != expected {
+		t.Errorf("wrong json.\nwant=%s\ngot=%s", expected, data)
+	}
+}
+
+func TestJSONTypedNil(t *testing.T) {
+	node := &Program{Statements: []Statement{
+		(*LetStatement)(nil),
+		&ExpressionStatement{Expression: (*IfExpression)(nil)},
+		expr(&CallExpression{Function: ident("f"), Arguments: []Expression{(*IntegerLiteral)(nil)}}),
+	}}
+
+	data, err := EncodeJSON(node)
+	if err != nil {
+		t.Fatalf("EncodeJSON returned error: %s", err)
+	}
+
+	for _, want := range []string{`"statements":[null,`, `"expression":null`, `"arguments":[null]`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("typed nil should be encoded as null. want %s in %s", want, data)
+		}
+	}
+}
+
+func TestFprintTypedNil(t *testing.T) {
+	node := &Program{Statements: []Statement{
+		expr(&InfixExpression{Left: integer(1), Operator: "+", Right: (*Identifier)(nil)}),
+		&ExpressionStatement{Expression: (*CallExpression)(nil)},
+		(*LetStatement)(nil),
+	}}
+
+	tests := []struct {
+		print    func(io.Writer, Node)
+		expected string
+	}{
+		{Fprint, "Program\n  ExpressionStatement\n    InfixExpression +\n      IntegerLiteral 1\n  ExpressionStatement\n"},
+		{FprintTree, "Program\n" +
+			"|-- ExpressionStatement\n" +
+			"|   `-- InfixExpression +\n" +
+			"|       `-- IntegerLiteral 1\n" +
+			"`-- ExpressionStatement\n"},
+	}
+
+	for i, tt := range tests {
+		var out bytes.Buffer
+		tt.print(&out, node)
+
+		if out.String() != tt.expected {
+			t.Errorf("tests[%d] wrong output.\nwant=%q\ngot=%q", i, tt.expected, out.String())
+		}
+	}
+
+	var out bytes.Buffer
+	FprintDot(&out, node)
+	if strings.Count(out.String(), "[label=") != 5 {
+		t.Errorf("typed nil children should be skipped. got=%q", out.String())
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind":"Nope"}`, `ast: unknown node kind "Nope"`},
+		{`{"kind":"ExpressionStatement","expression":{"kind":"Program"}}`, "ast: *ast.Program is not an expression"},
+		{`{"kind":"LetStatement","name":{"kind":"IntegerLiteral","value":1}}`, "ast: expected Identifier, got *ast.IntegerLiteral"},
+		{`{"kind":"IntegerLiteral","value":"one"}`, "ast: json: cannot unmarshal string into Go value of type int64"},
+		{`[`, "ast: unexpected end of JSON input"},
+	}
+
+	for _, tt := range tests {
+		_, err := DecodeJSON([]byte(tt.input))
+		if err == nil {
+			t.Errorf("expected an error for %s", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %s.\nwant=%q\ngot=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestFprint(t *testing.T) {
+	// -1 + f(2)
+	node := &Program{Statements: []Statement{expr(&InfixExpression{
+		Left:     &PrefixExpression{Operator: "-", Right: integer(1)},
+		Operator: "+",
+		Right:    &CallExpression{Function: ident("f"), Arguments: []Expression{integer(2)}},
+	})}}
+
+	tests := []struct {
+		print    func(io.Writer, Node)
+		expected string
+	}{
+		{Fprint, `Program
+  ExpressionStatement
+    InfixExpression +
+      PrefixExpression -
+        IntegerLiteral 1
+      CallExpression
+        Identifier f
+        IntegerLiteral 2
+`},
+		{FprintTree, "Program\n" +
+			"`-- ExpressionStatement\n" +
+			"    `-- InfixExpression +\n" +
+			"        |-- PrefixExpression -\n" +
+			"        |   `-- IntegerLiteral 1\n" +
+			"        `-- CallExpression\n" +
+			"            |-- Identifier f\n" +
+			"            `-- IntegerLiteral 2\n"},
+		{FprintDot, `digraph AST {
+  graph [ordering=out];
+  node [shape=box, fontname="monospace"];
+  n0 [label="Program"];
+  n1 [label="ExpressionStatement"];
+  n2 [label="InfixExpression +"];
+  n3 [label="PrefixExpression -"];
+  n4 [label="IntegerLiteral 1"];
+  n3 -> n4;
+  n2 -> n3;
+  n5 [label="CallExpression"];
+  n6 [label="Identifier f"];
+  n5 -> n6;
+  n7 [label="IntegerLiteral 2"];
+  n5 -> n7;
+  n2 -> n5;
+  n1 -> n2;
+  n0 -> n1;
+}
+`},
+	}
+
+	for i, tt := range tests {
+		var out bytes.Buffer
+		tt.print(&out, node)
+
+		if out.String() != tt.expected {
+			t.Errorf("tests[%d] wrong output.\nwant=%q\ngot=%q", i, tt.expected, out.String())
+		}
+	}
+
+	var out bytes.Buffer
+	FprintDot(&out, &StringLiteral{Value: `say "hi"`})
+	if !strings.Contains(out.String(), `n0 [label="StringLiteral \"say \\\"hi\\\"\""];`) {
+		t.Errorf("label was not escaped. got=%q", out.String())
+	}
+}
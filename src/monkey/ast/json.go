@@ -0,0 +1,537 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"monkey/token"
+	"reflect"
+)
+
+// 構文木をJSONにする。ほかの言語のツールから構文木を読めるようにするため
+//
+// ノードは {"kind": "InfixExpression", "token": {...}, "left": {...}, ...} の形のオブジェクトになる
+// フィールド名はGoの構造体のフィールド名の先頭を小文字にしたもの
+// トークンは {"type": "+", "literal": "+", "line": 1, "column": 3}
+// DecodeJSONで元と同じ構文木に戻せる
+func EncodeJSON(node Node) ([]byte, error) {
+	obj, err := encodeNode(node)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(obj)
+}
+
+// EncodeJSONで作ったJSONから構文木を組み立てる
+func DecodeJSON(data []byte) (Node, error) {
+	d := &decoder{}
+	node := d.node(json.RawMessage(data))
+	if d.err != nil {
+		return nil, d.err
+	}
+	return node, nil
+}
+
+type jsonToken struct {
+	Type    token.TokenType `json:"type"`
+	Literal string          `json:"literal"`
+	Line    int             `json:"line"`
+	Column  int             `json:"column"`
+}
+
+func encodeToken(tok token.Token) jsonToken {
+	return jsonToken{Type: tok.Type, Literal: tok.Literal, Line: tok.Line, Column: tok.Column}
+}
+
+func encodeNode(node Node) (map[string]interface{}, error) {
+	if node == nil || isNilNode(node) {
+		return nil, nil
+	}
+
+	obj := map[string]interface{}{}
+	var err error
+	set := func(name string, child Node) {
+		if err != nil {
+			return
+		}
+		obj[name], err = encodeNode(child)
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		obj["kind"] = "Program"
+		obj["statements"], err = encodeStatements(n.Statements)
+		if n.Comments != nil {
+			comments := make([]jsonToken, len(n.Comments))
+			for i, c := range n.Comments {
+				comments[i] = encodeToken(c)
+			}
+			obj["comments"] = comments
+		} else {
+			obj["comments"] = nil
+		}
+	case *LetStatement:
+		obj["kind"] = "LetStatement"
+		obj["token"] = encodeToken(n.Token)
+		set("name", n.Name)
+		set("value", n.Value)
+	case *ReturnStatement:
+		obj["kind"] = "ReturnStatement"
+		obj["token"] = encodeToken(n.Token)
+		set("returnValue", n.ReturnValue)
+	case *ThrowStatement:
+		obj["kind"] = "ThrowStatement"
+		obj["token"] = encodeToken(n.Token)
+		set("value", n.Value)
+	case *ExpressionStatement:
+		obj["kind"] = "ExpressionStatement"
+		obj["token"] = encodeToken(n.Token)
+		set("expression", n.Expression)
+	case *ImportStatement:
+		obj["kind"] = "ImportStatement"
+		obj["token"] = encodeToken(n.Token)
+		set("path", n.Path)
+		set("name", n.Name)
+	case *ExportStatement:
+		obj["kind"] = "ExportStatement"
+		obj["token"] = encodeToken(n.Token)
+		set("statement", n.Statement)
+	case *BlockStatement:
+		obj["kind"] = "BlockStatement"
+		obj["token"] = encodeToken(n.Token)
+		obj["statements"], err = encodeStatements(n.Statements)
+		obj["rbrace"] = encodeToken(n.Rbrace)
+	case *Identifier:
+		obj["kind"] = "Identifier"
+		obj["token"] = encodeToken(n.Token)
+		obj["value"] = n.Value
+	case *IntegerLiteral:
+		obj["kind"] = "IntegerLiteral"
+		obj["token"] = encodeToken(n.Token)
+		obj["value"] = n.Value
+	case *FloatLiteral:
+		obj["kind"] = "FloatLiteral"
+		obj["token"] = encodeToken(n.Token)
+		obj["value"] = n.Value
+	case *StringLiteral:
+		obj["kind"] = "StringLiteral"
+		obj["token"] = encodeToken(n.Token)
+		obj["value"] = n.Value
+	case *Boolean:
+		obj["kind"] = "Boolean"
+		obj["token"] = encodeToken(n.Token)
+		obj["value"] = n.Value
+	case *ArrayLiteral:
+		obj["kind"] = "ArrayLiteral"
+		obj["token"] = encodeToken(n.Token)
+		obj["elements"], err = encodeExpressions(n.Elements)
+	case *HashLiteral:
+		obj["kind"] = "HashLiteral"
+		obj["token"] = encodeToken(n.Token)
+		if n.Pairs != nil {
+			pairs := make([]interface{}, len(n.Pairs))
+			for i, pair := range n.Pairs {
+				if pairs[i], err = encodeNode(pair); err != nil {
+					break
+				}
+			}
+			obj["pairs"] = pairs
+		} else {
+			obj["pairs"] = nil
+		}
+	case *HashPair:
+		obj["kind"] = "HashPair"
+		obj["token"] = encodeToken(n.Token)
+		set("key", n.Key)
+		set("value", n.Value)
+	case *PrefixExpression:
+		obj["kind"] = "PrefixExpression"
+		obj["token"] = encodeToken(n.Token)
+		obj["operator"] = n.Operator
+		set("right", n.Right)
+	case *InfixExpression:
+		obj["kind"] = "InfixExpression"
+		obj["token"] = encodeToken(n.Token)
+		obj["operator"] = n.Operator
+		set("left", n.Left)
+		set("right", n.Right)
+	case *IfExpression:
+		obj["kind"] = "IfExpression"
+		obj["token"] = encodeToken(n.Token)
+		set("condition", n.Condition)
+		set("consequence", n.Consequence)
+		set("alternative", n.Alternative)
+	case *TryExpression:
+		obj["kind"] = "TryExpression"
+		obj["token"] = encodeToken(n.Token)
+		set("block", n.Block)
+		set("catchParam", n.CatchParam)
+		set("catch", n.Catch)
+		set("finally", n.Finally)
+	case *SpawnExpression:
+		obj["kind"] = "SpawnExpression"
+		obj["token"] = encodeToken(n.Token)
+		set("call", n.Call)
+	case *SelectExpression:
+		obj["kind"] = "SelectExpression"
+		obj["token"] = encodeToken(n.Token)
+		if n.Cases != nil {
+			cases := make([]interface{}, len(n.Cases))
+			for i, c := range n.Cases {
+				if cases[i], err = encodeNode(c); err != nil {
+					break
+				}
+			}
+			obj["cases"] = cases
+		} else {
+			obj["cases"] = nil
+		}
+		set("default", n.Default)
+		obj["rbrace"] = encodeToken(n.Rbrace)
+	case *SelectCase:
+		obj["kind"] = "SelectCase"
+		obj["token"] = encodeToken(n.Token)
+		set("name", n.Name)
+		set("operation", n.Operation)
+		set("body", n.Body)
+	case *FunctionLiteral:
+		obj["kind"] = "FunctionLiteral"
+		obj["token"] = encodeToken(n.Token)
+		obj["name"] = n.Name
+		if n.Parameters != nil {
+			params := make([]interface{}, len(n.Parameters))
+			for i, p := range n.Parameters {
+				if params[i], err = encodeNode(p); err != nil {
+					break
+				}
+			}
+			obj["parameters"] = params
+		} else {
+			obj["parameters"] = nil
+		}
+		set("body", n.Body)
+	case *CallExpression:
+		obj["kind"] = "CallExpression"
+		obj["token"] = encodeToken(n.Token)
+		set("function", n.Function)
+		obj["arguments"], err = encodeExpressions(n.Arguments)
+	case *IndexExpression:
+		obj["kind"] = "IndexExpression"
+		obj["token"] = encodeToken(n.Token)
+		set("left", n.Left)
+		set("index", n.Index)
+	case *MemberExpression:
+		obj["kind"] = "MemberExpression"
+		obj["token"] = encodeToken(n.Token)
+		set("object", n.Object)
+		set("member", n.Member)
+	default:
+		return nil, fmt.Errorf("ast: cannot encode node type %T", node)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// nilのスライスはnull、空のスライスは[]にする
+func encodeStatements(stmts []Statement) (interface{}, error) {
+	if stmts == nil {
+		return nil, nil
+	}
+	list := make([]interface{}, len(stmts))
+	for i, s := range stmts {
+		obj, err := encodeNode(s)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = obj
+	}
+	return list, nil
+}
+
+func encodeExpressions(exps []Expression) (interface{}, error) {
+	if exps == nil {
+		return nil, nil
+	}
+	list := make([]interface{}, len(exps))
+	for i, e := range exps {
+		obj, err := encodeNode(e)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = obj
+	}
+	return list, nil
+}
+
+// 型の付いたnil(ElseのないIfExpressionのAlternativeなど)もnullにする
+func isNilNode(node Node) bool {
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// 最初に起きたエラーをerrに残し、それ以降は何もしない
+type decoder struct {
+	err error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("ast: "+format, a...)
+	}
+}
+
+func (d *decoder) unmarshal(raw json.RawMessage, v interface{}) {
+	if d.err != nil || raw == nil {
+		return
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		d.fail("%s", err)
+	}
+}
+
+func isNull(raw json.RawMessage) bool {
+	return raw == nil || string(raw) == "null"
+}
+
+func (d *decoder) token(raw json.RawMessage) token.Token {
+	var tok jsonToken
+	d.unmarshal(raw, &tok)
+	return token.Token{Type: tok.Type, Literal: tok.Literal, Line: tok.Line, Column: tok.Column}
+}
+
+func (d *decoder) node(raw json.RawMessage) Node {
+	if d.err != nil || isNull(raw) {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	d.unmarshal(raw, &fields)
+	var kind string
+	d.unmarshal(fields["kind"], &kind)
+	if d.err != nil {
+		return nil
+	}
+
+	tok := d.token(fields["token"])
+
+	switch kind {
+	case "Program":
+		program := &Program{Statements: d.statements(fields["statements"])}
+		if !isNull(fields["comments"]) {
+			var comments []jsonToken
+			d.unmarshal(fields["comments"], &comments)
+			program.Comments = make([]token.Token, len(comments))
+			for i, c := range comments {
+				program.Comments[i] = token.Token{Type: c.Type, Literal: c.Literal, Line: c.Line, Column: c.Column}
+			}
+		}
+		return program
+	case "LetStatement":
+		return &LetStatement{Token: tok, Name: d.identifier(fields["name"]), Value: d.expression(fields["value"])}
+	case "ReturnStatement":
+		return &ReturnStatement{Token: tok, ReturnValue: d.expression(fields["returnValue"])}
+	case "ThrowStatement":
+		return &ThrowStatement{Token: tok, Value: d.expression(fields["value"])}
+	case "ExpressionStatement":
+		return &ExpressionStatement{Token: tok, Expression: d.expression(fields["expression"])}
+	case "ImportStatement":
+		n := &ImportStatement{Token: tok, Name: d.identifier(fields["name"])}
+		if path := d.node(fields["path"]); path != nil {
+			if n.Path, _ = path.(*StringLiteral); n.Path == nil {
+				d.fail("expected StringLiteral, got %T", path)
+			}
+		}
+		return n
+	case "ExportStatement":
+		n := &ExportStatement{Token: tok}
+		if stmt := d.node(fields["statement"]); stmt != nil {
+			if n.Statement, _ = stmt.(*LetStatement); n.Statement == nil {
+				d.fail("expected LetStatement, got %T", stmt)
+			}
+		}
+		return n
+	case "BlockStatement":
+		return &BlockStatement{Token: tok, Statements: d.statements(fields["statements"]), Rbrace: d.token(fields["rbrace"])}
+	case "Identifier":
+		n := &Identifier{Token: tok}
+		d.unmarshal(fields["value"], &n.Value)
+		return n
+	case "IntegerLiteral":
+		n := &IntegerLiteral{Token: tok}
+		d.unmarshal(fields["value"], &n.Value)
+		return n
+	case "FloatLiteral":
+		n := &FloatLiteral{Token: tok}
+		d.unmarshal(fields["value"], &n.Value)
+		return n
+	case "StringLiteral":
+		n := &StringLiteral{Token: tok}
+		d.unmarshal(fields["value"], &n.Value)
+		return n
+	case "Boolean":
+		n := &Boolean{Token: tok}
+		d.unmarshal(fields["value"], &n.Value)
+		return n
+	case "ArrayLiteral":
+		return &ArrayLiteral{Token: tok, Elements: d.expressions(fields["elements"])}
+	case "HashLiteral":
+		n := &HashLiteral{Token: tok}
+		if !isNull(fields["pairs"]) {
+			var list []json.RawMessage
+			d.unmarshal(fields["pairs"], &list)
+			n.Pairs = make([]*HashPair, len(list))
+			for i, raw := range list {
+				pair := d.node(raw)
+				if n.Pairs[i], _ = pair.(*HashPair); pair != nil && n.Pairs[i] == nil {
+					d.fail("expected HashPair, got %T", pair)
+				}
+			}
+		}
+		return n
+	case "HashPair":
+		return &HashPair{Token: tok, Key: d.expression(fields["key"]), Value: d.expression(fields["value"])}
+	case "PrefixExpression":
+		n := &PrefixExpression{Token: tok, Right: d.expression(fields["right"])}
+		d.unmarshal(fields["operator"], &n.Operator)
+		return n
+	case "InfixExpression":
+		n := &InfixExpression{Token: tok, Left: d.expression(fields["left"]), Right: d.expression(fields["right"])}
+		d.unmarshal(fields["operator"], &n.Operator)
+		return n
+	case "IfExpression":
+		return &IfExpression{
+			Token:       tok,
+			Condition:   d.expression(fields["condition"]),
+			Consequence: d.block(fields["consequence"]),
+			Alternative: d.block(fields["alternative"]),
+		}
+	case "TryExpression":
+		return &TryExpression{
+			Token:      tok,
+			Block:      d.block(fields["block"]),
+			CatchParam: d.identifier(fields["catchParam"]),
+			Catch:      d.block(fields["catch"]),
+			Finally:    d.block(fields["finally"]),
+		}
+	case "SpawnExpression":
+		return &SpawnExpression{Token: tok, Call: d.expression(fields["call"])}
+	case "SelectExpression":
+		n := &SelectExpression{Token: tok, Default: d.block(fields["default"]), Rbrace: d.token(fields["rbrace"])}
+		if !isNull(fields["cases"]) {
+			var list []json.RawMessage
+			d.unmarshal(fields["cases"], &list)
+			n.Cases = make([]*SelectCase, len(list))
+			for i, raw := range list {
+				c := d.node(raw)
+				if n.Cases[i], _ = c.(*SelectCase); c != nil && n.Cases[i] == nil {
+					d.fail("expected SelectCase, got %T", c)
+				}
+			}
+		}
+		return n
+	case "SelectCase":
+		return &SelectCase{
+			Token:     tok,
+			Name:      d.identifier(fields["name"]),
+			Operation: d.expression(fields["operation"]),
+			Body:      d.block(fields["body"]),
+		}
+	case "FunctionLiteral":
+		n := &FunctionLiteral{Token: tok, Body: d.block(fields["body"])}
+		d.unmarshal(fields["name"], &n.Name)
+		if !isNull(fields["parameters"]) {
+			var params []json.RawMessage
+			d.unmarshal(fields["parameters"], &params)
+			n.Parameters = make([]*Identifier, len(params))
+			for i, p := range params {
+				n.Parameters[i] = d.identifier(p)
+			}
+		}
+		return n
+	case "CallExpression":
+		return &CallExpression{Token: tok, Function: d.expression(fields["function"]), Arguments: d.expressions(fields["arguments"])}
+	case "IndexExpression":
+		return &IndexExpression{Token: tok, Left: d.expression(fields["left"]), Index: d.expression(fields["index"])}
+	case "MemberExpression":
+		return &MemberExpression{Token: tok, Object: d.expression(fields["object"]), Member: d.identifier(fields["member"])}
+	default:
+		d.fail("unknown node kind %q", kind)
+		return nil
+	}
+}
+
+func (d *decoder) statement(raw json.RawMessage) Statement {
+	node := d.node(raw)
+	if node == nil {
+		return nil
+	}
+	s, ok := node.(Statement)
+	if !ok {
+		d.fail("%T is not a statement", node)
+	}
+	return s
+}
+
+func (d *decoder) expression(raw json.RawMessage) Expression {
+	node := d.node(raw)
+	if node == nil {
+		return nil
+	}
+	e, ok := node.(Expression)
+	if !ok {
+		d.fail("%T is not an expression", node)
+	}
+	return e
+}
+
+func (d *decoder) identifier(raw json.RawMessage) *Identifier {
+	node := d.node(raw)
+	if node == nil {
+		return nil
+	}
+	ident, ok := node.(*Identifier)
+	if !ok {
+		d.fail("expected Identifier, got %T", node)
+	}
+	return ident
+}
+
+func (d *decoder) block(raw json.RawMessage) *BlockStatement {
+	node := d.node(raw)
+	if node == nil {
+		return nil
+	}
+	block, ok := node.(*BlockStatement)
+	if !ok {
+		d.fail("expected BlockStatement, got %T", node)
+	}
+	return block
+}
+
+func (d *decoder) statements(raw json.RawMessage) []Statement {
+	if isNull(raw) {
+		return nil
+	}
+	var list []json.RawMessage
+	d.unmarshal(raw, &list)
+	stmts := make([]Statement, len(list))
+	for i, s := range list {
+		stmts[i] = d.statement(s)
+	}
+	return stmts
+}
+
+func (d *decoder) expressions(raw json.RawMessage) []Expression {
+	if isNull(raw) {
+		return nil
+	}
+	var list []json.RawMessage
+	d.unmarshal(raw, &list)
+	exps := make([]Expression, len(list))
+	for i, e := range list {
+		exps[i] = d.expression(e)
+	}
+	return exps
+}
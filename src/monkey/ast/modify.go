@@ -0,0 +1,163 @@
+package ast
+
+// ノードを受け取り、置き換え後のノードを返す。置き換えないならそのまま返す
+type ModifierFunc func(Node) Node
+
+// 構文木を帰りがけ順にたどり、子を置き換えてからそのノード自身をmodifierに渡す
+// 戻り値はnodeを置き換えたノード。子のフィールドは置き換え後のノードで組み直す
+// modifierがフィールドに入らない型(文の位置に式など)やnilを返したときは元のノードを残す
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+	case *Program:
+		modifyStatements(node.Statements, modifier)
+
+	case *LetStatement:
+		node.Name = modifyIdentifier(node.Name, modifier)
+		node.Value = modifyExpression(node.Value, modifier)
+
+	case *ReturnStatement:
+		node.ReturnValue = modifyExpression(node.ReturnValue, modifier)
+
+	case *ThrowStatement:
+		node.Value = modifyExpression(node.Value, modifier)
+
+	case *ExpressionStatement:
+		node.Expression = modifyExpression(node.Expression, modifier)
+
+	case *ImportStatement:
+		if node.Path != nil {
+			if modified, ok := Modify(node.Path, modifier).(*StringLiteral); ok && modified != nil {
+				node.Path = modified
+			}
+		}
+		node.Name = modifyIdentifier(node.Name, modifier)
+
+	case *ExportStatement:
+		if node.Statement != nil {
+			if modified, ok := Modify(node.Statement, modifier).(*LetStatement); ok && modified != nil {
+				node.Statement = modified
+			}
+		}
+
+	case *BlockStatement:
+		modifyStatements(node.Statements, modifier)
+
+	case *ArrayLiteral:
+		modifyExpressions(node.Elements, modifier)
+
+	case *HashLiteral:
+		for i, pair := range node.Pairs {
+			if pair == nil {
+				continue
+			}
+			if modified, ok := Modify(pair, modifier).(*HashPair); ok && modified != nil {
+				node.Pairs[i] = modified
+			}
+		}
+
+	case *HashPair:
+		node.Key = modifyExpression(node.Key, modifier)
+		node.Value = modifyExpression(node.Value, modifier)
+
+	case *PrefixExpression:
+		node.Right = modifyExpression(node.Right, modifier)
+
+	case *InfixExpression:
+		node.Left = modifyExpression(node.Left, modifier)
+		node.Right = modifyExpression(node.Right, modifier)
+
+	case *IfExpression:
+		node.Condition = modifyExpression(node.Condition, modifier)
+		node.Consequence = modifyBlock(node.Consequence, modifier)
+		node.Alternative = modifyBlock(node.Alternative, modifier)
+
+	case *TryExpression:
+		node.Block = modifyBlock(node.Block, modifier)
+		node.CatchParam = modifyIdentifier(node.CatchParam, modifier)
+		node.Catch = modifyBlock(node.Catch, modifier)
+		node.Finally = modifyBlock(node.Finally, modifier)
+
+	case *SpawnExpression:
+		node.Call = modifyExpression(node.Call, modifier)
+
+	case *SelectExpression:
+		for i, c := range node.Cases {
+			if modified, ok := Modify(c, modifier).(*SelectCase); ok && modified != nil {
+				node.Cases[i] = modified
+			}
+		}
+		node.Default = modifyBlock(node.Default, modifier)
+
+	case *SelectCase:
+		node.Name = modifyIdentifier(node.Name, modifier)
+		node.Operation = modifyExpression(node.Operation, modifier)
+		node.Body = modifyBlock(node.Body, modifier)
+
+	case *FunctionLiteral:
+		for i, param := range node.Parameters {
+			node.Parameters[i] = modifyIdentifier(param, modifier)
+		}
+		node.Body = modifyBlock(node.Body, modifier)
+
+	case *CallExpression:
+		node.Function = modifyExpression(node.Function, modifier)
+		modifyExpressions(node.Arguments, modifier)
+
+	case *IndexExpression:
+		node.Left = modifyExpression(node.Left, modifier)
+		node.Index = modifyExpression(node.Index, modifier)
+
+	case *MemberExpression:
+		node.Object = modifyExpression(node.Object, modifier)
+		node.Member = modifyIdentifier(node.Member, modifier)
+	}
+
+	return modifier(node)
+}
+
+func modifyStatements(stmts []Statement, modifier ModifierFunc) {
+	for i, s := range stmts {
+		if s == nil {
+			continue
+		}
+		if modified, ok := Modify(s, modifier).(Statement); ok && modified != nil {
+			stmts[i] = modified
+		}
+	}
+}
+
+func modifyExpressions(exps []Expression, modifier ModifierFunc) {
+	for i, e := range exps {
+		exps[i] = modifyExpression(e, modifier)
+	}
+}
+
+func modifyExpression(e Expression, modifier ModifierFunc) Expression {
+	if e == nil {
+		return nil
+	}
+	if modified, ok := Modify(e, modifier).(Expression); ok && modified != nil {
+		return modified
+	}
+	return e
+}
+
+func modifyIdentifier(ident *Identifier, modifier ModifierFunc) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	if modified, ok := Modify(ident, modifier).(*Identifier); ok && modified != nil {
+		return modified
+	}
+	return ident
+}
+
+func modifyBlock(block *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	if modified, ok := Modify(block, modifier).(*BlockStatement); ok && modified != nil {
+		return modified
+	}
+	return block
+}
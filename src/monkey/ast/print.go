@@ -0,0 +1,204 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// 構文木をノードごとに1行、深さに応じて字下げして書き出す
+func Fprint(out io.Writer, node Node) {
+	printTree(out, node, 0)
+}
+
+func printTree(out io.Writer, node Node, depth int) {
+	if node == nil || isNilNode(node) {
+		return
+	}
+
+	label, children := describe(node)
+	fmt.Fprintf(out, "%s%s\n", strings.Repeat("  ", depth), label)
+	for _, child := range children {
+		printTree(out, child, depth+1)
+	}
+}
+
+// 構文木を罫線つきの木として書き出す
+//
+//	Program
+//	`-- ExpressionStatement
+//	    `-- InfixExpression +
+//	        |-- IntegerLiteral 1
+//	        `-- IntegerLiteral 2
+func FprintTree(out io.Writer, node Node) {
+	if node == nil || isNilNode(node) {
+		return
+	}
+
+	label, children := describe(node)
+	fmt.Fprintln(out, label)
+	printBranches(out, children, "")
+}
+
+func printBranches(out io.Writer, children []Node, prefix string) {
+	children = nonNil(children)
+	for i, child := range children {
+		branch, indent := "|-- ", "|   "
+		if i == len(children)-1 {
+			branch, indent = "`-- ", "    "
+		}
+
+		label, grandchildren := describe(child)
+		fmt.Fprintf(out, "%s%s%s\n", prefix, branch, label)
+		printBranches(out, grandchildren, prefix+indent)
+	}
+}
+
+// 構文木をGraphvizのDOT形式で書き出す。dot -Tpngなどで画像にできる
+// 子は左から順に並ぶので、演算子の左右のオペランドがそのまま見える
+func FprintDot(out io.Writer, node Node) {
+	fmt.Fprintln(out, "digraph AST {")
+	fmt.Fprintln(out, "  graph [ordering=out];")
+	fmt.Fprintln(out, "  node [shape=box, fontname=\"monospace\"];")
+
+	id := 0
+	var visit func(node Node) int
+	visit = func(node Node) int {
+		label, children := describe(node)
+		self := id
+		id++
+		fmt.Fprintf(out, "  n%d [label=%s];\n", self, strconv.Quote(label))
+		for _, child := range nonNil(children) {
+			fmt.Fprintf(out, "  n%d -> n%d;\n", self, visit(child))
+		}
+		return self
+	}
+	if node != nil && !isNilNode(node) {
+		visit(node)
+	}
+
+	fmt.Fprintln(out, "}")
+}
+
+// ノードの種類と演算子やリテラルなどを並べたラベルと、表示する子を返す
+func describe(node Node) (string, []Node) {
+	switch node := node.(type) {
+	case *Program:
+		return "Program", statements(node.Statements)
+	case *LetStatement:
+		return "LetStatement " + node.Name.Value, []Node{node.Value}
+	case *ReturnStatement:
+		return "ReturnStatement", []Node{node.ReturnValue}
+	case *ThrowStatement:
+		return "ThrowStatement", []Node{node.Value}
+	case *ExpressionStatement:
+		return "ExpressionStatement", []Node{node.Expression}
+	case *ImportStatement:
+		return fmt.Sprintf("ImportStatement %q as %s", node.Path.Value, node.Name.Value), nil
+	case *ExportStatement:
+		return "ExportStatement", []Node{node.Statement}
+	case *BlockStatement:
+		return "BlockStatement", statements(node.Statements)
+	case *Identifier:
+		return "Identifier " + node.Value, nil
+	case *IntegerLiteral:
+		return "IntegerLiteral " + node.Token.Literal, nil
+	case *FloatLiteral:
+		return "FloatLiteral " + node.Token.Literal, nil
+	case *StringLiteral:
+		return fmt.Sprintf("StringLiteral %q", node.Value), nil
+	case *Boolean:
+		return "Boolean " + node.Token.Literal, nil
+	case *ArrayLiteral:
+		return "ArrayLiteral", expressions(node.Elements)
+	case *HashLiteral:
+		children := make([]Node, 0, len(node.Pairs))
+		for _, pair := range node.Pairs {
+			children = append(children, pair)
+		}
+		return "HashLiteral", children
+	case *HashPair:
+		return "HashPair", []Node{node.Key, node.Value}
+	case *PrefixExpression:
+		return "PrefixExpression " + node.Operator, []Node{node.Right}
+	case *InfixExpression:
+		return "InfixExpression " + node.Operator, []Node{node.Left, node.Right}
+	case *IfExpression:
+		children := []Node{node.Condition, node.Consequence}
+		if node.Alternative != nil {
+			children = append(children, node.Alternative)
+		}
+		return "IfExpression", children
+	case *TryExpression:
+		children := []Node{node.Block}
+		if node.Catch != nil {
+			children = append(children, node.CatchParam, node.Catch)
+		}
+		if node.Finally != nil {
+			children = append(children, node.Finally)
+		}
+		return "TryExpression", children
+	case *SpawnExpression:
+		return "SpawnExpression", []Node{node.Call}
+	case *SelectExpression:
+		children := make([]Node, 0, len(node.Cases)+1)
+		for _, c := range node.Cases {
+			children = append(children, c)
+		}
+		if node.Default != nil {
+			children = append(children, node.Default)
+		}
+		return "SelectExpression", children
+	case *SelectCase:
+		if node.Name != nil {
+			return "SelectCase", []Node{node.Name, node.Operation, node.Body}
+		}
+		return "SelectCase", []Node{node.Operation, node.Body}
+	case *FunctionLiteral:
+		children := []Node{}
+		for _, p := range node.Parameters {
+			children = append(children, p)
+		}
+		children = append(children, node.Body)
+		if node.Name != "" {
+			return "FunctionLiteral " + node.Name, children
+		}
+		return "FunctionLiteral", children
+	case *CallExpression:
+		return "CallExpression", append([]Node{node.Function}, expressions(node.Arguments)...)
+	case *IndexExpression:
+		return "IndexExpression", []Node{node.Left, node.Index}
+	case *MemberExpression:
+		return "MemberExpression ." + node.Member.Value, []Node{node.Object}
+	default:
+		return fmt.Sprintf("%T", node), nil
+	}
+}
+
+// 型の付いたnil(Cursor.Replace(nil)のあとなど)も取り除く
+func nonNil(nodes []Node) []Node {
+	result := []Node{}
+	for _, n := range nodes {
+		if n != nil && !isNilNode(n) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+func statements(stmts []Statement) []Node {
+	nodes := make([]Node, len(stmts))
+	for i, s := range stmts {
+		nodes[i] = s
+	}
+	return nodes
+}
+
+func expressions(exps []Expression) []Node {
+	nodes := make([]Node, len(exps))
+	for i, e := range exps {
+		nodes[i] = e
+	}
+	return nodes
+}
@@ -0,0 +1,228 @@
+package ast
+
+import "fmt"
+
+// Walkでノードを訪れるたびにVisitが呼ばれる
+// 戻り値のVisitorでそのノードの子を訪れる。nilを返すと子は訪れない
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// 構文木を深さ優先でたどる(go/astのWalkと同じ)
+// まずv.Visit(node)を呼び、返ってきたwがnilでなければ子ごとにWalk(w, child)、
+// 最後にw.Visit(nil)を呼ぶ。子はソースに出てくる順に訪れる
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+
+	case *LetStatement:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+
+	case *ReturnStatement:
+		if n.ReturnValue != nil {
+			Walk(v, n.ReturnValue)
+		}
+
+	case *ThrowStatement:
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+
+	case *ExpressionStatement:
+		if n.Expression != nil {
+			Walk(v, n.Expression)
+		}
+
+	case *ImportStatement:
+		if n.Path != nil {
+			Walk(v, n.Path)
+		}
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+
+	case *ExportStatement:
+		if n.Statement != nil {
+			Walk(v, n.Statement)
+		}
+
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean:
+		// 子はない
+
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			if pair != nil {
+				Walk(v, pair)
+			}
+		}
+
+	case *HashPair:
+		if n.Key != nil {
+			Walk(v, n.Key)
+		}
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+
+	case *PrefixExpression:
+		if n.Right != nil {
+			Walk(v, n.Right)
+		}
+
+	case *InfixExpression:
+		if n.Left != nil {
+			Walk(v, n.Left)
+		}
+		if n.Right != nil {
+			Walk(v, n.Right)
+		}
+
+	case *IfExpression:
+		if n.Condition != nil {
+			Walk(v, n.Condition)
+		}
+		if n.Consequence != nil {
+			Walk(v, n.Consequence)
+		}
+		if n.Alternative != nil {
+			Walk(v, n.Alternative)
+		}
+
+	case *TryExpression:
+		if n.Block != nil {
+			Walk(v, n.Block)
+		}
+		if n.CatchParam != nil {
+			Walk(v, n.CatchParam)
+		}
+		if n.Catch != nil {
+			Walk(v, n.Catch)
+		}
+		if n.Finally != nil {
+			Walk(v, n.Finally)
+		}
+
+	case *SpawnExpression:
+		if n.Call != nil {
+			Walk(v, n.Call)
+		}
+
+	case *SelectExpression:
+		for _, c := range n.Cases {
+			if c != nil {
+				Walk(v, c)
+			}
+		}
+		if n.Default != nil {
+			Walk(v, n.Default)
+		}
+
+	case *SelectCase:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		if n.Operation != nil {
+			Walk(v, n.Operation)
+		}
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+
+	case *FunctionLiteral:
+		for _, p := range n.Parameters {
+			Walk(v, p)
+		}
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+
+	case *CallExpression:
+		if n.Function != nil {
+			Walk(v, n.Function)
+		}
+		walkExpressions(v, n.Arguments)
+
+	case *IndexExpression:
+		if n.Left != nil {
+			Walk(v, n.Left)
+		}
+		if n.Index != nil {
+			Walk(v, n.Index)
+		}
+
+	case *MemberExpression:
+		if n.Object != nil {
+			Walk(v, n.Object)
+		}
+		if n.Member != nil {
+			Walk(v, n.Member)
+		}
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", node))
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, stmts []Statement) {
+	for _, s := range stmts {
+		if s != nil {
+			Walk(v, s)
+		}
+	}
+}
+
+func walkExpressions(v Visitor, exps []Expression) {
+	for _, e := range exps {
+		if e != nil {
+			Walk(v, e)
+		}
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// 構文木を深さ優先でたどり、ノードごとにf(node)を呼ぶ
+// fがfalseを返すとそのノードの子は訪れない。子を訪れ終わるとf(nil)が呼ばれる
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// ノードの直接の子をWalkと同じ順で返す
+func Children(node Node) []Node {
+	children := []Node{}
+	Inspect(node, func(n Node) bool {
+		if n == node {
+			return true
+		}
+		if n != nil {
+			children = append(children, n)
+		}
+		return false
+	})
+	return children
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// 変更箇所の前後に出す行数
+const diffContext = 3
+
+// aとbの差分をunified diff形式で書き出す
+func writeDiff(out io.Writer, name string, a, b string) {
+	x := splitLines(a)
+	y := splitLines(b)
+	ops := diffLines(x, y)
+
+	fmt.Fprintf(out, "--- %s\n+++ %s\n", name, name)
+
+	for start := 0; start < len(ops); {
+		// 次の変更を探す
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// 前後diffContext行を含めたhunkの範囲を決める。変更同士が近ければ1つにまとめる
+		begin := start - diffContext
+		if begin < 0 {
+			begin = 0
+		}
+		end := start
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			same := end
+			for same < len(ops) && ops[same].kind == ' ' {
+				same++
+			}
+			if same == len(ops) || same-end > 2*diffContext {
+				end += diffContext
+				if end > len(ops) {
+					end = len(ops)
+				}
+				break
+			}
+			end = same
+		}
+
+		writeHunk(out, ops[begin:end])
+		start = end
+	}
+}
+
+type diffOp struct {
+	kind  byte // ' ', '-', '+'
+	line  string
+	aLine int // aでの行番号(1始まり)
+	bLine int // bでの行番号(1始まり)
+}
+
+func writeHunk(out io.Writer, ops []diffOp) {
+	aStart, bStart := ops[0].aLine, ops[0].bLine
+	aCount, bCount := 0, 0
+	for _, op := range ops {
+		if op.kind != '+' {
+			aCount++
+		}
+		if op.kind != '-' {
+			bCount++
+		}
+	}
+	if aCount == 0 {
+		aStart--
+	}
+	if bCount == 0 {
+		bStart--
+	}
+
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+	for _, op := range ops {
+		fmt.Fprintf(out, "%c%s\n", op.kind, op.line)
+	}
+}
+
+// 行ごとの差分を求める
+// Myersの差分アルゴリズムを、中央のスネークで分割して線形の空間で使う。時間は行数と違う行の数の積に比例するので、
+// 大きなファイルでも、変更が少なければすぐに終わり、行数の2乗の表も作らない
+func diffLines(x, y []string) []diffOp {
+	d := &differ{x: x, y: y, ops: []diffOp{}}
+	d.compare(0, len(x), 0, len(y))
+
+	// 続けて変わった行は、消した行を先に、足した行を後に並べ直す
+	ops := d.ops
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+		end := start
+		for end < len(ops) && ops[end].kind != ' ' {
+			end++
+		}
+		sort.SliceStable(ops[start:end], func(i, j int) bool {
+			return ops[start+i].kind == '-' && ops[start+j].kind == '+'
+		})
+		start = end
+	}
+
+	a, b := 0, 0
+	for i := range ops {
+		ops[i].aLine, ops[i].bLine = a+1, b+1
+		if ops[i].kind != '+' {
+			a++
+		}
+		if ops[i].kind != '-' {
+			b++
+		}
+	}
+	return ops
+}
+
+// 行番号はdiffLinesで最後に振る
+type differ struct {
+	x, y []string
+	ops  []diffOp
+}
+
+// x[i:i2]とy[j:j2]の差分をopsに順に足す
+func (d *differ) compare(i, i2, j, j2 int) {
+	for i < i2 && j < j2 && d.x[i] == d.y[j] {
+		d.ops = append(d.ops, diffOp{kind: ' ', line: d.x[i]})
+		i++
+		j++
+	}
+	suffix := 0
+	for i < i2-suffix && j < j2-suffix && d.x[i2-1-suffix] == d.y[j2-1-suffix] {
+		suffix++
+	}
+	i2, j2 = i2-suffix, j2-suffix
+
+	if i < i2 && j < j2 {
+		if xm, ym, ok := d.bisect(i, i2, j, j2); ok {
+			d.compare(i, xm, j, ym)
+			d.compare(xm, i2, ym, j2)
+		} else {
+			d.replace(i, i2, j, j2)
+		}
+	} else {
+		d.replace(i, i2, j, j2)
+	}
+
+	for k := 0; k < suffix; k++ {
+		d.ops = append(d.ops, diffOp{kind: ' ', line: d.x[i2+k]})
+	}
+}
+
+// x[i:i2]を消してy[j:j2]を足す
+func (d *differ) replace(i, i2, j, j2 int) {
+	for ; i < i2; i++ {
+		d.ops = append(d.ops, diffOp{kind: '-', line: d.x[i]})
+	}
+	for ; j < j2; j++ {
+		d.ops = append(d.ops, diffOp{kind: '+', line: d.y[j]})
+	}
+}
+
+// x[i:i2]とy[j:j2]の最短の編集を前と後ろの両方から探し、出会ったところで2つに分ける位置を返す
+// 共通の行が1つもなければokがfalse
+func (d *differ) bisect(i, i2, j, j2 int) (xm, ym int, ok bool) {
+	n, m := i2-i, j2-j
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	v1 := make([]int, 2*offset+1)
+	v2 := make([]int, 2*offset+1)
+	for k := range v1 {
+		v1[k], v2[k] = -1, -1
+	}
+	v1[offset+1], v2[offset+1] = 0, 0
+
+	delta := n - m
+	front := delta%2 != 0 // 前からの探索で出会いを確かめるか
+	k1start, k1end, k2start, k2end := 0, 0, 0, 0
+
+	for D := 0; D < maxD; D++ {
+		// 前から
+		for k1 := -D + k1start; k1 <= D-k1end; k1 += 2 {
+			var x1 int
+			if k1 == -D || (k1 != D && v1[offset+k1-1] < v1[offset+k1+1]) {
+				x1 = v1[offset+k1+1]
+			} else {
+				x1 = v1[offset+k1-1] + 1
+			}
+			y1 := x1 - k1
+			for x1 < n && y1 < m && d.x[i+x1] == d.y[j+y1] {
+				x1++
+				y1++
+			}
+			v1[offset+k1] = x1
+
+			switch {
+			case x1 > n:
+				k1end += 2
+			case y1 > m:
+				k1start += 2
+			case front:
+				k2 := offset + delta - k1
+				if k2 >= 0 && k2 < len(v2) && v2[k2] != -1 && x1 >= n-v2[k2] {
+					return i + x1, j + y1, true
+				}
+			}
+		}
+
+		// 後ろから
+		for k2 := -D + k2start; k2 <= D-k2end; k2 += 2 {
+			var x2 int
+			if k2 == -D || (k2 != D && v2[offset+k2-1] < v2[offset+k2+1]) {
+				x2 = v2[offset+k2+1]
+			} else {
+				x2 = v2[offset+k2-1] + 1
+			}
+			y2 := x2 - k2
+			for x2 < n && y2 < m && d.x[i2-1-x2] == d.y[j2-1-y2] {
+				x2++
+				y2++
+			}
+			v2[offset+k2] = x2
+
+			switch {
+			case x2 > n:
+				k2end += 2
+			case y2 > m:
+				k2start += 2
+			case !front:
+				k1 := offset + delta - k2
+				if k1 >= 0 && k1 < len(v1) && v1[k1] != -1 {
+					x1 := v1[k1]
+					y1 := offset + x1 - k1
+					if x1 >= n-x2 {
+						return i + x1, j + y1, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
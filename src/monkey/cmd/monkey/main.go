@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"monkey"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/printer"
+	"monkey/repl"
+	"monkey/token"
+	"os"
+	"os/user"
+	"strings"
+)
+
+// 終了コード
+const (
+	exitOK    = 0
+	exitError = 1 // 構文エラーや実行時エラー
+	exitUsage = 2 // コマンドの使い方が間違っている
+)
+
+// monkeyのサブコマンド
+type command struct {
+	name string
+	args string
+	help string
+	run  func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
+
+var commands []command
+
+// usageがcommandsを参照するので、初期化の循環を避けるためにinitで組み立てる
+func init() {
+	commands = []command{
+		{name: "run", args: "<file> [args...]", help: "run a script. args are bound to the global args", run: runRun},
+		{name: "repl", help: "start the interactive REPL", run: runRepl},
+		{name: "fmt", args: "[-w] [-d] [file...]", help: "format source files", run: runFmt},
+		{name: "check", args: "[file...]", help: "parse files and report syntax errors", run: runCheck},
+		{name: "tokens", args: "[file]", help: "print the tokens produced by the lexer", run: runTokens},
+		{name: "ast", args: "[--tree|--dot|--json] [file]", help: "print the syntax tree produced by the parser", run: runAST},
+		{name: "help", help: "show this help", run: runHelp},
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// 引数なしならREPLを起動する
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		return runRepl(args, stdin, stdout, stderr)
+	}
+
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:], stdin, stdout, stderr)
+		}
+	}
+
+	fmt.Fprintf(stderr, "monkey: unknown command %q\n", args[0])
+	usage(stderr)
+	return exitUsage
+}
+
+func usage(out io.Writer) {
+	fmt.Fprintf(out, "usage: monkey <command> [arguments]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-26s %s\n", commandUsage(c.name), c.help)
+	}
+}
+
+// "ast [--json] [file]" のようなコマンドの書式
+func commandUsage(name string) string {
+	for _, c := range commands {
+		if c.name == name && c.args != "" {
+			return c.name + " " + c.args
+		}
+	}
+	return name
+}
+
+func runHelp(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	usage(stdout)
+	return exitOK
+}
+
+func runRepl(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) != 0 {
+		fmt.Fprintf(stderr, "usage: monkey repl\n")
+		return exitUsage
+	}
+
+	name := "there"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	fmt.Fprintf(stdout, "Hello %s! This is the Monkey programing language!\n", name)
+	fmt.Fprintf(stdout, "Feel free to type commands (:help for REPL commands)\n")
+	repl.Start(stdin, stdout)
+	return exitOK
+}
+
+// ファイルを評価する。ファイルより後ろの引数は文字列の配列としてargsに束縛する
+func runRun(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintf(stderr, "usage: monkey run <file> [args...]\n")
+		return exitUsage
+	}
+
+	evaluator.Output = stdout
+
+	// importは実行するファイルのディレクトリ、MONKEY_PATHの順に探す
+	// コマンドから実行するスクリプトは利用者のものなので、fsモジュールとimportにはOSのファイルを制限なしに使わせる
+	in := monkey.New()
+	in.Modules.SearchPath = evaluator.EnvSearchPath()
+	in.Modules.Sandbox(evaluator.OSFileSystem{})
+	if err := in.Set("args", args[1:]); err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return exitError
+	}
+
+	_, err := in.EvalFile(args[0])
+	switch err := err.(type) {
+	case nil:
+		return exitOK
+	case *monkey.ParseError:
+		printParseErrors(stderr, args[0], err.Errors)
+	case *object.Error:
+		fmt.Fprintln(stderr, err.Traceback())
+	default:
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+	}
+	return exitError
+}
+
+// ファイルを指定しなければ標準入力をフォーマットして標準出力に書く
+// -wなら元のファイルを書き換え、-dなら差分だけを表示する
+func runFmt(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	write := flags.Bool("w", false, "write the result to the source file instead of stdout")
+	diff := flags.Bool("d", false, "display diffs instead of rewriting files")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		if *write {
+			fmt.Fprintf(stderr, "monkey: cannot use -w with standard input\n")
+			return exitUsage
+		}
+		files = []string{"-"}
+	}
+
+	status := exitOK
+	for _, file := range files {
+		source, err := readSource(file, stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			status = exitError
+			continue
+		}
+
+		formatted, err := printer.Format([]byte(source))
+		if err != nil {
+			printParseErrors(stderr, file, strings.Split(err.Error(), "\n"))
+			status = exitError
+			continue
+		}
+
+		switch {
+		case *diff:
+			if string(formatted) != source {
+				writeDiff(stdout, file, source, string(formatted))
+			}
+		case *write:
+			if string(formatted) == source {
+				continue
+			}
+			if err := ioutil.WriteFile(file, formatted, 0644); err != nil {
+				fmt.Fprintf(stderr, "monkey: %s\n", err)
+				status = exitError
+			}
+		default:
+			stdout.Write(formatted)
+		}
+	}
+	return status
+}
+
+// 構文解析だけを行い、エラーがあったファイルを報告する
+func runCheck(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	files := args
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	status := exitOK
+	for _, file := range files {
+		source, err := readSource(file, stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			status = exitError
+			continue
+		}
+
+		p := parser.New(lexer.New(source))
+		p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			printParseErrors(stderr, file, p.Errors())
+			status = exitError
+		}
+	}
+	return status
+}
+
+func runTokens(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	source, status := readSingleSource("tokens", args, stdin, stderr)
+	if status != exitOK {
+		return status
+	}
+
+	l := lexer.New(source)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(stdout, "%d:%d\t%s\t%q\n", tok.Line, tok.Column, tok.Type, tok.Literal)
+	}
+	return exitOK
+}
+
+// 構文木を字下げして書き出す。--treeなら罫線つきの木、--dotならGraphvizのDOT形式、
+// --jsonならJSON(形式はast.EncodeJSONを参照)
+func runAST(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	asJSON := flags.Bool("json", false, "print the syntax tree as JSON")
+	asTree := flags.Bool("tree", false, "print the syntax tree with branch lines")
+	asDot := flags.Bool("dot", false, "print the syntax tree as a Graphviz DOT graph")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	args = flags.Args()
+
+	if countTrue(*asJSON, *asTree, *asDot) > 1 {
+		fmt.Fprintf(stderr, "monkey: only one of --json, --tree and --dot can be used\n")
+		return exitUsage
+	}
+
+	source, status := readSingleSource("ast", args, stdin, stderr)
+	if status != exitOK {
+		return status
+	}
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParseErrors(stderr, sourceName(args), p.Errors())
+		return exitError
+	}
+
+	switch {
+	case *asTree:
+		ast.FprintTree(stdout, program)
+		return exitOK
+	case *asDot:
+		ast.FprintDot(stdout, program)
+		return exitOK
+	case !*asJSON:
+		ast.Fprint(stdout, program)
+		return exitOK
+	}
+
+	data, err := ast.EncodeJSON(program)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return exitError
+	}
+	var out bytes.Buffer
+	json.Indent(&out, data, "", "  ")
+	out.WriteString("\n")
+	out.WriteTo(stdout)
+	return exitOK
+}
+
+func countTrue(flags ...bool) int {
+	n := 0
+	for _, f := range flags {
+		if f {
+			n++
+		}
+	}
+	return n
+}
+
+// ファイルを1つだけ取るコマンドのソースを読む。ファイルを省略したら標準入力から読む
+// 読めなかったときは終了コードを返す
+func readSingleSource(name string, args []string, stdin io.Reader, stderr io.Writer) (string, int) {
+	if len(args) > 1 {
+		fmt.Fprintf(stderr, "usage: monkey %s\n", commandUsage(name))
+		return "", exitUsage
+	}
+
+	source, err := readSource(sourceName(args), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return "", exitError
+	}
+	return source, exitOK
+}
+
+func sourceName(args []string) string {
+	if len(args) == 0 {
+		return "-"
+	}
+	return args[0]
+}
+
+// "-"は標準入力
+func readSource(file string, stdin io.Reader) (string, error) {
+	if file == "-" {
+		source, err := ioutil.ReadAll(stdin)
+		return string(source), err
+	}
+
+	source, err := ioutil.ReadFile(file)
+	return string(source), err
+}
+
+func printParseErrors(out io.Writer, file string, errors []string) {
+	for _, msg := range errors {
+		fmt.Fprintf(out, "%s: %s\n", file, strings.TrimSpace(msg))
+	}
+}
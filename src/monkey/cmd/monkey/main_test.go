@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeScript(t *testing.T, dir, name, source string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSubcommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hello := writeScript(t, dir, "hello.mk", `print("hello", len(args), args[0]);`)
+	broken := writeScript(t, dir, "broken.mk", "let = 1;")
+	failing := writeScript(t, dir, "failing.mk", "let f = fn(x) { x + true };\nf(1);")
+	importing := writeScript(t, dir, "importing.mk", `import "name" as n; import "greet" as g; print(g.greeting, n.name);`)
+	writeScript(t, dir, "name.mk", `export let name = "monkey";`)
+	lib := filepath.Join(dir, "lib")
+	os.Mkdir(lib, 0755)
+	writeScript(t, lib, "greet.mk", `export let greeting = "hi";`)
+	os.Setenv("MONKEY_PATH", lib)
+	defer os.Unsetenv("MONKEY_PATH")
+
+	tests := []struct {
+		args   []string
+		stdin  string
+		status int
+		stdout string
+		stderr string
+	}{
+		{[]string{"run", hello, "a", "b"}, "", exitOK, "hello 2 a\n", ""},
+		{[]string{"run", broken}, "", exitError, "", broken + ": expected next token to be INDENT, got = insted\n" + broken + ": no prefix parse function for = found\n"},
+		{[]string{"run", failing}, "", exitError, "",
+			"Traceback (most recent call last):\n  line 2, column 2, in f\nTypeError at line 1, column 19: type mismatch: INTEGER + BOOLEAN\n"},
+		{[]string{"run", importing}, "", exitOK, "hi monkey\n", ""},
+		{[]string{"run"}, "", exitUsage, "", "usage: monkey run <file> [args...]\n"},
+		{[]string{"check", hello}, "", exitOK, "", ""},
+		{[]string{"check", hello, broken}, "", exitError, "", broken + ": expected next token to be INDENT, got = insted\n" + broken + ": no prefix parse function for = found\n"},
+		{[]string{"check"}, "1 +", exitError, "", "-: no prefix parse function for EOF found\n"},
+		{[]string{"tokens"}, "let x", exitOK, "1:1\tLET\t\"let\"\n1:5\tINDENT\t\"x\"\n", ""},
+		{[]string{"ast"}, "-a", exitOK, "Program\n  ExpressionStatement\n    PrefixExpression -\n      Identifier a\n", ""},
+		{[]string{"ast", "--json"}, "x", exitOK,
+			"{\n  \"comments\": null,\n  \"kind\": \"Program\",\n  \"statements\": [\n    {\n      \"expression\": {\n" +
+				"        \"kind\": \"Identifier\",\n        \"token\": {\n          \"type\": \"INDENT\",\n          \"literal\": \"x\",\n" +
+				"          \"line\": 1,\n          \"column\": 1\n        },\n        \"value\": \"x\"\n      },\n" +
+				"      \"kind\": \"ExpressionStatement\",\n      \"token\": {\n        \"type\": \"INDENT\",\n        \"literal\": \"x\",\n" +
+				"        \"line\": 1,\n        \"column\": 1\n      }\n    }\n  ]\n}\n", ""},
+		{[]string{"ast", "--tree"}, "-a", exitOK, "Program\n`-- ExpressionStatement\n    `-- PrefixExpression -\n        `-- Identifier a\n", ""},
+		{[]string{"ast", "--dot"}, "a", exitOK, "digraph AST {\n  graph [ordering=out];\n  node [shape=box, fontname=\"monospace\"];\n" +
+			"  n0 [label=\"Program\"];\n  n1 [label=\"ExpressionStatement\"];\n  n2 [label=\"Identifier a\"];\n  n1 -> n2;\n  n0 -> n1;\n}\n", ""},
+		{[]string{"ast", "--dot", "--json"}, "a", exitUsage, "", "monkey: only one of --json, --tree and --dot can be used\n"},
+		{[]string{"ast", "a", "b"}, "", exitUsage, "", "usage: monkey ast [--tree|--dot|--json] [file]\n"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		status := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+
+		if status != tt.status {
+			t.Errorf("%v: wrong exit status. want=%d, got=%d", tt.args, tt.status, status)
+		}
+		if stdout.String() != tt.stdout {
+			t.Errorf("%v: wrong stdout.\nwant=%q\ngot=%q", tt.args, tt.stdout, stdout.String())
+		}
+		if stderr.String() != tt.stderr {
+			t.Errorf("%v: wrong stderr.\nwant=%q\ngot=%q", tt.args, tt.stderr, stderr.String())
+		}
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"nope"}, strings.NewReader(""), &stdout, &stderr)
+
+	if status != exitUsage {
+		t.Errorf("wrong exit status. want=%d, got=%d", exitUsage, status)
+	}
+	if !strings.HasPrefix(stderr.String(), "monkey: unknown command \"nope\"\nusage:") {
+		t.Errorf("wrong stderr. got=%q", stderr.String())
+	}
+}
+
+func TestDiffLargeFile(t *testing.T) {
+	lines := make([]string, 20000)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("let v%d = %d;", i, i)
+	}
+	a := strings.Join(lines, "\n") + "\n"
+	lines[0] = "let v0 = -1;"
+	lines[10000] = "let changed = 1;"
+	lines = append(lines[:19999], "let v19998 = 19998;", "let last = 0;")
+	b := strings.Join(lines, "\n") + "\n"
+
+	var out bytes.Buffer
+	writeDiff(&out, "big.mk", a, b)
+	expected := "--- big.mk\n+++ big.mk\n" +
+		"@@ -1,4 +1,4 @@\n-let v0 = 0;\n+let v0 = -1;\n let v1 = 1;\n let v2 = 2;\n let v3 = 3;\n" +
+		"@@ -9998,7 +9998,7 @@\n let v9997 = 9997;\n let v9998 = 9998;\n let v9999 = 9999;\n" +
+		"-let v10000 = 10000;\n+let changed = 1;\n let v10001 = 10001;\n let v10002 = 10002;\n let v10003 = 10003;\n" +
+		"@@ -19997,4 +19997,5 @@\n let v19996 = 19996;\n let v19997 = 19997;\n let v19998 = 19998;\n" +
+		"-let v19999 = 19999;\n+let v19998 = 19998;\n+let last = 0;\n"
+	if out.String() != expected {
+		t.Errorf("wrong diff.\nwant=%q\ngot=%q", expected, out.String())
+	}
+}
+
+func TestFmt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey-fmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := "let a=1;\nlet b = 2;\nlet c = 3;\nlet d = 4;\nlet e = 5;\nlet f = 6;\nlet g = 7;\nlet h = 8;\nlet i=9;\n"
+	formatted := "let a = 1;\nlet b = 2;\nlet c = 3;\nlet d = 4;\nlet e = 5;\nlet f = 6;\nlet g = 7;\nlet h = 8;\nlet i = 9;\n"
+	path := writeScript(t, dir, "messy.mk", source)
+	broken := writeScript(t, dir, "broken.mk", "let = 1;")
+
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"fmt", "-d", path}, strings.NewReader(""), &stdout, &stderr)
+	expected := "--- " + path + "\n+++ " + path + "\n" +
+		"@@ -1,4 +1,4 @@\n-let a=1;\n+let a = 1;\n let b = 2;\n let c = 3;\n let d = 4;\n" +
+		"@@ -6,4 +6,4 @@\n let f = 6;\n let g = 7;\n let h = 8;\n-let i=9;\n+let i = 9;\n"
+	if status != exitOK || stdout.String() != expected {
+		t.Errorf("wrong diff (status %d).\nwant=%q\ngot=%q", status, expected, stdout.String())
+	}
+
+	stdout.Reset()
+	status = run([]string{"fmt", "-w", path}, strings.NewReader(""), &stdout, &stderr)
+	written, _ := ioutil.ReadFile(path)
+	if status != exitOK || string(written) != formatted || stdout.Len() != 0 {
+		t.Errorf("-w did not rewrite the file (status %d). got=%q", status, written)
+	}
+
+	stdout.Reset()
+	run([]string{"fmt", "-d", path}, strings.NewReader(""), &stdout, &stderr)
+	if stdout.Len() != 0 {
+		t.Errorf("formatted file should have no diff. got=%q", stdout.String())
+	}
+
+	stdout.Reset()
+	status = run([]string{"fmt"}, strings.NewReader("fn(x){x}"), &stdout, &stderr)
+	if status != exitOK || stdout.String() != "fn(x) {\n  x\n};\n" {
+		t.Errorf("wrong output for stdin (status %d). got=%q", status, stdout.String())
+	}
+
+	stderr.Reset()
+	status = run([]string{"fmt", "-w", broken}, strings.NewReader(""), &stdout, &stderr)
+	written, _ = ioutil.ReadFile(broken)
+	if status != exitError || string(written) != "let = 1;" || !strings.HasPrefix(stderr.String(), broken+": ") {
+		t.Errorf("file with syntax errors should be left alone (status %d). stderr=%q", status, stderr.String())
+	}
+}
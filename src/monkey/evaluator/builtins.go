@@ -0,0 +1,223 @@
+package evaluator
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"monkey/object"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// printの出力先
+var Output io.Writer = os.Stdout
+
+// 複数のタスクから同時にprintしても、行が混ざらないようにする
+var outputMu sync.Mutex
+
+// 環境で見つからなかった識別子はここから探す
+var (
+	builtinsMu sync.RWMutex
+	builtins   = map[string]*object.Builtin{}
+)
+
+// Go側から組み込み関数を追加する。同じ名前で登録すると上書きされる
+func RegisterBuiltin(name string, fn object.BuiltinFunction) {
+	builtinsMu.Lock()
+	defer builtinsMu.Unlock()
+
+	builtins[name] = &object.Builtin{Fn: fn}
+}
+
+// 引数に渡された関数を呼び出す組み込み関数を追加する
+func RegisterHigherOrderBuiltin(name string, fn object.HigherOrderFunction) {
+	builtinsMu.Lock()
+	defer builtinsMu.Unlock()
+
+	builtins[name] = &object.Builtin{HigherOrderFn: fn}
+}
+
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	builtinsMu.RLock()
+	defer builtinsMu.RUnlock()
+
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
+func init() {
+	RegisterBuiltin("len", builtinLen)
+	RegisterBuiltin("print", builtinPrint)
+	RegisterBuiltin("type", builtinType)
+	RegisterBuiltin("str", builtinStr)
+	RegisterBuiltin("int", builtinInt)
+	RegisterBuiltin("float", builtinFloat)
+	RegisterBuiltin("first", builtinFirst)
+	RegisterBuiltin("rest", builtinRest)
+	RegisterBuiltin("push", builtinPush)
+}
+
+func builtinLen(args ...object.Object) object.Object {
+	if err := object.CheckArgCount("len", args, 1); err != nil {
+		return err
+	}
+
+	switch arg := args[0].(type) {
+	case *object.String:
+		return &object.Integer{Value: int64(len(arg.Value))}
+	case *object.Array:
+		return &object.Integer{Value: int64(len(arg.Elements))}
+	case *object.Hash:
+		return &object.Integer{Value: int64(len(arg.Pairs))}
+	default:
+		return object.NewError(object.TYPE_ERROR, "argument to len not supported, got %s",
+			args[0].Type())
+	}
+}
+
+// 引数を空白区切りで1行に出力する
+func builtinPrint(args ...object.Object) object.Object {
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = arg.Inspect()
+	}
+	outputMu.Lock()
+	fmt.Fprintln(Output, strings.Join(values, " "))
+	outputMu.Unlock()
+
+	return NULL
+}
+
+func builtinType(args ...object.Object) object.Object {
+	if err := object.CheckArgCount("type", args, 1); err != nil {
+		return err
+	}
+
+	return &object.String{Value: string(args[0].Type())}
+}
+
+func builtinStr(args ...object.Object) object.Object {
+	if err := object.CheckArgCount("str", args, 1); err != nil {
+		return err
+	}
+
+	return &object.String{Value: args[0].Inspect()}
+}
+
+func builtinInt(args ...object.Object) object.Object {
+	if err := object.CheckArgCount("int", args, 1); err != nil {
+		return err
+	}
+
+	switch arg := args[0].(type) {
+	case *object.Integer:
+		return arg
+	// 小数部は切り捨てる
+	case *object.Float:
+		if math.IsNaN(arg.Value) || arg.Value >= math.MaxInt64 || arg.Value < math.MinInt64 {
+			return object.NewError(object.VALUE_ERROR, "cannot convert %s to integer", arg.Inspect())
+		}
+		return &object.Integer{Value: int64(arg.Value)}
+	case *object.Boolean:
+		if arg.Value {
+			return &object.Integer{Value: 1}
+		}
+		return &object.Integer{Value: 0}
+	case *object.String:
+		value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+		if err != nil {
+			return object.NewError(object.VALUE_ERROR, "could not parse %q as integer", arg.Value)
+		}
+		return &object.Integer{Value: value}
+	default:
+		return object.NewError(object.TYPE_ERROR, "argument to int not supported, got %s",
+			args[0].Type())
+	}
+}
+
+func builtinFloat(args ...object.Object) object.Object {
+	if err := object.CheckArgCount("float", args, 1); err != nil {
+		return err
+	}
+
+	switch arg := args[0].(type) {
+	case *object.Float:
+		return arg
+	case *object.Integer:
+		return &object.Float{Value: float64(arg.Value)}
+	case *object.String:
+		value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+		if err != nil {
+			return object.NewError(object.VALUE_ERROR, "could not parse %q as float", arg.Value)
+		}
+		return &object.Float{Value: value}
+	default:
+		return object.NewError(object.TYPE_ERROR, "argument to float not supported, got %s",
+			args[0].Type())
+	}
+}
+
+func builtinFirst(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("first", args, object.ARRAY_OBJ); err != nil {
+		return err
+	}
+
+	arr := args[0].(*object.Array)
+	if len(arr.Elements) > 0 {
+		return arr.Elements[0]
+	}
+
+	return NULL
+}
+
+// 先頭以外の要素を持つ新しい配列を返す。元の配列は変更しない
+func builtinRest(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("rest", args, object.ARRAY_OBJ); err != nil {
+		return err
+	}
+
+	arr := args[0].(*object.Array)
+	length := len(arr.Elements)
+	if length > 0 {
+		newElements := make([]object.Object, length-1)
+		copy(newElements, arr.Elements[1:length])
+		return &object.Array{Elements: newElements}
+	}
+
+	return NULL
+}
+
+// 末尾に要素を追加した新しい配列を返す。元の配列は変更しない
+func builtinPush(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("push", args, object.ARRAY_OBJ, object.ANY_OBJ); err != nil {
+		return err
+	}
+
+	arr := args[0].(*object.Array)
+	length := len(arr.Elements)
+
+	newElements := make([]object.Object, length+1)
+	copy(newElements, arr.Elements)
+	newElements[length] = args[1]
+
+	return &object.Array{Elements: newElements}
+}
+
+// 登録されている組み込み関数の名前を辞書順で返す
+func BuiltinNames() []string {
+	builtinsMu.RLock()
+	defer builtinsMu.RUnlock()
+
+	names := make([]string, 0, len(builtins)+len(taskBuiltins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	for name := range taskBuiltins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,401 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"sort"
+	"strings"
+)
+
+// 配列とハッシュに関数を適用する組み込み関数
+//
+// コールバックには、配列なら要素を、ハッシュならキーと値の2つを渡す
+// ハッシュはキーの順(Inspectと同じ順)にたどるので、何度呼んでも同じ順になる
+// コールバックの中のエラーは、そこで処理をやめてそのまま呼び出し元に返す
+func init() {
+	RegisterHigherOrderBuiltin("map", builtinMap)
+	RegisterHigherOrderBuiltin("filter", builtinFilter)
+	RegisterHigherOrderBuiltin("reduce", builtinReduce)
+	RegisterHigherOrderBuiltin("each", builtinEach)
+	RegisterHigherOrderBuiltin("find", builtinFind)
+	RegisterHigherOrderBuiltin("any", builtinAny)
+	RegisterHigherOrderBuiltin("all", builtinAll)
+	RegisterHigherOrderBuiltin("sortBy", builtinSortBy)
+	RegisterHigherOrderBuiltin("groupBy", builtinGroupBy)
+	RegisterBuiltin("zip", builtinZip)
+	RegisterBuiltin("range", builtinRange)
+}
+
+// 引数の数と、1つ目が配列かハッシュ、2つ目が関数であることを検査する
+func checkCollectionArgs(name string, args []object.Object, min, max int) *object.Error {
+	if err := object.CheckArgRange(name, args, min, max); err != nil {
+		return err
+	}
+
+	if t := args[0].Type(); t != object.ARRAY_OBJ && t != object.HASH_OBJ {
+		return object.NewError(object.TYPE_ERROR, "argument 1 to %s must be ARRAY or HASH, got %s", name, t)
+	}
+	if t := args[1].Type(); t != object.FUNCTION_OBJ && t != object.BUILTIN_OBJ {
+		return object.NewError(object.TYPE_ERROR, "argument 2 to %s must be FUNCTION, got %s", name, t)
+	}
+	return nil
+}
+
+// 要素ごとにコールバックに渡す引数を返す。配列なら(要素)、ハッシュならキーの順に(キー, 値)
+func collectionEntries(coll object.Object) [][]object.Object {
+	switch coll := coll.(type) {
+	case *object.Array:
+		entries := make([][]object.Object, len(coll.Elements))
+		for i, el := range coll.Elements {
+			entries[i] = []object.Object{el}
+		}
+		return entries
+	case *object.Hash:
+		pairs := coll.SortedPairs()
+		entries := make([][]object.Object, len(pairs))
+		for i, pair := range pairs {
+			entries[i] = []object.Object{pair.Key, pair.Value}
+		}
+		return entries
+	default:
+		return nil
+	}
+}
+
+// 要素を結果に入れるときの値。ハッシュの要素は[キー, 値]の配列にする
+func entryValue(entry []object.Object) object.Object {
+	if len(entry) == 1 {
+		return entry[0]
+	}
+	return &object.Array{Elements: []object.Object{entry[0], entry[1]}}
+}
+
+// 値を返さなかった関数の結果はnullにする
+func callValue(call object.CallFunction, fn object.Object, args ...object.Object) object.Object {
+	if result := call(fn, args...); result != nil {
+		return result
+	}
+	return NULL
+}
+
+// 結果を配列で返す
+func builtinMap(call object.CallFunction, args ...object.Object) object.Object {
+	if err := checkCollectionArgs("map", args, 2, 2); err != nil {
+		return err
+	}
+
+	entries := collectionEntries(args[0])
+	results := make([]object.Object, len(entries))
+	for i, entry := range entries {
+		result := callValue(call, args[1], entry...)
+		if isError(result) {
+			return result
+		}
+		results[i] = result
+	}
+	return &object.Array{Elements: results}
+}
+
+// コールバックが真を返した要素だけを残す。ハッシュからはハッシュを作る
+func builtinFilter(call object.CallFunction, args ...object.Object) object.Object {
+	if err := checkCollectionArgs("filter", args, 2, 2); err != nil {
+		return err
+	}
+
+	elements := []object.Object{}
+	pairs := make(map[object.HashKey]object.HashPair)
+	for _, entry := range collectionEntries(args[0]) {
+		result := callValue(call, args[1], entry...)
+		if isError(result) {
+			return result
+		}
+		if !isTruthy(result) {
+			continue
+		}
+
+		if len(entry) == 1 {
+			elements = append(elements, entry[0])
+		} else {
+			pairs[entry[0].(object.Hashable).HashKey()] = object.HashPair{Key: entry[0], Value: entry[1]}
+		}
+	}
+
+	if args[0].Type() == object.HASH_OBJ {
+		return &object.Hash{Pairs: pairs}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// 配列ならf(acc, 要素)、ハッシュならf(acc, キー, 値)の結果を次のaccにする
+// initialを省略すると配列の最初の要素から始める。ハッシュではinitialを省略できない
+func builtinReduce(call object.CallFunction, args ...object.Object) object.Object {
+	if err := checkCollectionArgs("reduce", args, 2, 3); err != nil {
+		return err
+	}
+
+	entries := collectionEntries(args[0])
+	var acc object.Object
+	switch {
+	case len(args) == 3:
+		acc = args[2]
+	case args[0].Type() == object.HASH_OBJ:
+		return object.NewError(object.ARGUMENT_ERROR, "reduce of HASH requires an initial value")
+	case len(entries) == 0:
+		return object.NewError(object.VALUE_ERROR, "reduce of empty ARRAY with no initial value")
+	default:
+		acc, entries = entries[0][0], entries[1:]
+	}
+
+	for _, entry := range entries {
+		acc = callValue(call, args[1], append([]object.Object{acc}, entry...)...)
+		if isError(acc) {
+			return acc
+		}
+	}
+	return acc
+}
+
+// 要素ごとにコールバックを呼ぶ。結果は捨ててnullを返す
+func builtinEach(call object.CallFunction, args ...object.Object) object.Object {
+	if err := checkCollectionArgs("each", args, 2, 2); err != nil {
+		return err
+	}
+
+	for _, entry := range collectionEntries(args[0]) {
+		if result := callValue(call, args[1], entry...); isError(result) {
+			return result
+		}
+	}
+	return NULL
+}
+
+// コールバックが最初に真を返した要素。ハッシュなら[キー, 値]。見つからなければnull
+func builtinFind(call object.CallFunction, args ...object.Object) object.Object {
+	if err := checkCollectionArgs("find", args, 2, 2); err != nil {
+		return err
+	}
+
+	for _, entry := range collectionEntries(args[0]) {
+		result := callValue(call, args[1], entry...)
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) {
+			return entryValue(entry)
+		}
+	}
+	return NULL
+}
+
+// コールバックが真(want)を返す要素があればそこでやめてwantを返す
+func findTruthy(name string, want bool) object.HigherOrderFunction {
+	return func(call object.CallFunction, args ...object.Object) object.Object {
+		if err := checkCollectionArgs(name, args, 2, 2); err != nil {
+			return err
+		}
+
+		for _, entry := range collectionEntries(args[0]) {
+			result := callValue(call, args[1], entry...)
+			if isError(result) {
+				return result
+			}
+			if isTruthy(result) == want {
+				return nativeBoolToBooleanObject(want)
+			}
+		}
+		return nativeBoolToBooleanObject(!want)
+	}
+}
+
+var (
+	// 空ならfalse
+	builtinAny = findTruthy("any", true)
+
+	// 空ならtrue。偽を返す要素を探す
+	builtinAll = findTruthy("all", false)
+)
+
+// コールバックが返すキーの昇順に並べた配列を返す。キーが等しい要素は元の順のまま
+// キーはすべて数、すべて文字列、すべて時刻、すべて時間の長さのいずれかでなければならない
+// ハッシュは[キー, 値]の配列を並べる
+func builtinSortBy(call object.CallFunction, args ...object.Object) object.Object {
+	if err := checkCollectionArgs("sortBy", args, 2, 2); err != nil {
+		return err
+	}
+
+	entries := collectionEntries(args[0])
+	elements := make([]object.Object, len(entries))
+	keys := make([]object.Object, len(entries))
+	for i, entry := range entries {
+		key := callValue(call, args[1], entry...)
+		if isError(key) {
+			return key
+		}
+		first := key
+		if i > 0 {
+			first = keys[0]
+		}
+		if !orderable(first, key) {
+			return object.NewError(object.TYPE_ERROR, "sortBy: cannot compare %s and %s", first.Type(), key.Type())
+		}
+		elements[i], keys[i] = entryValue(entry), key
+	}
+
+	indices := make([]int, len(entries))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		return lessThan(keys[indices[i]], keys[indices[j]])
+	})
+
+	sorted := make([]object.Object, len(indices))
+	for i, index := range indices {
+		sorted[i] = elements[index]
+	}
+	return &object.Array{Elements: sorted}
+}
+
+// lessThanで比べられる組み合わせならtrue
+func orderable(a, b object.Object) bool {
+	if isNumber(a) && isNumber(b) {
+		return true
+	}
+	switch a.(type) {
+	case *object.String, *object.Time, *object.Duration:
+		return a.Type() == b.Type()
+	default:
+		return false
+	}
+}
+
+func lessThan(a, b object.Object) bool {
+	switch a := a.(type) {
+	case *object.String:
+		return strings.Compare(a.Value, b.(*object.String).Value) < 0
+	case *object.Time:
+		return a.Value.Before(b.(*object.Time).Value)
+	case *object.Duration:
+		return a.Value < b.(*object.Duration).Value
+	}
+
+	// 整数どうしはfloat64にすると大きな数で精度が落ちるので、そのまま比べる
+	if x, ok := a.(*object.Integer); ok {
+		if y, ok := b.(*object.Integer); ok {
+			return x.Value < y.Value
+		}
+	}
+	x, _ := toFloat(a)
+	y, _ := toFloat(b)
+	return x < y
+}
+
+// コールバックが返すキーごとに要素をまとめたハッシュを返す。まとめた中では元の順のまま
+// 配列の要素は配列に、ハッシュのキーと値はハッシュにまとめる
+func builtinGroupBy(call object.CallFunction, args ...object.Object) object.Object {
+	if err := checkCollectionArgs("groupBy", args, 2, 2); err != nil {
+		return err
+	}
+
+	groups := make(map[object.HashKey]object.HashPair)
+	for _, entry := range collectionEntries(args[0]) {
+		key := callValue(call, args[1], entry...)
+		if isError(key) {
+			return key
+		}
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return object.NewError(object.TYPE_ERROR, "groupBy: unusable as hash key: %s", key.Type())
+		}
+
+		group, ok := groups[hashKey.HashKey()]
+		if !ok {
+			group = object.HashPair{Key: key, Value: &object.Array{Elements: []object.Object{}}}
+			if len(entry) == 2 {
+				group.Value = &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
+			}
+			groups[hashKey.HashKey()] = group
+		}
+
+		switch g := group.Value.(type) {
+		case *object.Array:
+			g.Elements = append(g.Elements, entry[0])
+		case *object.Hash:
+			g.Pairs[entry[0].(object.Hashable).HashKey()] = object.HashPair{Key: entry[0], Value: entry[1]}
+		}
+	}
+	return &object.Hash{Pairs: groups}
+}
+
+// 配列の同じ位置の要素を組にした配列を返す。長さは一番短い配列に合わせる
+// zip([1, 2], ["a", "b"])は[[1, "a"], [2, "b"]]
+func builtinZip(args ...object.Object) object.Object {
+	length := -1
+	for i, arg := range args {
+		arr, ok := arg.(*object.Array)
+		if !ok {
+			return object.NewError(object.TYPE_ERROR, "argument %d to zip must be ARRAY, got %s", i+1, arg.Type())
+		}
+		if length < 0 || len(arr.Elements) < length {
+			length = len(arr.Elements)
+		}
+	}
+	if length < 0 {
+		length = 0
+	}
+
+	tuples := make([]object.Object, length)
+	for i := range tuples {
+		tuple := make([]object.Object, len(args))
+		for j, arg := range args {
+			tuple[j] = arg.(*object.Array).Elements[i]
+		}
+		tuples[i] = &object.Array{Elements: tuple}
+	}
+	return &object.Array{Elements: tuples}
+}
+
+// 一度に作れる整数の数。大きすぎる配列でメモリを使い果たさないようにする
+const maxRangeLength = 1 << 24
+
+// range(end)は0からend-1まで、range(start, end)はstartからend-1まで、
+// range(start, end, step)はstepずつ増やした(stepが負なら減らした)整数の配列を返す
+func builtinRange(args ...object.Object) object.Object {
+	if err := object.CheckArgRange("range", args, 1, 3); err != nil {
+		return err
+	}
+	for i, arg := range args {
+		if arg.Type() != object.INTEGER_OBJ {
+			return object.NewError(object.TYPE_ERROR, "argument %d to range must be INTEGER, got %s",
+				i+1, arg.Type())
+		}
+	}
+
+	var start, end, step int64 = 0, intArg(args, 0), 1
+	if len(args) >= 2 {
+		start, end = intArg(args, 0), intArg(args, 1)
+	}
+	if len(args) == 3 {
+		step = intArg(args, 2)
+	}
+	if step == 0 {
+		return object.NewError(object.VALUE_ERROR, "range: step must not be zero")
+	}
+
+	// 溢れないようにuint64で数える
+	var length uint64
+	switch {
+	case step > 0 && start < end:
+		length = (uint64(end-start)-1)/uint64(step) + 1
+	case step < 0 && start > end:
+		length = (uint64(start-end)-1)/uint64(-step) + 1
+	}
+	if length > maxRangeLength {
+		return object.NewError(object.VALUE_ERROR, "range: too many elements: %d", length)
+	}
+
+	elements := make([]object.Object, length)
+	for i := range elements {
+		elements[i] = &object.Integer{Value: start + int64(i)*step}
+	}
+	return &object.Array{Elements: elements}
+}
@@ -0,0 +1,369 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+	"strings"
+)
+
+// chan(n)で作るチャネル。容量nまでは受け取る側を待たずに送れる(省略すると0で、受け取られるまで待つ)
+// 閉じたチャネルからは、残っている値を受け取り終えるとnullが返る
+// 中身はチャネルを作ったTaskGroupのmuで守る
+type Channel struct {
+	group    *TaskGroup
+	id       int
+	capacity int
+	buffer   []object.Object
+	closed   bool
+	sendq    []chanWait // 送れるのを待っている操作
+	recvq    []chanWait // 受け取れるのを待っている操作
+}
+
+func (c *Channel) Type() object.ObjectType { return object.CHANNEL_OBJ }
+func (c *Channel) Inspect() string         { return fmt.Sprintf("<chan %d>", c.id) }
+
+// g.muを持って呼ぶ
+func (g *TaskGroup) newChannel(capacity int) *Channel {
+	g.nextChan++
+	return &Channel{group: g, id: g.nextChan, capacity: capacity}
+}
+
+// チャネルへの1つの操作
+type chanOp struct {
+	ch    *Channel
+	send  bool
+	value object.Object // 送る値
+}
+
+func (op chanOp) String() string {
+	if op.send {
+		return "send " + op.ch.Inspect()
+	}
+	return "recv " + op.ch.Inspect()
+}
+
+// チャネルを待っているタスク。selectでは1つの待ちに複数の操作が並び、どれか1つができたら終わる
+type waiter struct {
+	task  *task
+	ops   []chanOp
+	done  bool
+	index int           // できた操作の添字
+	value object.Object // 受け取った値
+	err   *object.Error
+	wake  chan struct{} // 終わったら閉じる
+}
+
+func (w *waiter) describe() string {
+	if len(w.ops) == 0 {
+		return "select with no cases"
+	}
+
+	ops := make([]string, len(w.ops))
+	for i, op := range w.ops {
+		ops[i] = op.String()
+	}
+	return strings.Join(ops, " or ")
+}
+
+// チャネルの待ち行列の要素。iはw.opsの中の添字
+type chanWait struct {
+	w *waiter
+	i int
+}
+
+// 待ちを終わらせてタスクを起こす。g.muを持って呼ぶ
+func (g *TaskGroup) complete(w *waiter, index int, value object.Object, err *object.Error) {
+	w.done = true
+	w.index = index
+	w.value = value
+	w.err = err
+	w.task.waiting = nil
+	g.sched.wake(w)
+}
+
+// 待ち行列の先頭から、まだ終わっていない待ちを取り出す
+func dequeue(q *[]chanWait) (chanWait, bool) {
+	for len(*q) > 0 {
+		cw := (*q)[0]
+		*q = (*q)[1:]
+		if !cw.w.done {
+			return cw, true
+		}
+	}
+	return chanWait{}, false
+}
+
+func removeWaiter(q []chanWait, w *waiter) []chanWait {
+	kept := q[:0]
+	for _, cw := range q {
+		if cw.w != w {
+			kept = append(kept, cw)
+		}
+	}
+	return kept
+}
+
+// 待たずにできればopを実行して、受け取った値(送ったときはnull)を返す。できなければokがfalse
+// g.muを持って呼ぶ
+func (g *TaskGroup) try(op chanOp) (value object.Object, ok bool, err *object.Error) {
+	ch := op.ch
+
+	if op.send {
+		if ch.closed {
+			return nil, false, object.NewError(object.CHANNEL_ERROR, "send on closed channel %s", ch.Inspect())
+		}
+		if r, ok := dequeue(&ch.recvq); ok {
+			g.complete(r.w, r.i, op.value, nil)
+			return NULL, true, nil
+		}
+		if len(ch.buffer) < ch.capacity {
+			ch.buffer = append(ch.buffer, op.value)
+			return NULL, true, nil
+		}
+		return nil, false, nil
+	}
+
+	if len(ch.buffer) > 0 {
+		value = ch.buffer[0]
+		ch.buffer = ch.buffer[1:]
+		// 空いたところに、待っていた送り手の値を入れる
+		if s, ok := dequeue(&ch.sendq); ok {
+			ch.buffer = append(ch.buffer, s.w.ops[s.i].value)
+			g.complete(s.w, s.i, NULL, nil)
+		}
+		return value, true, nil
+	}
+	if s, ok := dequeue(&ch.sendq); ok {
+		g.complete(s.w, s.i, NULL, nil)
+		return s.w.ops[s.i].value, true, nil
+	}
+	if ch.closed {
+		return NULL, true, nil
+	}
+	return nil, false, nil
+}
+
+// 受け取りを待っている操作にはnullを返し、送るのを待っている操作はChannelErrorにする
+// g.muを持って呼ぶ
+func (g *TaskGroup) closeChannel(ch *Channel) *object.Error {
+	if ch.closed {
+		return object.NewError(object.CHANNEL_ERROR, "close of closed channel %s", ch.Inspect())
+	}
+	ch.closed = true
+
+	for r, ok := dequeue(&ch.recvq); ok; r, ok = dequeue(&ch.recvq) {
+		g.complete(r.w, r.i, NULL, nil)
+	}
+	for s, ok := dequeue(&ch.sendq); ok; s, ok = dequeue(&ch.sendq) {
+		g.complete(s.w, s.i, nil, object.NewError(object.CHANNEL_ERROR, "send on closed channel %s", ch.Inspect()))
+	}
+	return nil
+}
+
+// opsのどれか1つをする。すぐにできる操作がいくつもあれば、スケジューラの決めた順に試して最初のものを選ぶ
+// どれもできなければ、blockがtrueならできるまで待ち、falseなら-1を返す
+// 返すエラーには位置がないので、呼び出し元で埋める
+func (e *Evaluator) chanSelect(ops []chanOp, block bool) (int, object.Object, *object.Error) {
+	g := e.Tasks
+	for _, op := range ops {
+		if op.ch.group != g {
+			return 0, nil, object.NewError(object.VALUE_ERROR, "%s belongs to another task group", op.ch.Inspect())
+		}
+	}
+
+	g.mu.Lock()
+	t := e.current()
+	g.sched.yield(e)
+
+	for _, i := range g.sched.order(len(ops)) {
+		value, ok, err := g.try(ops[i])
+		if err != nil {
+			g.mu.Unlock()
+			return 0, nil, err
+		}
+		if ok {
+			g.mu.Unlock()
+			return i, value, nil
+		}
+	}
+
+	if !block {
+		g.mu.Unlock()
+		return -1, nil, nil
+	}
+
+	w := &waiter{task: t, ops: ops, wake: make(chan struct{})}
+	for i, op := range ops {
+		if op.send {
+			op.ch.sendq = append(op.ch.sendq, chanWait{w, i})
+		} else {
+			op.ch.recvq = append(op.ch.recvq, chanWait{w, i})
+		}
+	}
+	t.waiting = w
+	g.checkDeadlock()
+	g.sched.park(e, w)
+
+	if !w.done {
+		g.complete(w, -1, nil, e.interrupted(token.Token{}))
+	}
+	for _, op := range ops {
+		op.ch.sendq = removeWaiter(op.ch.sendq, w)
+		op.ch.recvq = removeWaiter(op.ch.recvq, w)
+	}
+	g.mu.Unlock()
+
+	if w.err != nil {
+		return 0, nil, w.err
+	}
+	return w.index, w.value, nil
+}
+
+// selectの各ケースのチャネルと送る値を書かれた順に評価してから、できるケースを1つ選んで実行する
+// どのケースもできなければdefaultを実行し、defaultがなければどれかができるまで待つ
+func (e *Evaluator) evalSelectExpression(se *ast.SelectExpression, env *object.Environment) object.Object {
+	ops := make([]chanOp, len(se.Cases))
+	for i, c := range se.Cases {
+		op, err := e.evalSelectCase(c, env)
+		if err != nil {
+			return err
+		}
+		ops[i] = op
+	}
+
+	i, value, err := e.chanSelect(ops, se.Default == nil)
+	if err != nil {
+		e.locateError(se.Token, err)
+		return err
+	}
+
+	var result object.Object
+	if i < 0 {
+		result = e.Eval(se.Default, env)
+	} else {
+		c := se.Cases[i]
+		caseEnv := env
+		// 受け取った値の名前はそのケースのブロックの中だけで見える
+		if c.Name != nil {
+			caseEnv = object.NewEnclosedEnvironment(env)
+			caseEnv.Set(c.Name.Value, value)
+		}
+		result = e.Eval(c.Body, caseEnv)
+	}
+
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+func (e *Evaluator) evalSelectCase(c *ast.SelectCase, env *object.Environment) (chanOp, object.Object) {
+	call, ok := c.Operation.(*ast.CallExpression)
+	var name string
+	if ok {
+		if ident, ok := call.Function.(*ast.Identifier); ok {
+			name = ident.Value
+		}
+	}
+	send := name == "send" && len(call.Arguments) == 2
+	if !send && !(name == "recv" && len(call.Arguments) == 1) {
+		return chanOp{}, e.newError(c.Token, object.TYPE_ERROR,
+			"select case must be recv(ch) or send(ch, value), got %s", c.Operation.String())
+	}
+
+	args := e.evalExpressions(call.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return chanOp{}, args[0]
+	}
+
+	ch, ok := args[0].(*Channel)
+	if !ok {
+		return chanOp{}, e.newError(call.Token, object.TYPE_ERROR,
+			"argument 1 to %s must be CHANNEL, got %s", name, args[0].Type())
+	}
+	op := chanOp{ch: ch, send: send}
+	if send {
+		op.value = args[1]
+	}
+	return op, nil
+}
+
+// チャネルを操作する組み込み関数。待つ間にタスクを止めるので、呼び出したEvaluatorを受け取る
+type taskBuiltin struct {
+	fn func(e *Evaluator, args []object.Object) object.Object
+}
+
+func (b *taskBuiltin) Type() object.ObjectType { return object.BUILTIN_OBJ }
+func (b *taskBuiltin) Inspect() string         { return "builtin function" }
+
+// 環境で見つからなかった識別子は、RegisterBuiltinで登録したものより先にここから探す
+var taskBuiltins = map[string]*taskBuiltin{
+	"chan":  {fn: builtinChan},
+	"send":  {fn: builtinSend},
+	"recv":  {fn: builtinRecv},
+	"close": {fn: builtinClose},
+}
+
+func builtinChan(e *Evaluator, args []object.Object) object.Object {
+	if err := object.CheckOptionalArgTypes("chan", args, 0, object.INTEGER_OBJ); err != nil {
+		return err
+	}
+
+	var capacity int64
+	if len(args) == 1 {
+		capacity = args[0].(*object.Integer).Value
+	}
+	if capacity < 0 {
+		return object.NewError(object.VALUE_ERROR, "chan: negative capacity: %d", capacity)
+	}
+
+	e.Tasks.mu.Lock()
+	defer e.Tasks.mu.Unlock()
+	return e.Tasks.newChannel(int(capacity))
+}
+
+// 受け取られるか、容量に空きができるまで待つ
+func builtinSend(e *Evaluator, args []object.Object) object.Object {
+	if err := object.CheckArgTypes("send", args, object.CHANNEL_OBJ, object.ANY_OBJ); err != nil {
+		return err
+	}
+
+	_, _, err := e.chanSelect([]chanOp{{ch: args[0].(*Channel), send: true, value: args[1]}}, true)
+	if err != nil {
+		return err
+	}
+	return NULL
+}
+
+// 値が届くまで待つ。閉じたチャネルで、残っている値もなければnull
+func builtinRecv(e *Evaluator, args []object.Object) object.Object {
+	if err := object.CheckArgTypes("recv", args, object.CHANNEL_OBJ); err != nil {
+		return err
+	}
+
+	_, value, err := e.chanSelect([]chanOp{{ch: args[0].(*Channel)}}, true)
+	if err != nil {
+		return err
+	}
+	return value
+}
+
+func builtinClose(e *Evaluator, args []object.Object) object.Object {
+	if err := object.CheckArgTypes("close", args, object.CHANNEL_OBJ); err != nil {
+		return err
+	}
+
+	ch := args[0].(*Channel)
+	if ch.group != e.Tasks {
+		return object.NewError(object.VALUE_ERROR, "%s belongs to another task group", ch.Inspect())
+	}
+
+	e.Tasks.mu.Lock()
+	defer e.Tasks.mu.Unlock()
+	if err := e.Tasks.closeChannel(ch); err != nil {
+		return err
+	}
+	return NULL
+}
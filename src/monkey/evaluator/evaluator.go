@@ -0,0 +1,845 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+	"time"
+)
+
+// true/false/nullは毎回作らずに使い回す
+var (
+	NULL  = &object.Null{}
+	TRUE  = &object.Boolean{Value: true}
+	FALSE = &object.Boolean{Value: false}
+)
+
+// 1回の評価の状態を持つ
+// stackには評価中の関数呼び出しが外側から順に積まれる
+type Evaluator struct {
+	stack   []object.Frame
+	loading []string // 評価中のモジュールのパス。循環したimportを見つけるのに使う
+
+	// import文でモジュールを読み込む。NewWithLimitsは空のキャッシュを持つローダーを入れる
+	Modules *ModuleLoader
+
+	// spawnで起動したタスクとチャネル(tasks.go)。NewWithLimitsは空のグループを入れる
+	Tasks *TaskGroup
+	task  *task // このEvaluatorで評価しているタスク。メインはspawnかチャネルを使うまでnil
+
+	// 実行の制限(limits.go)
+	ctx    context.Context
+	limits Limits
+	usage  *usage
+	grace  *grace // 制限を超えたエラーをcatchしたハンドラを評価している間だけnilでない
+}
+
+// 呼び出しの深さ以外は制限しないEvaluatorを作る
+func New() *Evaluator {
+	return NewWithLimits(context.Background(), Limits{})
+}
+
+// ctxがキャンセルされるか、limitsのどれかを超えたら評価を打ち切るEvaluatorを作る
+func NewWithLimits(ctx context.Context, limits Limits) *Evaluator {
+	return &Evaluator{
+		ctx:     ctx,
+		limits:  limits,
+		usage:   &usage{},
+		Modules: NewModuleLoader(),
+		Tasks:   NewTaskGroup(),
+	}
+}
+
+// 新しいEvaluatorでnodeを評価し、spawnしたタスクが終わるまで待つ
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	e := New()
+	return e.Wait(e.Eval(node, env))
+}
+
+// ノードを1つ評価するたびに1ステップと数え、制限を超えていないか確かめる
+func (e *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
+	if err := e.step(node); err != nil {
+		return err
+	}
+
+	result := e.eval(node, env)
+
+	if allocates(node) && result != nil && !isError(result) {
+		if err := e.charge(node, sizeOf(result)); err != nil {
+			return err
+		}
+	}
+
+	return result
+}
+
+func (e *Evaluator) eval(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+
+	// 文
+	case *ast.Program:
+		return e.evalProgram(node, env)
+
+	case *ast.ExpressionStatement:
+		return e.Eval(node.Expression, env)
+
+	case *ast.BlockStatement:
+		return e.evalBlockStatement(node, env)
+
+	case *ast.ReturnStatement:
+		val := e.Eval(node.ReturnValue, env)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+
+	case *ast.ThrowStatement:
+		return e.evalThrowStatement(node, env)
+
+	case *ast.LetStatement:
+		val := e.Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		env.Set(node.Name.Value, val)
+
+	case *ast.ImportStatement:
+		return e.evalImportStatement(node, env)
+
+	case *ast.ExportStatement:
+		return e.Eval(node.Statement, env)
+
+	// 式
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
+
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+
+	case *ast.PrefixExpression:
+		right := e.Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return e.evalPrefixExpression(node.Token, node.Operator, right)
+
+	case *ast.InfixExpression:
+		left := e.Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		right := e.Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return e.evalInfixExpression(node.Token, node.Operator, left, right)
+
+	case *ast.IfExpression:
+		return e.evalIfExpression(node, env)
+
+	case *ast.TryExpression:
+		return e.evalTryExpression(node, env)
+
+	case *ast.SpawnExpression:
+		return e.evalSpawnExpression(node, env)
+
+	case *ast.SelectExpression:
+		return e.evalSelectExpression(node, env)
+
+	case *ast.Identifier:
+		return e.evalIdentifier(node, env)
+
+	case *ast.IndexExpression:
+		left := e.Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := e.Eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return e.evalIndexExpression(node.Token, left, index)
+
+	case *ast.MemberExpression:
+		return e.evalMemberExpression(node, env)
+
+	case *ast.ArrayLiteral:
+		elements := e.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+
+	case *ast.HashLiteral:
+		return e.evalHashLiteral(node, env)
+
+	case *ast.FunctionLiteral:
+		return &object.Function{
+			Parameters: node.Parameters,
+			Body:       node.Body,
+			Env:        env,
+			Name:       node.Name,
+		}
+
+	case *ast.CallExpression:
+		function := e.Eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		args := e.evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		return e.applyFunction(node.Token, function, args)
+	}
+
+	return nil
+}
+
+func (e *Evaluator) evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range program.Statements {
+		result = e.Eval(statement, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		}
+	}
+
+	return result
+}
+
+// ReturnValueはアンラップせずに返して、外側のブロックでも評価を打ち切らせる
+func (e *Evaluator) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range block.Statements {
+		result = e.Eval(statement, env)
+
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+
+	return result
+}
+
+func (e *Evaluator) evalPrefixExpression(tok token.Token, operator string, right object.Object) object.Object {
+	switch operator {
+	case "!":
+		return evalBangOperatorExpression(right)
+	case "-":
+		switch right := right.(type) {
+		case *object.Integer:
+			return &object.Integer{Value: -right.Value}
+		case *object.Float:
+			return &object.Float{Value: -right.Value}
+		case *object.Duration:
+			return &object.Duration{Value: -right.Value}
+		default:
+			return e.newError(tok, object.TYPE_ERROR, "unknown operator: -%s", right.Type())
+		}
+	default:
+		return e.newError(tok, object.TYPE_ERROR, "unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+func evalBangOperatorExpression(right object.Object) object.Object {
+	switch right {
+	case TRUE:
+		return FALSE
+	case FALSE:
+		return TRUE
+	case NULL:
+		return TRUE
+	default:
+		return FALSE
+	}
+}
+
+func (e *Evaluator) evalInfixExpression(
+	tok token.Token,
+	operator string,
+	left, right object.Object,
+) object.Object {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return e.evalIntegerInfixExpression(tok, operator, left, right)
+	// 片方だけが浮動小数点数なら、整数を浮動小数点数にしてから計算する
+	case isNumber(left) && isNumber(right):
+		return e.evalFloatInfixExpression(tok, operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return e.evalStringInfixExpression(tok, operator, left, right)
+	case isTimeOrDuration(left) || isTimeOrDuration(right):
+		return e.evalTimeInfixExpression(tok, operator, left, right)
+	// 真偽値とnullは使い回しているのでポインタの比較で済む
+	case operator == "==":
+		return nativeBoolToBooleanObject(left == right)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(left != right)
+	case left.Type() != right.Type():
+		return e.newError(tok, object.TYPE_ERROR, "type mismatch: %s %s %s",
+			left.Type(), operator, right.Type())
+	default:
+		return e.newError(tok, object.TYPE_ERROR, "unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+func (e *Evaluator) evalIntegerInfixExpression(
+	tok token.Token,
+	operator string,
+	left, right object.Object,
+) object.Object {
+	leftVal := left.(*object.Integer).Value
+	rightVal := right.(*object.Integer).Value
+
+	switch operator {
+	case "+":
+		return &object.Integer{Value: leftVal + rightVal}
+	case "-":
+		return &object.Integer{Value: leftVal - rightVal}
+	case "*":
+		return &object.Integer{Value: leftVal * rightVal}
+	case "/":
+		// Goのpanicにしないようにゼロ除算はここで弾く
+		if rightVal == 0 {
+			return e.newError(tok, object.ZERO_DIVISION_ERROR, "division by zero: %d / %d", leftVal, rightVal)
+		}
+		return &object.Integer{Value: leftVal / rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return e.newError(tok, object.TYPE_ERROR, "unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+func (e *Evaluator) evalFloatInfixExpression(
+	tok token.Token,
+	operator string,
+	left, right object.Object,
+) object.Object {
+	leftVal, _ := toFloat(left)
+	rightVal, _ := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		// 整数と同じく、Infにせずエラーにする
+		if rightVal == 0 {
+			return e.newError(tok, object.ZERO_DIVISION_ERROR, "division by zero: %s / %s",
+				left.Inspect(), right.Inspect())
+		}
+		return &object.Float{Value: leftVal / rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return e.newError(tok, object.TYPE_ERROR, "unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	_, ok := toFloat(obj)
+	return ok
+}
+
+// INTEGERかFLOATならfloat64にして返す
+func toFloat(obj object.Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value), true
+	case *object.Float:
+		return obj.Value, true
+	default:
+		return 0, false
+	}
+}
+
+func (e *Evaluator) evalStringInfixExpression(
+	tok token.Token,
+	operator string,
+	left, right object.Object,
+) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return e.newError(tok, object.TYPE_ERROR, "unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+func isTimeOrDuration(obj object.Object) bool {
+	return obj.Type() == object.TIME_OBJ || obj.Type() == object.DURATION_OBJ
+}
+
+// 時刻と時間の長さの演算
+//
+//	TIME - TIME -> DURATION  TIME + DURATION, TIME - DURATION -> TIME
+//	DURATION + DURATION, DURATION - DURATION, DURATION * INTEGER, DURATION / INTEGER -> DURATION
+//	DURATION / DURATION -> INTEGER(何個分か、端数は切り捨て)
+//
+// 同じ型どうしなら比較もできる。時刻はタイムゾーンが違っても同じ瞬間なら等しい
+func (e *Evaluator) evalTimeInfixExpression(
+	tok token.Token,
+	operator string,
+	left, right object.Object,
+) object.Object {
+	switch l := left.(type) {
+	case *object.Time:
+		switch r := right.(type) {
+		case *object.Time:
+			switch operator {
+			case "-":
+				return &object.Duration{Value: l.Value.Sub(r.Value)}
+			case "<":
+				return nativeBoolToBooleanObject(l.Value.Before(r.Value))
+			case ">":
+				return nativeBoolToBooleanObject(l.Value.After(r.Value))
+			case "==":
+				return nativeBoolToBooleanObject(l.Value.Equal(r.Value))
+			case "!=":
+				return nativeBoolToBooleanObject(!l.Value.Equal(r.Value))
+			}
+		case *object.Duration:
+			switch operator {
+			case "+":
+				return &object.Time{Value: l.Value.Add(r.Value)}
+			case "-":
+				return &object.Time{Value: l.Value.Add(-r.Value)}
+			}
+		}
+	case *object.Duration:
+		switch r := right.(type) {
+		case *object.Duration:
+			switch operator {
+			case "+":
+				return &object.Duration{Value: l.Value + r.Value}
+			case "-":
+				return &object.Duration{Value: l.Value - r.Value}
+			case "/":
+				if r.Value == 0 {
+					return e.newError(tok, object.ZERO_DIVISION_ERROR, "division by zero: %s / %s",
+						left.Inspect(), right.Inspect())
+				}
+				return &object.Integer{Value: int64(l.Value / r.Value)}
+			case "<":
+				return nativeBoolToBooleanObject(l.Value < r.Value)
+			case ">":
+				return nativeBoolToBooleanObject(l.Value > r.Value)
+			case "==":
+				return nativeBoolToBooleanObject(l.Value == r.Value)
+			case "!=":
+				return nativeBoolToBooleanObject(l.Value != r.Value)
+			}
+		case *object.Time:
+			if operator == "+" {
+				return &object.Time{Value: r.Value.Add(l.Value)}
+			}
+		case *object.Integer:
+			switch operator {
+			case "*":
+				return &object.Duration{Value: l.Value * time.Duration(r.Value)}
+			case "/":
+				if r.Value == 0 {
+					return e.newError(tok, object.ZERO_DIVISION_ERROR, "division by zero: %s / %d",
+						left.Inspect(), r.Value)
+				}
+				return &object.Duration{Value: l.Value / time.Duration(r.Value)}
+			}
+		}
+	case *object.Integer:
+		if r, ok := right.(*object.Duration); ok && operator == "*" {
+			return &object.Duration{Value: time.Duration(l.Value) * r.Value}
+		}
+	}
+
+	switch {
+	case operator == "==":
+		return nativeBoolToBooleanObject(left == right)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(left != right)
+	case left.Type() != right.Type():
+		return e.newError(tok, object.TYPE_ERROR, "type mismatch: %s %s %s",
+			left.Type(), operator, right.Type())
+	default:
+		return e.newError(tok, object.TYPE_ERROR, "unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+func (e *Evaluator) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := e.Eval(ie.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return e.Eval(ie.Consequence, env)
+	} else if ie.Alternative != nil {
+		return e.Eval(ie.Alternative, env)
+	} else {
+		return NULL
+	}
+}
+
+// throwされた値をエラーに包んで評価を打ち切る
+// catchで受け取ったエラーをもう一度throwした場合は、元の位置とスタックをそのまま使う
+func (e *Evaluator) evalThrowStatement(ts *ast.ThrowStatement, env *object.Environment) object.Object {
+	val := e.Eval(ts.Value, env)
+	if isError(val) {
+		return val
+	}
+
+	switch val := val.(type) {
+	case *object.Exception:
+		return val.Error
+	case *object.String:
+		err := e.newError(ts.Token, object.THROWN_ERROR, "%s", val.Value)
+		err.Value = val
+		return err
+	default:
+		err := e.newError(ts.Token, object.THROWN_ERROR, "%s", val.Inspect())
+		err.Value = val
+		return err
+	}
+}
+
+// tryブロックでエラーが起きたらcatchブロックを評価し、最後に必ずfinallyブロックを評価する
+// finallyブロックの中でreturnやthrowをした場合は、try/catchの結果よりもそちらを優先する
+// (returnはErrorではないのでcatchされず、finallyを評価したあとでそのまま外に伝わる)
+func (e *Evaluator) evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := e.Eval(te.Block, env)
+
+	errObj, ok := result.(*object.Error)
+	if ok && isLimitError(errObj) && e.grace == nil {
+		// 制限はもう超えているので、ハンドラは猶予の中で評価する(limits.go)
+		e.grace = &grace{cause: errObj, steps: graceSteps, alloc: graceAlloc}
+		defer func() { e.grace = nil }()
+	}
+
+	if ok && te.Catch != nil {
+		// catchの引数はcatchブロックの中だけで見える
+		catchEnv := object.NewEnclosedEnvironment(env)
+		catchEnv.Set(te.CatchParam.Value, &object.Exception{Error: errObj})
+		result = e.Eval(te.Catch, catchEnv)
+	}
+
+	if te.Finally != nil {
+		finally := e.Eval(te.Finally, env)
+		if finally != nil {
+			ft := finally.Type()
+			if ft == object.RETURN_VALUE_OBJ || ft == object.ERROR_OBJ {
+				return finally
+			}
+		}
+	}
+
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+func (e *Evaluator) evalIndexExpression(tok token.Token, left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return e.evalHashIndexExpression(tok, left, index)
+	case left.Type() == object.EXCEPTION_OBJ && index.Type() == object.STRING_OBJ:
+		return e.evalExceptionIndexExpression(tok, left, index)
+	default:
+		return e.newError(tok, object.TYPE_ERROR, "index operator not supported: %s", left.Type())
+	}
+}
+
+// 範囲外の添字はnullを返す
+func evalArrayIndexExpression(array, index object.Object) object.Object {
+	arrayObject := array.(*object.Array)
+	idx := index.(*object.Integer).Value
+	max := int64(len(arrayObject.Elements) - 1)
+
+	if idx < 0 || idx > max {
+		return NULL
+	}
+
+	return arrayObject.Elements[idx]
+}
+
+// キーがなければnullを返す
+func (e *Evaluator) evalHashIndexExpression(tok token.Token, hash, index object.Object) object.Object {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return e.newError(tok, object.TYPE_ERROR, "unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hash.(*object.Hash).Pairs[key.HashKey()]
+	if !ok {
+		return NULL
+	}
+	return pair.Value
+}
+
+// キーと値を書かれた順に評価する。同じキーが2回あれば後のほうが残る
+func (e *Evaluator) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for _, pair := range node.Pairs {
+		key := e.Eval(pair.Key, env)
+		if isError(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return e.newError(pair.Token, object.TYPE_ERROR, "unusable as hash key: %s", key.Type())
+		}
+
+		value := e.Eval(pair.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
+func (e *Evaluator) evalExceptionIndexExpression(tok token.Token, exception, index object.Object) object.Object {
+	key := index.(*object.String).Value
+
+	val, ok := exception.(*object.Exception).Field(key)
+	if !ok {
+		return e.newError(tok, object.INDEX_ERROR, "unknown exception field: %q", key)
+	}
+	if val == nil {
+		return NULL
+	}
+	return val
+}
+
+// 環境で見つからなければ組み込み関数を探す
+func (e *Evaluator) evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+
+	if builtin, ok := taskBuiltins[node.Value]; ok {
+		return builtin
+	}
+
+	if builtin, ok := LookupBuiltin(node.Value); ok {
+		return builtin
+	}
+
+	return e.newError(node.Token, object.NAME_ERROR, "identifier not found: %s", node.Value)
+}
+
+// 引数は左から順に評価する。エラーになったらそのエラーだけを返す
+func (e *Evaluator) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, exp := range exps {
+		evaluated := e.Eval(exp, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+// Go側から関数の値を呼び出す。呼び出し式がないのでエラーの位置は関数の中のものだけになる
+func (e *Evaluator) Apply(fn object.Object, args ...object.Object) object.Object {
+	return e.applyFunction(token.Token{}, fn, args)
+}
+
+// tokは呼び出し式の'('トークン
+func (e *Evaluator) applyFunction(tok token.Token, fn object.Object, args []object.Object) object.Object {
+	switch fn := fn.(type) {
+	case *object.Function:
+		return e.applyMonkeyFunction(tok, fn, args)
+	case *object.Builtin:
+		var result object.Object
+		if fn.HigherOrderFn != nil {
+			// コールバックも同じ呼び出し式から呼んだものとして扱う
+			result = fn.HigherOrderFn(func(callback object.Object, args ...object.Object) object.Object {
+				return e.applyFunction(tok, callback, args)
+			}, args...)
+		} else {
+			result = fn.Fn(args...)
+		}
+		return e.builtinResult(tok, result)
+	case *taskBuiltin:
+		return e.builtinResult(tok, fn.fn(e, args))
+	default:
+		return e.newError(tok, object.TYPE_ERROR, "not a function: %s", fn.Type())
+	}
+}
+
+// 組み込み関数が返したエラーに位置を埋め、作った値の大きさを数える
+func (e *Evaluator) builtinResult(tok token.Token, result object.Object) object.Object {
+	if errObj, ok := result.(*object.Error); ok {
+		e.locateError(tok, errObj)
+		return errObj
+	}
+	if err := e.chargeToken(tok, sizeOf(result)); err != nil {
+		return err
+	}
+	return result
+}
+
+func (e *Evaluator) applyMonkeyFunction(tok token.Token, function *object.Function, args []object.Object) object.Object {
+	if len(args) != len(function.Parameters) {
+		return e.newError(tok, object.ARGUMENT_ERROR, "wrong number of arguments to %s: want=%d, got=%d",
+			functionName(function), len(function.Parameters), len(args))
+	}
+
+	if err := e.checkDepth(tok, function); err != nil {
+		return err
+	}
+	if err := e.chargeToken(tok, envSize(len(args))); err != nil {
+		return err
+	}
+
+	e.pushFrame(tok, functionName(function))
+	defer e.popFrame()
+
+	extendedEnv := extendFunctionEnv(function, args)
+	evaluated := e.Eval(function.Body, extendedEnv)
+	return unwrapReturnValue(evaluated)
+}
+
+func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+	env := object.NewEnclosedEnvironment(fn.Env)
+
+	for paramIdx, param := range fn.Parameters {
+		env.Set(param.Value, args[paramIdx])
+	}
+
+	return env
+}
+
+// 関数の外までreturnが伝わらないようにここでアンラップする
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+
+	return obj
+}
+
+func functionName(fn *object.Function) string {
+	if fn.Name == "" {
+		return "<anonymous>"
+	}
+	return fn.Name
+}
+
+func (e *Evaluator) pushFrame(tok token.Token, name string) {
+	e.stack = append(e.stack, object.Frame{Function: name, Line: tok.Line, Column: tok.Column})
+}
+
+func (e *Evaluator) popFrame() {
+	e.stack = e.stack[:len(e.stack)-1]
+}
+
+// エラーが起きた位置と、その時点の呼び出しスタックを持ったエラーを作る
+func (e *Evaluator) newError(tok token.Token, kind string, format string, a ...interface{}) *object.Error {
+	return &object.Error{
+		Kind:    kind,
+		Message: fmt.Sprintf(format, a...),
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Stack:   e.copyStack(),
+	}
+}
+
+// エラーに持たせるスタックはあとでpush/popされても変わらないようにコピーする
+func (e *Evaluator) copyStack() []object.Frame {
+	stack := make([]object.Frame, len(e.stack))
+	copy(stack, e.stack)
+	return stack
+}
+
+// 組み込み関数が返したエラーには位置がないので、呼び出し式の位置とスタックを埋める
+func (e *Evaluator) locateError(tok token.Token, err *object.Error) {
+	if err.Line != 0 {
+		return
+	}
+
+	err.Line = tok.Line
+	err.Column = tok.Column
+	err.Stack = e.copyStack()
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL:
+		return false
+	case TRUE:
+		return true
+	case FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+func isError(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ
+	}
+	return false
+}
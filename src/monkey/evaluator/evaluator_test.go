@@ -0,0 +1,1737 @@
+package evaluator
+
+import (
+	"context"
+	"io/ioutil"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1.5", 1.5},
+		{"-0.5", -0.5},
+		{"1.5 + 1", 2.5},
+		{"1 + 1.5", 2.5},
+		{"3.0 * 2", 6.0},
+		{"1 / 4.0", 0.25},
+		{"1 / 4", 0},
+		{"0.1 + 0.2 > 0.3", true},
+		{"1 == 1.0", true},
+		{"2.5 < 2", false},
+		{"str(2.0)", "2.0"},
+		{"str(1.5 * 2)", "3.0"},
+		{"type(1.0)", "FLOAT"},
+		{"int(-2.7)", -2},
+		{`float("2.5") + float(1)`, 3.5},
+		{"1.0 / 0", "ZeroDivisionError: division by zero: 1.0 / 0"},
+		{`1.5 + "a"`, "TypeError: type mismatch: FLOAT + STRING"},
+		{`float("x")`, "ValueError: could not parse \"x\" as float"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"true == true", true},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"(1 > 2) == true", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBangOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!5", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{`
+if (10 > 1) {
+  if (10 > 1) {
+    return 10;
+  }
+
+  return 1;
+}
+`, 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN", 1, 3},
+		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN", 1, 3},
+		{"-true", "unknown operator: -BOOLEAN", 1, 1},
+		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN", 1, 6},
+		{"5;\ntrue + false; 5", "unknown operator: BOOLEAN + BOOLEAN", 2, 6},
+		{"if (10 > 1) { true + false; }", "unknown operator: BOOLEAN + BOOLEAN", 1, 20},
+		{"foobar", "identifier not found: foobar", 1, 1},
+		{"let x = 5; x(1)", "not a function: INTEGER", 1, 13},
+		{"10 / (5 - 5)", "division by zero: 10 / 0", 1, 4},
+		{"let f = fn(x) { x }; f()", "wrong number of arguments to f: want=1, got=0", 1, 23},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+
+		if errObj.Line != tt.expectedLine || errObj.Column != tt.expectedColumn {
+			t.Errorf("wrong error position for %q. expected=%d:%d, got=%d:%d",
+				tt.input, tt.expectedLine, tt.expectedColumn, errObj.Line, errObj.Column)
+		}
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	input := `let inner = fn(x) { x + true };
+let outer = fn() {
+  inner(1)
+};
+outer();`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	expected := []object.Frame{
+		{Function: "outer", Line: 5, Column: 6},
+		{Function: "inner", Line: 3, Column: 8},
+	}
+
+	if len(errObj.Stack) != len(expected) {
+		t.Fatalf("wrong stack depth. want=%d, got=%d (%+v)",
+			len(expected), len(errObj.Stack), errObj.Stack)
+	}
+
+	for i, frame := range expected {
+		if errObj.Stack[i] != frame {
+			t.Errorf("stack[%d] wrong. want=%+v, got=%+v", i, frame, errObj.Stack[i])
+		}
+	}
+
+	traceback := `Traceback (most recent call last):
+  line 5, column 6, in outer
+  line 3, column 8, in inner
+TypeError at line 1, column 23: type mismatch: INTEGER + BOOLEAN`
+	if errObj.Traceback() != traceback {
+		t.Errorf("wrong traceback.\nwant=%s\ngot=%s", traceback, errObj.Traceback())
+	}
+}
+
+func TestStringLiteral(t *testing.T) {
+	input := `"Hello" + " " + "World!"`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestTryCatchFinally(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { 1 + true } catch (e) { 2 }`, 2},
+		{`try { throw "boom"; 1 } catch (e) { e["message"] }`, "boom"},
+		{`try { throw 5 } catch (e) { e["value"] + 1 }`, 6},
+		{`try { throw 5 } catch (e) { e["kind"] }`, "Error"},
+		{`try { 1 + true } catch (e) { e["kind"] }`, "TypeError"},
+		{`try { foo } catch (e) { e["kind"] }`, "NameError"},
+		{`try { 1 / 0 } catch (e) { e["kind"] }`, "ZeroDivisionError"},
+		{`try { 1 + true } catch (e) { e["value"] }`, nil},
+		{`try { 1 + true } catch (e) { e["line"] }`, 1},
+		{`let x = 1; try { let x = 2; } finally { let x = 3; }; x`, 3},
+		{`let r = try { 10 } finally { 20 }; r`, 10},
+		{`let f = fn() { try { return 1; } finally { 2 } }; f()`, 1},
+		{`let f = fn() { try { return 1; } finally { return 2; } }; f()`, 2},
+		{`let f = fn() { try { throw "a"; } catch (e) { return 1; } finally { return 2; } }; f()`, 2},
+		{`let f = fn() { try { throw "a"; } finally { return 2; } }; f()`, 2},
+		{`try { try { throw "inner" } finally { 1 } } catch (e) { e["message"] }`, "inner"},
+		{`try { try { throw "a" } catch (e) { throw e } } catch (e) { e["message"] }`, "a"},
+		{`try { try { throw "a" } catch (e) { throw "b" } } catch (e) { e["message"] }`, "b"},
+		{`let e = 1; try { throw 2 } catch (e) { e }; e`, 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. got=%q, want=%q", str.Value, expected)
+			}
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestUncaughtThrow(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedKind    string
+		expectedMessage string
+	}{
+		{`throw "boom"`, object.THROWN_ERROR, "boom"},
+		{`try { throw "a" } finally { 1 }`, object.THROWN_ERROR, "a"},
+		{`try { 1 } finally { throw "b" }`, object.THROWN_ERROR, "b"},
+		{`try { 1 } catch (e) { 2 } finally { 1 + true }`, object.TYPE_ERROR, "type mismatch: INTEGER + BOOLEAN"},
+		{`try { throw "a" } catch (e) { e["nope"] }`, object.INDEX_ERROR, `unknown exception field: "nope"`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Kind != tt.expectedKind || errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error. expected=%s(%q), got=%s(%q)",
+				tt.expectedKind, tt.expectedMessage, errObj.Kind, errObj.Message)
+		}
+	}
+}
+
+func TestRethrowKeepsStack(t *testing.T) {
+	input := `let fail = fn() { throw "deep" };
+let f = fn() {
+  try { fail() } catch (e) { throw e }
+};
+f();`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	if len(errObj.Stack) != 2 || errObj.Stack[1].Function != "fail" {
+		t.Errorf("rethrown error lost its stack. got=%+v", errObj.Stack)
+	}
+
+	if errObj.Line != 1 || errObj.Column != 19 {
+		t.Errorf("rethrown error lost its position. got=%d:%d", errObj.Line, errObj.Column)
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len([1, 2, 3])`, 3},
+		{`len(1)`, "argument to len not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments to len: want=1, got=2"},
+		{`type(1)`, "INTEGER"},
+		{`type("a")`, "STRING"},
+		{`type(len)`, "BUILTIN"},
+		{`str(10) + "!"`, "10!"},
+		{`str([1, true])`, "[1, true]"},
+		{`int("42")`, 42},
+		{`int(true)`, 1},
+		{`int(7)`, 7},
+		{`int("x")`, `could not parse "x" as integer`},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first(1)`, "argument 1 to first must be ARRAY, got INTEGER"},
+		{`rest([1, 2, 3])`, []int64{2, 3}},
+		{`rest([])`, nil},
+		{`push([], 1)`, []int64{1}},
+		{`push(1, 1)`, "argument 1 to push must be ARRAY, got INTEGER"},
+		{`let len = fn(x) { 99 }; len("a")`, 99},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q",
+						expected, obj.Message)
+				}
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("String has wrong value. expected=%q, got=%q",
+						expected, obj.Value)
+				}
+			default:
+				t.Errorf("object is not Error or String. got=%T (%+v)", evaluated, evaluated)
+			}
+		case []int64:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d",
+					len(expected), len(array.Elements))
+				continue
+			}
+
+			for i, expectedElem := range expected {
+				testIntegerObject(t, array.Elements[i], expectedElem)
+			}
+		}
+	}
+}
+
+func TestBuiltinErrorPosition(t *testing.T) {
+	input := `let f = fn() {
+  len(1)
+};
+f()`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	if errObj.Kind != object.TYPE_ERROR {
+		t.Errorf("wrong error kind. got=%q", errObj.Kind)
+	}
+
+	if errObj.Line != 2 || errObj.Column != 6 {
+		t.Errorf("wrong error position. got=%d:%d", errObj.Line, errObj.Column)
+	}
+
+	if len(errObj.Stack) != 1 || errObj.Stack[0].Function != "f" {
+		t.Errorf("wrong stack. got=%+v", errObj.Stack)
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	RegisterBuiltin("double", func(args ...object.Object) object.Object {
+		if err := object.CheckArgTypes("double", args, object.INTEGER_OBJ); err != nil {
+			return err
+		}
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	})
+
+	testIntegerObject(t, testEval(`double(21)`), 42)
+
+	evaluated := testEval(`try { double("x") } catch (e) { e["kind"] + ": " + e["message"] }`)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := "TypeError: argument 1 to double must be INTEGER, got STRING"
+	if str.Value != expected {
+		t.Errorf("wrong message. expected=%q, got=%q", expected, str.Value)
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d",
+			len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                             5,
+		FALSE.HashKey():                            6,
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{"a": 1, "a": 2}["a"]`, 2},
+		{`{"foo": {"bar": 7}}.foo.bar`, 7},
+		{`{"foo": 5}.bar`, nil},
+		{`len({"a": 1, "b": 2})`, 2},
+		{`str({"b": [1, 2], "a": true, 1: "x"})`, `{1: x, a: true, b: [1, 2]}`},
+		{`{"foo": 5}[fn(x) { x }]`, "TypeError: unusable as hash key: FUNCTION"},
+		{`{[1]: 5}`, "TypeError: unusable as hash key: ARRAY"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	fib := `let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };`
+
+	tests := []struct {
+		input        string
+		limits       Limits
+		expectedKind string
+	}{
+		{`let f = fn() { f() }; f()`, Limits{}, object.RECURSION_ERROR},
+		{`let f = fn() { f() }; f()`, Limits{MaxDepth: 10}, object.RECURSION_ERROR},
+		{fib + `fib(30)`, Limits{MaxSteps: 1000}, object.STEP_LIMIT_ERROR},
+		{fib + `fib(30)`, Limits{MaxAlloc: 4096}, object.MEMORY_LIMIT_ERROR},
+		{`let grow = fn(s) { grow(s + s) }; grow("ab")`, Limits{MaxAlloc: 1 << 20}, object.MEMORY_LIMIT_ERROR},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWithLimits(context.Background(), tt.input, tt.limits)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Kind != tt.expectedKind {
+			t.Errorf("wrong error kind for %q. expected=%s, got=%s (%s)",
+				tt.input, tt.expectedKind, errObj.Kind, errObj.Message)
+		}
+	}
+}
+
+func TestLimitsNotExceeded(t *testing.T) {
+	input := `let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10)`
+
+	evaluated := testEvalWithLimits(context.Background(), input,
+		Limits{MaxSteps: 100000, MaxDepth: 20, MaxAlloc: 1 << 20})
+	testIntegerObject(t, evaluated, 55)
+}
+
+func TestLimitErrorsAreCatchable(t *testing.T) {
+	recurse := `let f = fn(n) { f(n + 1) };
+try { f(0) } catch (e) { e["kind"] }`
+	grow := `let g = fn(s) { g(s + s) };
+try { g("ab") } catch (e) { e["kind"] }`
+	fib := `let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+try { fib(50) } catch (e) { e["kind"] }`
+
+	background := func() (context.Context, context.CancelFunc) {
+		return context.WithCancel(context.Background())
+	}
+	timeout := func() (context.Context, context.CancelFunc) {
+		return context.WithTimeout(context.Background(), 20*time.Millisecond)
+	}
+	cancelLater := func() (context.Context, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		return ctx, cancel
+	}
+
+	tests := []struct {
+		input    string
+		ctx      func() (context.Context, context.CancelFunc)
+		limits   Limits
+		expected string
+	}{
+		{recurse, background, Limits{MaxDepth: 50}, object.RECURSION_ERROR},
+		{recurse, background, Limits{MaxSteps: 200}, object.STEP_LIMIT_ERROR},
+		{grow, background, Limits{MaxAlloc: 1 << 16}, object.MEMORY_LIMIT_ERROR},
+		{fib, timeout, Limits{}, object.TIMEOUT_ERROR},
+		{fib, cancelLater, Limits{}, object.CANCELLED_ERROR},
+	}
+
+	for _, tt := range tests {
+		ctx, cancel := tt.ctx()
+		evaluated := testEvalWithLimits(ctx, tt.input, tt.limits)
+		cancel()
+		testObject(t, tt.input, evaluated, tt.expected)
+	}
+}
+
+func TestLimitErrorHandlerGrace(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// finallyも猶予の中で評価し、元のエラーはそのまま伝わる
+		{`let f = fn(n) { f(n + 1) }; let log = [];
+try { f(0) } finally { let log = push(log, 1); }`,
+			"StepLimitError: step limit exceeded: 200"},
+		// ハンドラが猶予を使い切ると同じ種類のエラーになる
+		{`let f = fn(n) { f(n + 1) }; try { f(0) } catch (e) { f(0) }`,
+			"StepLimitError: step limit exceeded: 200 (in error handler)"},
+		// ハンドラの中のtryでは猶予を延ばせない
+		{`let f = fn(n) { f(n + 1) }; try { f(0) } catch (e) { try { f(0) } catch (e2) { f(0) } }`,
+			"StepLimitError: step limit exceeded: 200 (in error handler)"},
+		// try式を抜けたら、また制限のエラーになる
+		{`let f = fn(n) { f(n + 1) }; let k = try { f(0) } catch (e) { e["kind"] }; k`,
+			"StepLimitError: step limit exceeded: 200"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWithLimits(context.Background(), tt.input, Limits{MaxSteps: 200})
+		testObject(t, tt.input, evaluated, tt.expected)
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	input := `let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(50)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	evaluated := testEvalWithLimits(ctx, input, Limits{})
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Kind != object.TIMEOUT_ERROR {
+		t.Errorf("wrong error kind. expected=%s, got=%s", object.TIMEOUT_ERROR, errObj.Kind)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	evaluated = testEvalWithLimits(ctx, input, Limits{})
+	errObj, ok = evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Kind != object.CANCELLED_ERROR {
+		t.Errorf("wrong error kind. expected=%s, got=%s", object.CANCELLED_ERROR, errObj.Kind)
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestIdentifiersWithDigits(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x1 = 5; let x2 = 7; x1 * x2;", 35},
+		{"let add2 = fn(a1, b1) { a1 + b1 }; add2(1, 2);", 3},
+		{"let v = 1; let v1 = 2; v + v1;", 3},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v",
+			fn.Parameters)
+	}
+
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+
+	expectedBody := "(x + 2)"
+
+	if fn.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+let newAdder = fn(x) {
+  fn(y) { x + y };
+};
+
+let addTwo = newAdder(2);
+addTwo(2);`
+
+	testIntegerObject(t, testEval(input), 4)
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []interface{}{2, 4, 6}},
+		{`map([], fn(x) { x })`, []interface{}{}},
+		{`map({"b": 2, "a": 1}, fn(k, v) { k + str(v) })`, []interface{}{"a1", "b2"}},
+		{`map(["a", "bc"], len)`, []interface{}{1, 2}},
+		{`let n = 10; map([1, 2], fn(x) { x + n })`, []interface{}{11, 12}},
+		{`map([1], fn(x) { let y = x; })`, []interface{}{nil}},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, []interface{}{3, 4}},
+		{`str(filter({"a": 1, "b": 2, "c": 3}, fn(k, v) { v != 2 }))`, "{a: 1, c: 3}"},
+		{`reduce([1, 2, 3], fn(acc, x) { acc + x })`, 6},
+		{`reduce([1, 2, 3], fn(acc, x) { push(acc, x * x) }, [])`, []interface{}{1, 4, 9}},
+		{`reduce({"a": 1, "b": 2}, fn(acc, k, v) { acc + k + str(v) }, "")`, "a1b2"},
+		{`reduce([], fn(acc, x) { acc })`, "ValueError: reduce of empty ARRAY with no initial value"},
+		{`reduce({}, fn(acc, k, v) { acc })`, "ArgumentError: reduce of HASH requires an initial value"},
+		{`each([1, 2], fn(x) { x })`, nil},
+		{`find([1, 5, 7], fn(x) { x > 4 })`, 5},
+		{`find([1, 2], fn(x) { x > 4 })`, nil},
+		{`find({"a": 1, "b": 2}, fn(k, v) { v == 2 })`, []interface{}{"b", 2}},
+		{`[any([1, 2], fn(x) { x > 1 }), any([1, 2], fn(x) { x > 2 }), any([], fn(x) { true })]`,
+			[]interface{}{true, false, false}},
+		{`[all([1, 2], fn(x) { x > 0 }), all([1, 2], fn(x) { x > 1 }), all([], fn(x) { false })]`,
+			[]interface{}{true, false, true}},
+		{`any([1, 2, 3], fn(x) { if (x == 1) { true } else { x + true } })`, true},
+		{`sortBy([3, 1.5, 2], fn(x) { x })`, []interface{}{1.5, 2, 3}},
+		{`sortBy(["bb", "a", "cc", "d"], len)`, []interface{}{"a", "d", "bb", "cc"}},
+		{`sortBy([2, 1], fn(x) { -x })`, []interface{}{2, 1}},
+		{`str(sortBy({"x": 2, "y": 1}, fn(k, v) { v }))`, "[[y, 1], [x, 2]]"},
+		{`sortBy([1, 2], fn(x) { if (x == 1) { 1 } else { "a" } })`, "TypeError: sortBy: cannot compare INTEGER and STRING"},
+		{`sortBy([[1]], fn(x) { x })`, "TypeError: sortBy: cannot compare ARRAY and ARRAY"},
+		{`str(groupBy(["kiwi", "apple", "plum"], len))`, "{4: [kiwi, plum], 5: [apple]}"},
+		{`str(groupBy({"a": 1, "b": 2, "c": 3}, fn(k, v) { v > 1 }))`, "{false: {a: 1}, true: {b: 2, c: 3}}"},
+		{`groupBy([1], fn(x) { [x] })`, "TypeError: groupBy: unusable as hash key: ARRAY"},
+		{`str(zip([1, 2, 3], ["a", "b"]))`, "[[1, a], [2, b]]"},
+		{`zip()`, []interface{}{}},
+		{`zip([1], 2)`, "TypeError: argument 2 to zip must be ARRAY, got INTEGER"},
+		{`range(3)`, []interface{}{0, 1, 2}},
+		{`range(2, 5)`, []interface{}{2, 3, 4}},
+		{`range(10, 0, -3)`, []interface{}{10, 7, 4, 1}},
+		{`range(5, 2)`, []interface{}{}},
+		{`range(0, 1, 0)`, "ValueError: range: step must not be zero"},
+		{`range(100000000000)`, "ValueError: range: too many elements: 100000000000"},
+		{`range("a")`, "TypeError: argument 1 to range must be INTEGER, got STRING"},
+		{`map(1, fn(x) { x })`, "TypeError: argument 1 to map must be ARRAY or HASH, got INTEGER"},
+		{`map([1], 1)`, "TypeError: argument 2 to map must be FUNCTION, got INTEGER"},
+		{`map([1])`, "ArgumentError: wrong number of arguments to map: want 2 to 2, got=1"},
+		{`map([1], fn(x, y) { x })`, "ArgumentError: wrong number of arguments to <anonymous>: want=2, got=1"},
+		{`map([1, 0], fn(x) { 1 / x })`, "ZeroDivisionError: division by zero: 1 / 0"},
+		{`filter([1], fn(x) { throw "boom" })`, "Error: boom"},
+		{`try { each([1], fn(x) { x + true }) } catch (e) { e.kind }`, "TypeError"},
+		{`map([1, 2], fn(x) { try { x / 0 } catch (e) { -1 } })`, []interface{}{-1, -1}},
+	}
+
+	for _, tt := range tests {
+		testObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+
+	input := `let check = fn(x) { x + true };
+map([1], check);`
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned for an error in a callback")
+	}
+	expected := []object.Frame{{Function: "check", Line: 2, Column: 4}}
+	if len(errObj.Stack) != 1 || errObj.Stack[0] != expected[0] || errObj.Line != 1 {
+		t.Errorf("wrong location of an error in a callback. line=%d, stack=%+v", errObj.Line, errObj.Stack)
+	}
+}
+
+func TestTasks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let c = chan(); spawn send(c, 42); recv(c)`, 42},
+		{`let double = fn(x) { x * 2 }; recv(spawn double(21))`, 42},
+		{`let square = fn(x) { x * x }; map(map([1, 2, 3], fn(x) { spawn square(x) }), recv)`, []interface{}{1, 4, 9}},
+		{`let c = chan(2); send(c, 1); send(c, 2); [recv(c), recv(c)]`, []interface{}{1, 2}},
+		{`let c = chan(1); send(c, 1); close(c); [recv(c), recv(c)]`, []interface{}{1, nil}},
+		{`let f = fn() { }; recv(spawn f())`, nil},
+		{`let c = chan(); let worker = fn() { send(c, "done"); 1 }; let t = spawn worker(); [recv(c), recv(t)]`,
+			[]interface{}{"done", 1}},
+		{`let a = chan(); let b = chan(); spawn send(b, "b"); select { case let v = recv(a) { v } case let v = recv(b) { v } }`,
+			"b"},
+		{`let c = chan(); let r = fn() { recv(c) }; let t = spawn r(); select { case send(c, 7) { recv(t) } }`, 7},
+		{`let c = chan(); select { case let v = recv(c) { v } default { "none" } }`, "none"},
+		{`let c = chan(1); send(c, 5); select { case let v = recv(c) { v + 1 } default { 0 } }`, 6},
+		{`let c = chan(1); select { case send(c, 1) { } }; recv(c)`, 1},
+		{`let c = chan(); close(c); select { case let v = recv(c) { v } }`, nil},
+		{`type(chan())`, "CHANNEL"},
+		{`str([chan(), chan()])`, "[<chan 1>, <chan 2>]"},
+		{`chan(-1)`, "ValueError: chan: negative capacity: -1"},
+		{`send(1, 2)`, "TypeError: argument 1 to send must be CHANNEL, got INTEGER"},
+		{`select { case let v = recv(1) { v } }`, "TypeError: argument 1 to recv must be CHANNEL, got INTEGER"},
+		{`let c = chan(1); close(c); send(c, 1)`, "ChannelError: send on closed channel <chan 1>"},
+		{`let c = chan(); close(c); close(c)`, "ChannelError: close of closed channel <chan 1>"},
+		{`let c = chan(); recv(c)`, "DeadlockError: all tasks are blocked: main recv <chan 1>"},
+		{`let c = chan(); select { }`, "DeadlockError: all tasks are blocked: main select with no cases"},
+		{`let a = chan(); let b = chan(); let w = fn() { recv(a) }; spawn w(); select { case send(a, 1) { recv(b) } }`,
+			"DeadlockError: all tasks are blocked: main recv <chan 2>"},
+		{`let a = chan(); let b = chan(); let w = fn() { recv(a) }; spawn w(); recv(b)`,
+			"DeadlockError: all tasks are blocked: main recv <chan 2>; task 1 (w) recv <chan 1>"},
+		{`let c = chan(); let w = fn() { send(c, 1) }; spawn w(); 5`,
+			"DeadlockError: all tasks are blocked: task 1 (w) send <chan 1>"},
+		{`let c = chan(); try { recv(c) } catch (e) { e.kind }`, "DeadlockError"},
+		{`let f = fn() { 1 / 0 }; spawn f(); 5`, "ZeroDivisionError: division by zero: 1 / 0"},
+		{`let f = fn() { 1 / 0 }; recv(spawn f())`, "ZeroDivisionError: division by zero: 1 / 0"},
+		{`spawn 1()`, "TypeError: not a function: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTasksShareLimits(t *testing.T) {
+	input := `let f = fn(n) { if (n < 1) { 0 } else { f(n - 1) } };
+let ts = map(range(4), fn(i) { spawn f(100) });
+map(ts, recv)`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	// 1つのタスクなら制限に収まるが、4つ分は収まらない
+	e := NewWithLimits(context.Background(), Limits{MaxSteps: 3000})
+	evaluated := e.Wait(e.Eval(program, object.NewEnvironment()))
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Kind != object.STEP_LIMIT_ERROR {
+		t.Errorf("wrong error kind. expected=%s, got=%s", object.STEP_LIMIT_ERROR, errObj.Kind)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let double = fn(x) { x * 2 }; map(map([1, 2, 3], fn(x) { spawn double(x) }), recv)`, []interface{}{2, 4, 6}},
+		{`let c = chan(); select { case let v = recv(c) { v } default { "none" } }`, "none"},
+		{`let c = chan(); recv(c)`, "DeadlockError: all tasks are blocked: main recv <chan 1>"},
+		{`let a = chan(); let b = chan(); let w = fn() { recv(a) }; spawn w(); recv(b)`,
+			"DeadlockError: all tasks are blocked: main recv <chan 2>; task 1 (w) recv <chan 1>"},
+		{`let c = chan(); let w = fn() { send(c, 1) }; spawn w(); 5`,
+			"DeadlockError: all tasks are blocked: task 1 (w) send <chan 1>"},
+		{`let f = fn() { 1 / 0 }; spawn f(); 5`, "ZeroDivisionError: division by zero: 1 / 0"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, tt.input, testEvalScheduled(tt.input, 1), tt.expected)
+	}
+}
+
+// 同じシードなら同じ順番で、シードを変えると別の順番で実行される
+func TestSchedulerIsReproducible(t *testing.T) {
+	input := `let c = chan(3);
+let w = fn(x) { send(c, x) };
+spawn w(1); spawn w(2); spawn w(3);
+str([recv(c), recv(c), recv(c)])`
+
+	orders := map[string]bool{}
+	for seed := int64(0); seed < 20; seed++ {
+		first := testEvalScheduled(input, seed)
+		second := testEvalScheduled(input, seed)
+		if first.Inspect() != second.Inspect() {
+			t.Errorf("seed %d gave different results: %s and %s", seed, first.Inspect(), second.Inspect())
+		}
+		orders[first.Inspect()] = true
+	}
+
+	if len(orders) < 2 {
+		t.Errorf("all seeds gave the same order: %v", orders)
+	}
+}
+
+func TestSchedulerStep(t *testing.T) {
+	input := `let c = chan();
+let w = fn() { send(c, 1) };
+spawn w();
+recv(c) + 1`
+
+	run := func() []TaskInfo {
+		s := NewScheduler(7)
+		s.Start(New(), testParse(input), object.NewEnvironment())
+
+		// 最初はメインしか動けず、spawnで順番を譲る
+		info, ok := s.Step()
+		if !ok || info != (TaskInfo{ID: 0, Name: "main"}) {
+			t.Fatalf("wrong first step. got=%+v, %t", info, ok)
+		}
+		if tasks := s.Tasks(); len(tasks) != 2 || tasks[1] != (TaskInfo{ID: 1, Name: "w"}) {
+			t.Fatalf("wrong tasks after spawn. got=%+v", tasks)
+		}
+
+		trace := []TaskInfo{info}
+		for {
+			info, ok := s.Step()
+			if !ok {
+				break
+			}
+			trace = append(trace, info)
+		}
+
+		testIntegerObject(t, s.Result(), 2)
+		if tasks := s.Tasks(); len(tasks) != 0 {
+			t.Errorf("tasks remain after the run. got=%+v", tasks)
+		}
+		return trace
+	}
+
+	trace := run()
+	if again := run(); !reflect.DeepEqual(trace, again) {
+		t.Errorf("steps are not reproducible.\nfirst=%+v\nsecond=%+v", trace, again)
+	}
+
+	done := map[int]bool{}
+	for _, info := range trace {
+		if done[info.ID] {
+			t.Errorf("task %d stepped after it finished: %+v", info.ID, trace)
+		}
+		done[info.ID] = info.Done
+	}
+	if !done[0] || !done[1] {
+		t.Errorf("not all tasks finished: %+v", trace)
+	}
+}
+
+// 止まったタスクがどのチャネルを待っているかが見える
+func TestSchedulerBlockedTasks(t *testing.T) {
+	input := `let c = chan();
+let w = fn() { recv(c) };
+let t = spawn w();
+send(c, 5);
+recv(t)`
+
+	s := NewScheduler(3)
+	s.Start(New(), testParse(input), object.NewEnvironment())
+
+	blocked := map[string]bool{}
+	for {
+		info, ok := s.Step()
+		if !ok {
+			break
+		}
+		if info.Blocked != "" {
+			blocked[info.Name+" "+info.Blocked] = true
+		}
+	}
+
+	// 送る側と受け取る側のどちらかは、もう一方が来るまで待つ
+	testIntegerObject(t, s.Result(), 5)
+	if !blocked["main send <chan 1>"] && !blocked["w recv <chan 1>"] {
+		t.Errorf("no task was blocked on the unbuffered channel: %v", blocked)
+	}
+}
+
+// Quantumを設定すると、チャネルを使わないタスクも途中で順番を譲る
+func TestSchedulerQuantum(t *testing.T) {
+	input := `let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+let a = spawn fib(10);
+let b = spawn fib(11);
+[recv(a), recv(b)]`
+
+	s := NewScheduler(1)
+	s.Quantum = 50
+	s.Start(New(), testParse(input), object.NewEnvironment())
+
+	steps := 0
+	for {
+		if _, ok := s.Step(); !ok {
+			break
+		}
+		steps++
+	}
+
+	testObject(t, input, s.Result(), []interface{}{55, 89})
+	if steps < 100 {
+		t.Errorf("tasks were not preempted. steps=%d", steps)
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey-modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"util.mk":        "let secret = 10;\nexport let helper = fn(x) { x + secret };",
+		"sub/counter.mk": `import "../util" as u; export let next = fn(x) { u.helper(x) + 1 };`,
+		"lib/shared.mk":  "export let answer = 42;",
+		"a.mk":           `import "./b" as b; export let x = 1;`,
+		"b.mk":           `import "./a" as a; export let y = 2;`,
+		"broken.mk":      "let = 1;",
+		"failing.mk":     "export let f = 1;\nf + true;",
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`import "util" as u; u.helper(1)`, 11},
+		{`import "./util.mk" as u; u.helper(2)`, 12},
+		{`import "sub/counter" as c; c.next(1)`, 12},
+		{`import "shared" as s; s.answer`, 42},
+		{`import "util" as u; type(u)`, "MODULE"},
+		{`import "util" as u; str(u)`, "<module util>"},
+		{`let f = fn() { import "util" as u; u.helper(0) }; f()`, 10},
+		{`import "util" as u; u.secret`, "NameError: module util has no export \"secret\""},
+		{`import "missing" as m; 1`, "ImportError: module not found: \"missing\""},
+		{`import "./shared" as s; 1`, "ImportError: module not found: \"./shared\""},
+		{`import "a" as a; 1`, "ImportError: import cycle: a -> b -> a"},
+		{`import "broken" as b; 1`, "ImportError: cannot import \"broken\": " + filepath.Join(dir, "broken.mk") +
+			": expected next token to be INDENT, got = insted"},
+		{`import "failing" as f; 1`, "TypeError: type mismatch: INTEGER + BOOLEAN"},
+		{`let x = 1; x.y`, "TypeError: member access not supported: INTEGER"},
+		{`try { throw "boom" } catch (e) { e.message }`, "boom"},
+	}
+
+	for _, tt := range tests {
+		loader := NewModuleLoader(filepath.Join(dir, "lib"))
+		evaluated := testEvalFile(filepath.Join(dir, "main.mk"), loader, tt.input)
+		testObject(t, tt.input, evaluated, tt.expected)
+	}
+}
+
+func TestStringsModule(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`s.split("a,b,,c", ",")`, []interface{}{"a", "b", "", "c"}},
+		{`s.split("日本", "")`, []interface{}{"日", "本"}},
+		{`s.join(["a", "b", "c"], "-")`, "a-b-c"},
+		{`s.join([], "-")`, ""},
+		{`s.join(["a", 1], "-")`, "TypeError: element 1 to strings.join must be STRING, got INTEGER"},
+		{`let big = s.repeat("x", 1048576); s.join(map(range(257), fn(i) { big }), "")`,
+			"ValueError: strings.join: result too long: 269484032 bytes"},
+		{`s.trim("  hi  ")`, "hi"},
+		{`s.trim("xxhixx", "x")`, "hi"},
+		{`s.trimLeft("  hi  ")`, "hi  "},
+		{`s.trimRight("  hi  ")`, "  hi"},
+		{`s.trimLeft("xyhi", "yx")`, "hi"},
+		{`s.trimPrefix("prefix-body", "prefix-")`, "body"},
+		{`s.trimSuffix("file.mk", ".mk")`, "file"},
+		{`s.contains("monkey", "key")`, true},
+		{`s.contains("monkey", "dog")`, false},
+		{`s.index("こんにちは", "ちは")`, 3},
+		{`s.index("monkey", "z")`, -1},
+		{`s.replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`s.replace("a-b-c", "-", "+", 1)`, "a+b-c"},
+		{`s.replace("ab", "", "-")`, "-a-b-"},
+		{`s.replace(s.repeat("x", 65536), "", s.repeat("y", 65536))`,
+			"ValueError: strings.replace: result too long: 4295098368 bytes"},
+		{`s.len(s.replace(s.repeat("x", 65536), "", s.repeat("y", 65536), 2))`, 196608},
+		{`s.upper("Hello")`, "HELLO"},
+		{`s.lower("Hello")`, "hello"},
+		{`s.repeat("ab", 3)`, "ababab"},
+		{`s.repeat("ab", -1)`, "ValueError: negative repeat count: -1"},
+		{`s.repeat("ab", 9223372036854775807)`, "ValueError: repeat result too long: 9223372036854775807 * 2 bytes"},
+		{`s.repeat("ab", 68719476736)`, "ValueError: repeat result too long: 68719476736 * 2 bytes"},
+		{`s.repeat("", 9223372036854775807)`, ""},
+		{`s.startsWith("monkey", "mon")`, true},
+		{`s.endsWith("monkey", "mon")`, false},
+		{`s.padLeft("7", 3, "0")`, "007"},
+		{`s.padLeft("7", 4, "ab")`, "aba7"},
+		{`s.padRight("日", 3)`, "日  "},
+		{`s.padRight("long", 2)`, "long"},
+		{`s.padLeft("x", 3, "")`, "ValueError: strings.padLeft: pad must not be empty"},
+		{`s.padLeft("a", 9223372036854775807)`, "ValueError: strings.padLeft: width too large: 9223372036854775807"},
+		{`s.padRight("a", 68719476736, "ab")`, "ValueError: strings.padRight: width too large: 68719476736"},
+		{`s.len("日本語")`, 3},
+		{`len("日本語")`, 9},
+		{`s.slice("日本語です", 1, 3)`, "本語"},
+		{`s.slice("日本語です", 2)`, "語です"},
+		{`s.slice("日本語です", -2)`, "です"},
+		{`s.slice("abc", 1, 100)`, "bc"},
+		{`s.slice("abc", 2, 1)`, ""},
+		{`s.upper(1)`, "TypeError: argument 1 to strings.upper must be STRING, got INTEGER"},
+		{`s.trim()`, "ArgumentError: wrong number of arguments to strings.trim: want 1 to 2, got=0"},
+		{`s.nope`, "NameError: module strings has no export \"nope\""},
+		{`str(s)`, "<module strings>"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(`import "strings" as s; ` + tt.input)
+		testObject(t, tt.input, evaluated, tt.expected)
+	}
+}
+
+func TestMathModule(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`m.abs(-3)`, 3},
+		{`m.abs(-2.5)`, 2.5},
+		{`m.abs(-9223372036854775807 - 1)`, "ValueError: integer overflow: math.abs(-9223372036854775808)"},
+		{`m.min(3, 1.5, 2)`, 1.5},
+		{`m.max(3, 1.5, 2)`, 3},
+		{`m.max()`, "ArgumentError: wrong number of arguments to math.max: want at least 1, got=0"},
+		{`m.min(1, "a")`, "TypeError: argument 2 to math.min must be INTEGER or FLOAT, got STRING"},
+		{`m.clamp(15, 0, 10)`, 10},
+		{`m.clamp(-1, 0, 10)`, 0},
+		{`m.clamp(0.5, 0, 1)`, 0.5},
+		{`m.clamp(1, 10, 0)`, "ValueError: math.clamp: lower bound 10 is greater than upper bound 0"},
+		{`m.pow(2, 10)`, 1024},
+		{`m.pow(-2, 63)`, -9223372036854775807 - 1},
+		{`m.pow(2, 63)`, "ValueError: integer overflow: math.pow(2, 63)"},
+		{`m.pow(2, 1000000)`, "ValueError: integer overflow: math.pow(2, 1000000)"},
+		{`m.pow(1, 1000000)`, 1},
+		{`m.pow(2, -1)`, 0.5},
+		{`m.pow(4, 0.5)`, 2.0},
+		{`m.pow(0, -1)`, "ZeroDivisionError: zero to a negative power: math.pow(0, -1)"},
+		{`m.pow(-8, 0.5)`, "ValueError: math domain error: math.pow(-8, 0.5)"},
+		{`m.sqrt(16)`, 4.0},
+		{`m.sqrt(-1)`, "ValueError: math domain error: math.sqrt(-1)"},
+		{`m.floor(-2.5)`, -3},
+		{`m.ceil(-2.5)`, -2},
+		{`m.round(2.5)`, 3},
+		{`m.round(-2.5)`, -3},
+		{`m.floor(7)`, 7},
+		{`m.round(m.pow(10.0, 300) * 10000000000.0)`, "ValueError: cannot convert +Inf to integer"},
+		{`m.round(m.sin(m.pi / 2) * 1000)`, 1000},
+		{`m.round(m.cos(m.pi) * 1000)`, -1000},
+		{`m.round(m.atan2(1, 1) * 4 * 1000)`, 3142},
+		{`m.asin(2)`, "ValueError: math domain error: math.asin(2)"},
+		{`m.exp(0)`, 1.0},
+		{`m.exp(1000)`, "ValueError: math range error: math.exp(1000)"},
+		{`m.log(m.e)`, 1.0},
+		{`m.log(8, 2)`, 3.0},
+		{`m.log10(1000)`, 3.0},
+		{`m.log2(0.25)`, -2.0},
+		{`m.log(0)`, "ValueError: math domain error: math.log(0)"},
+		{`m.log(8, 1)`, "ValueError: math domain error: math.log(8, 1)"},
+		{`m.gcd(12, -18)`, 6},
+		{`m.gcd(0, 0)`, 0},
+		{`m.div(7, 2)`, 3},
+		{`m.div(-7, 2)`, -4},
+		{`m.div(7, -2)`, -4},
+		{`m.div(-8, 2)`, -4},
+		{`m.mod(7, 3)`, 1},
+		{`m.mod(-7, 3)`, 2},
+		{`m.mod(7, -3)`, -2},
+		{`m.mod(-6, 3)`, 0},
+		{`m.rem(-7, 3)`, -1},
+		{`m.rem(7, -3)`, 1},
+		{`m.div(1, 0)`, "ZeroDivisionError: division by zero: math.div(1, 0)"},
+		{`m.div(-9223372036854775807 - 1, -1)`, "ValueError: integer overflow: math.div(-9223372036854775808, -1)"},
+		{`m.mod(-9223372036854775807 - 1, -1)`, 0},
+		{`m.rem(-9223372036854775807 - 1, -1)`, 0},
+		{`m.mod(1.5, 1)`, "TypeError: argument 1 to math.mod must be INTEGER, got FLOAT"},
+		{`m.pi > 3.14 == (m.pi < 3.15)`, true},
+		{`type(m.e)`, "FLOAT"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(`import "math" as m; ` + tt.input)
+		testObject(t, tt.input, evaluated, tt.expected)
+	}
+}
+
+func TestJSONModule(t *testing.T) {
+	// Monkeyの文字列には"を書けないので、JSONの文字列は変数で渡す
+	payloads := map[string]string{
+		"array":  `[1, "a", [false]]`,
+		"object": `{"name": "monkey", "tags": ["a", "b"], "n": null}`,
+		"nested": `{"k": [1, 2.5, "s"]}`,
+		"huge":   `[1, {"a": -1e400}]`,
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`json.parse("42")`, 42},
+		{`json.parse("-1.5")`, -1.5},
+		{`json.parse("1e3")`, 1000.0},
+		{`json.parse("123456789012345678901234")`, 1.2345678901234568e+23},
+		{`json.parse("1e400")`, "ValueError: json.parse: number out of range: 1e400"},
+		{`json.parse(huge)`, "ValueError: json.parse: number out of range: -1e400"},
+		{`json.parse("null")`, nil},
+		{`json.parse(" true ")`, true},
+		{`json.parse(array)[1]`, "a"},
+		{`json.parse(array)[2][0]`, false},
+		{`json.parse(object).name`, "monkey"},
+		{`json.parse(object)["tags"][1]`, "b"},
+		{`json.parse(object).n`, nil},
+		{`type(json.parse("{}"))`, "HASH"},
+		{`json.parse("{")`, "ValueError: json.parse: unexpected EOF"},
+		{`json.parse("[1] 2")`, "ValueError: json.parse: unexpected data after top-level value"},
+		{`json.parse("nope")`, "ValueError: json.parse: invalid character 'o' in literal null (expecting 'u')"},
+		{`json.stringify({"b": 1, "a": [true, json.parse("null"), 1.5], "c": {"d": "<e>"}})`,
+			`{"a":[true,null,1.5],"b":1,"c":{"d":"<e>"}}`},
+		{`json.stringify([1, {"a": []}], 2)`, "[\n  1,\n  {\n    \"a\": []\n  }\n]"},
+		{`json.stringify("x")`, `"x"`},
+		{`json.stringify(json.parse(nested))`, `{"k":[1,2.5,"s"]}`},
+		{`json.stringify(json.parse(object))`, `{"n":null,"name":"monkey","tags":["a","b"]}`},
+		{`json.stringify([fn(x) { x }])`, "TypeError: json.stringify: cannot encode FUNCTION"},
+		{`json.stringify({1: 2})`, "TypeError: json.stringify: hash key must be STRING, got INTEGER"},
+		{`json.stringify(1, -1)`, "ValueError: json.stringify: negative indent: -1"},
+		{`json.stringify([1], 16)`, "[\n                1\n]"},
+		{`json.stringify(1, 9223372036854775807)`, "ValueError: json.stringify: indent too large: 9223372036854775807 (max 16)"},
+		{`json.stringify(cyclic)`, "ValueError: json.stringify: cyclic structure"},
+		{`let a = [1]; json.stringify([a, a])`, "[[1],[1]]"},
+		{`json.stringify([1.0, 2.5, 0.000001 * 0.1, json.parse("1e21")])`, "[1.0,2.5,1e-07,1e+21]"},
+		{`type(json.parse(json.stringify(1.0)))`, "FLOAT"},
+		{`json.parse(json.stringify(json.parse("1e21"))) == json.parse("1e21")`, true},
+	}
+
+	cyclic := &object.Array{}
+	cyclic.Elements = []object.Object{&object.Integer{Value: 1}, cyclic}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(`import "json" as json; ` + tt.input)).ParseProgram()
+		env := object.NewEnvironment()
+		env.Set("cyclic", cyclic)
+		for name, payload := range payloads {
+			env.Set(name, &object.String{Value: payload})
+		}
+		testObject(t, tt.input, Eval(program, env), tt.expected)
+	}
+}
+
+func TestRegexModule(t *testing.T) {
+	// Monkeyの文字列には\を書けないので、バックスラッシュを含むパターンは変数で渡す
+	patterns := map[string]string{
+		"digits": `\d+`,
+		"date":   `(?P<year>\d{4})-(?P<month>\d{2})(-(?P<day>\d{2}))?`,
+		"space":  `\s*,\s*`,
+		// パターンではないが、Monkeyで書くと長くなる大きな文字列も渡す
+		"big":     strings.Repeat("x", 65536),
+		"dollars": strings.Repeat("$0", 65536),
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`type(re.compile("a+"))`, "REGEX"},
+		{`str(re.compile("a+"))`, "/a+/"},
+		{`re.compile("(")`, "ValueError: regex.compile: error parsing regexp: missing closing ): `(`"},
+		{`re.compile(1)`, "TypeError: argument 1 to regex.compile must be STRING, got INTEGER"},
+		{`let r = re.compile(digits); re.match(r, "abc123")`, true},
+		{`let r = re.compile(digits); [re.match(r, "abc"), re.match(r, "7")]`, []interface{}{false, true}},
+		{`re.match("^a", "ba")`, false},
+		{`re.match(1, "a")`, "TypeError: argument 1 to regex.match must be REGEX or STRING, got INTEGER"},
+		{`re.match("(", "a")`, "ValueError: regex.match: error parsing regexp: missing closing ): `(`"},
+		{`re.find(digits, "a12b345")`, "12"},
+		{`re.find(digits, "abc")`, nil},
+		{`re.find("x*", "abc")`, ""},
+		{`re.findAll(digits, "a12b345c6")`, []interface{}{"12", "345", "6"}},
+		{`re.findAll(digits, "a12b345c6", 2)`, []interface{}{"12", "345"}},
+		{`re.findAll(digits, "abc")`, []interface{}{}},
+		{`re.findSubmatch(date, "on 2024-05 ok")`, []interface{}{"2024-05", "2024", "05", nil, nil}},
+		{`re.findSubmatch(date, "today")`, nil},
+		{`let g = re.groups(date, "2024-05-17"); [g.year, g.month, g.day]`, []interface{}{"2024", "05", "17"}},
+		{`re.groups(date, "2024-05").day`, nil},
+		{`len(re.groups("(a)(b)", "ab"))`, 0},
+		{`re.groups(date, "today")`, nil},
+		{`re.replace(date, "2024-05-17", "${day}/${month}/${year}")`, "17/05/2024"},
+		{`re.replace("(a)(b)", "abab", "$2$1")`, "baba"},
+		{`re.replace("a", "banana", "$$")`, "b$n$n$"},
+		{`re.replace(".", big, big)`, "ValueError: regex.replace: result too long: 4294967296 bytes"},
+		{`re.replace("x+", big, dollars)`, "ValueError: regex.replace: result too long: 4295098368 bytes"},
+		{`re.split(space, "a , b,c ,d")`, []interface{}{"a", "b", "c", "d"}},
+		{`re.split(space, "a , b,c ,d", 2)`, []interface{}{"a", "b,c ,d"}},
+		{`re.split(re.compile("x"), 1)`, "TypeError: argument 2 to regex.split must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(`import "regex" as re; ` + tt.input)).ParseProgram()
+		env := object.NewEnvironment()
+		for name, pattern := range patterns {
+			env.Set(name, &object.String{Value: pattern})
+		}
+		testObject(t, tt.input, Eval(program, env), tt.expected)
+	}
+}
+
+func TestFSModule(t *testing.T) {
+	mem := NewMemFS()
+	mem.MkdirAll("/data/in")
+	mem.WriteFile("/data/in/a.txt", []byte("hello"))
+	mem.WriteFile("/data/in/lines.txt", []byte("one\r\ntwo\n\nfour\n"))
+	mem.WriteFile("/data/in/empty.txt", nil)
+	mem.WriteFile("/secret.txt", []byte("x"))
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`fs.readFile("/data/in/a.txt")`, "hello"},
+		{`fs.readFile("data/in/a.txt")`, "hello"},
+		{`fs.readFile("/data/in/../in/a.txt")`, "hello"},
+		{`fs.readFile("/data/in/none.txt")`, "IOError: fs.readFile: open /data/in/none.txt: file does not exist"},
+		{`fs.readFile("/data/in")`, "IOError: fs.readFile: read /data/in: is a directory"},
+		{`fs.readFile(1)`, "TypeError: argument 1 to fs.readFile must be STRING, got INTEGER"},
+		{`fs.readLines("/data/in/lines.txt")`, []interface{}{"one", "two", "", "four"}},
+		{`fs.readLines("/data/in/empty.txt")`, []interface{}{}},
+		{`fs.listDir("/data/in")`, []interface{}{"a.txt", "empty.txt", "lines.txt"}},
+		{`fs.listDir("/data/in/a.txt")`, "IOError: fs.listDir: readdirent /data/in/a.txt: not a directory"},
+		{`[fs.exists("/data/in/a.txt"), fs.exists("/data/in"), fs.exists("/data/x")]`, []interface{}{true, true, false}},
+		{`fs.writeFile("/data/out.txt", "report"); fs.readFile("/data/out.txt")`, "report"},
+		{`fs.writeFile("/data/in/a.txt", "bye"); fs.readFile("/data/in/a.txt")`, "bye"},
+		{`fs.writeFile("/data/new/r.txt", "")`, "IOError: fs.writeFile: open /data/new/r.txt: file does not exist"},
+		{`fs.mkdir("/data/x/y"); fs.mkdir("/data/x/y"); fs.listDir("/data/x")`, []interface{}{"y"}},
+		{`fs.mkdir("/data/in/a.txt/b")`, "IOError: fs.mkdir: mkdir /data/in/a.txt: not a directory"},
+		{`fs.readFile("/secret.txt")`, "PermissionError: fs.readFile: access denied: /secret.txt"},
+		{`fs.readFile("/data/../secret.txt")`, "PermissionError: fs.readFile: access denied: /secret.txt"},
+		{`fs.exists("/database")`, "PermissionError: fs.exists: access denied: /database"},
+		{`fs.listDir("/")`, "PermissionError: fs.listDir: access denied: /"},
+	}
+
+	loader := NewModuleLoader()
+	loader.Register("fs", FSExports(mem, "/data"))
+	for _, tt := range tests {
+		result := testEvalFile("/main.mk", loader, `import "fs" as fs; `+tt.input)
+		testObject(t, tt.input, result, tt.expected)
+	}
+}
+
+func TestImportSandbox(t *testing.T) {
+	mem := NewMemFS()
+	mem.MkdirAll("/data/lib")
+	mem.WriteFile("/data/lib/util.mk", []byte("export let n = 1;"))
+	mem.WriteFile("/secret.mk", []byte("export let n = 2;"))
+	mem.WriteFile("/bad.mk", []byte("let = ;"))
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`import "./lib/util" as u; u.n`, 1},
+		{`import "/data/lib/util" as u; u.n`, 1},
+		{`import "/secret" as s; s.n`, "PermissionError: cannot import \"/secret\": access denied: /secret.mk"},
+		{`import "../secret" as s; s.n`, "PermissionError: cannot import \"../secret\": access denied: /secret.mk"},
+		{`import "/bad" as b;`, "PermissionError: cannot import \"/bad\": access denied: /bad.mk"},
+		{`import "fs" as fs; fs.readFile("/secret.mk")`, "PermissionError: fs.readFile: access denied: /secret.mk"},
+	}
+
+	loader := NewModuleLoader()
+	loader.Sandbox(mem, "/data")
+	for _, tt := range tests {
+		result := testEvalFile("/data/main.mk", loader, tt.input)
+		testObject(t, tt.input, result, tt.expected)
+	}
+}
+
+func TestFSModuleSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "root")
+	os.Mkdir(root, 0777)
+	ioutil.WriteFile(filepath.Join(dir, "secret.txt"), []byte("x"), 0666)
+	if err := os.Symlink(dir, filepath.Join(root, "link")); err != nil {
+		t.Skip(err)
+	}
+
+	loader := NewModuleLoader()
+	loader.Register("fs", FSExports(OSFileSystem{}, root))
+
+	input := `import "fs" as fs; fs.writeFile(path + "/sub/../a.txt", "ok"); fs.readFile(path + "/a.txt")`
+	env := object.NewEnvironment()
+	env.Set("path", &object.String{Value: root})
+	e := New()
+	e.Modules = loader
+	testObject(t, input, e.Eval(parser.New(lexer.New(input)).ParseProgram(), env), "ok")
+
+	input = `import "fs" as fs; fs.readFile(path + "/link/secret.txt")`
+	result := e.Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	if err, ok := result.(*object.Error); !ok || err.Kind != object.PERMISSION_ERROR {
+		t.Errorf("reading through a symlink out of the root should be denied. got=%s", result.Inspect())
+	}
+}
+
+func TestTimeModule(t *testing.T) {
+	now := time.Date(2024, 5, 17, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`type(time.now())`, "TIME"},
+		{`str(time.now())`, "2024-05-17T09:30:00Z"},
+		{`str(time.date(2024, 1, 2, 3, 4, 5, "Asia/Tokyo"))`, "2024-01-02T03:04:05+09:00"},
+		{`str(time.date(2024, 13, 1))`, "2025-01-01T00:00:00Z"},
+		{`time.date(2024, 1, 1, 0, 0, 0, "Mars/Base")`, "ValueError: time.date: unknown time zone Mars/Base"},
+		{`str(time.parse(time.RFC3339, "2024-05-17T18:30:00.5+09:00"))`, "2024-05-17T18:30:00.5+09:00"},
+		{`str(time.parse(time.DateTime, "2024-05-17 08:00:00", "America/New_York"))`, "2024-05-17T08:00:00-04:00"},
+		{`time.parse(time.DateOnly, "17/05/2024")`,
+			`ValueError: time.parse: parsing time "17/05/2024" as "2006-01-02": cannot parse "17/05/2024" as "2006"`},
+		{`time.format(time.now(), "Jan 2, 2006 at 3:04pm")`, "May 17, 2024 at 9:30am"},
+		{`time.format(time.in(time.now(), "Asia/Tokyo"), time.Kitchen)`, "6:30PM"},
+		{`time.zone(time.in(time.now(), "Europe/Paris"))`, "Europe/Paris"},
+		{`time.unix(time.now())`, 1715938200},
+		{`time.unixMilli(time.now() + time.Millisecond * 5)`, 1715938200005},
+		{`time.fromUnix(1715938200) == time.now()`, true},
+		{`str(time.fromUnixMilli(-1))`, "1969-12-31T23:59:59.999Z"},
+		{`let t = time.now(); [time.year(t), time.month(t), time.day(t), time.hour(t), time.minute(t), time.second(t)]`,
+			[]interface{}{2024, 5, 17, 9, 30, 0}},
+		{`time.weekday(time.now())`, "Friday"},
+		{`str(time.addDate(time.date(2024, 1, 31), 0, 1, 0))`, "2024-03-02T00:00:00Z"},
+		{`str(time.truncate(time.now() + 20 * time.Minute, time.Hour))`, "2024-05-17T09:00:00Z"},
+		{`str(time.duration("1h30m"))`, "1h30m0s"},
+		{`time.duration("soon")`, `ValueError: time.duration: time: invalid duration "soon"`},
+		{`str(time.now() - time.date(2024, 5, 17))`, "9h30m0s"},
+		{`str(time.since(time.date(2024, 5, 16)))`, "33h30m0s"},
+		{`str(time.now() - time.Hour * 2)`, "2024-05-17T07:30:00Z"},
+		{`str(time.Minute + time.now())`, "2024-05-17T09:31:00Z"},
+		{`str(3 * time.Hour - time.Minute / 2)`, "2h59m30s"},
+		{`str(-time.Second)`, "-1s"},
+		{`time.duration("2h") / time.Minute`, 120},
+		{`time.Second / 0`, "ZeroDivisionError: division by zero: 1s / 0"},
+		{`time.toSeconds(time.Millisecond * 1500)`, 1.5},
+		{`time.toMillis(time.duration("1.5s"))`, 1500},
+		{`time.now() > time.date(2024, 5, 17)`, true},
+		{`time.now() < time.date(2024, 5, 17)`, false},
+		{`time.in(time.now(), "Asia/Tokyo") == time.now()`, true},
+		{`time.Hour > time.Minute`, true},
+		{`time.Hour == time.duration("60m")`, true},
+		{`time.now() + time.now()`, "TypeError: unknown operator: TIME + TIME"},
+		{`time.now() - 1`, "TypeError: type mismatch: TIME - INTEGER"},
+		{`time.now() == 1`, false},
+		{`time.format(1, time.RFC3339)`, "TypeError: argument 1 to time.format must be TIME, got INTEGER"},
+	}
+
+	loader := NewModuleLoader()
+	loader.Register("time", TimeExports(func() time.Time { return now }))
+	for _, tt := range tests {
+		result := testEvalFile("main.mk", loader, `import "time" as time; `+tt.input)
+		testObject(t, tt.input, result, tt.expected)
+	}
+}
+
+func TestImportCache(t *testing.T) {
+	reads := 0
+	loader := NewModuleLoader()
+	loader.ReadFile = func(name string) ([]byte, error) {
+		if filepath.Base(name) != "util.mk" {
+			return nil, os.ErrNotExist
+		}
+		reads++
+		return []byte("export let n = [1];"), nil
+	}
+
+	input := `import "util" as a; import "./util" as b; a == b`
+	testBooleanObject(t, testEvalFile(filepath.Join(os.TempDir(), "main.mk"), loader, input), true)
+	testEvalFile(filepath.Join(os.TempDir(), "other.mk"), loader, `import "util" as c;`)
+
+	if reads != 1 {
+		t.Errorf("module should be read once. got=%d", reads)
+	}
+}
+
+func TestImportErrorStack(t *testing.T) {
+	loader := NewModuleLoader()
+	loader.ReadFile = func(name string) ([]byte, error) {
+		return []byte("let f = fn() { 1 + true };\nf();"), nil
+	}
+
+	evaluated := testEvalFile(filepath.Join(os.TempDir(), "main.mk"), loader, "\nimport \"util\" as u;")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	traceback := `Traceback (most recent call last):
+  line 2, column 1, in <module util>
+  line 2, column 2, in f
+TypeError at line 1, column 18: type mismatch: INTEGER + BOOLEAN`
+	if errObj.Traceback() != traceback {
+		t.Errorf("wrong traceback.\nwant=%s\ngot=%s", traceback, errObj.Traceback())
+	}
+}
+
+func testEval(input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	return Eval(program, env)
+}
+
+func testEvalWithLimits(ctx context.Context, input string, limits Limits) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	return NewWithLimits(ctx, limits).Eval(program, env)
+}
+
+func testParse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+// シードがseedのSchedulerでinputを評価する
+func testEvalScheduled(input string, seed int64) object.Object {
+	return NewScheduler(seed).Run(New(), testParse(input), object.NewEnvironment())
+}
+
+// fileにあるスクリプトとしてinputを評価する
+func testEvalFile(file string, loader *ModuleLoader, input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+	env.SetFile(file)
+
+	e := New()
+	e.Modules = loader
+	return e.Eval(program, env)
+}
+
+// expectedの型に合わせて結果を検査する
+// stringはエラーなら"Kind: Message"、そうでなければ文字列の値と比べる。[]interface{}は配列の要素ごとに比べる
+func testObject(t *testing.T, input string, obj object.Object, expected interface{}) bool {
+	switch expected := expected.(type) {
+	case nil:
+		return testNullObject(t, obj)
+	case int:
+		return testIntegerObject(t, obj, int64(expected))
+	case float64:
+		f, ok := obj.(*object.Float)
+		if !ok {
+			t.Errorf("object is not Float for %q. got=%T (%+v)", input, obj, obj)
+			return false
+		}
+		if f.Value != expected {
+			t.Errorf("wrong value for %q. expected=%g, got=%g", input, expected, f.Value)
+			return false
+		}
+		return true
+	case bool:
+		return testBooleanObject(t, obj, expected)
+	case string:
+		if errObj, ok := obj.(*object.Error); ok {
+			if got := errObj.Kind + ": " + errObj.Message; got != expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", input, expected, got)
+				return false
+			}
+			return true
+		}
+		str, ok := obj.(*object.String)
+		if !ok {
+			t.Errorf("object is not String for %q. got=%T (%+v)", input, obj, obj)
+			return false
+		}
+		if str.Value != expected {
+			t.Errorf("wrong value for %q. expected=%q, got=%q", input, expected, str.Value)
+			return false
+		}
+		return true
+	case []interface{}:
+		arr, ok := obj.(*object.Array)
+		if !ok {
+			t.Errorf("object is not Array for %q. got=%T (%+v)", input, obj, obj)
+			return false
+		}
+		if len(arr.Elements) != len(expected) {
+			t.Errorf("wrong number of elements for %q. want=%d, got=%d (%s)",
+				input, len(expected), len(arr.Elements), arr.Inspect())
+			return false
+		}
+		for i, el := range expected {
+			if !testObject(t, input, arr.Elements[i], el) {
+				return false
+			}
+		}
+		return true
+	default:
+		t.Fatalf("unsupported expected type %T", expected)
+		return false
+	}
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d",
+			result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != NULL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
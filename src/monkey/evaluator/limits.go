@@ -0,0 +1,227 @@
+package evaluator
+
+import (
+	"context"
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+	"sync/atomic"
+)
+
+// Limits.MaxDepthが0のときの呼び出しの深さの上限
+// これがないと再帰が止まらないスクリプトでGoのスタックが溢れてプロセスごと落ちる
+const DefaultMaxDepth = 10000
+
+// 1回の実行に課す制限。0の項目は制限しない(MaxDepthだけはDefaultMaxDepthになる)
+// どれかを超えると、種類ごとに別のkindを持つエラーで評価を打ち切る。エラーはcatchできる
+//
+// ステップ数、割り当て、期限は一度超えると、その後のノードを評価するたびにまた同じエラーになる
+// そこで、これらのエラーを受け取ったcatchブロックとfinallyブロックだけは、graceStepsステップと
+// graceAllocバイトの猶予の中で評価する。猶予を使い切ると受け取ったエラーと同じ種類のエラーになり、
+// try式を抜けたあとは次のノードでまた制限のエラーになる。つまりハンドラで後始末や記録はできても、評価を続けることはできない
+type Limits struct {
+	MaxSteps int64 // 評価するノードの数の上限
+	MaxDepth int   // 関数呼び出しの深さの上限
+	MaxAlloc int64 // 作ったオブジェクトのおおよその合計バイト数の上限(解放された分も数える)
+}
+
+// ステップ数と割り当てたバイト数。spawnで起動したタスクも同じものに数えるので、制限は実行全体にかかる
+type usage struct {
+	steps int64
+	alloc int64
+}
+
+// 制限を超えたエラーをcatchしたハンドラに与える猶予
+const (
+	graceSteps = 1000
+	graceAlloc = 1 << 16
+)
+
+// ハンドラの猶予の残り
+// 猶予の中では制限と期限を確かめない代わりに、使い切ったらcauseと同じ種類のエラーにする
+type grace struct {
+	cause *object.Error
+	steps int64
+	alloc int64
+}
+
+func (g *grace) exceeded(e *Evaluator, tok token.Token) *object.Error {
+	return e.newError(tok, g.cause.Kind, "%s (in error handler)", g.cause.Message)
+}
+
+// 一度超えるとその後も超えたままになる制限のエラーか。呼び出しの深さは戻れば元に戻るので含めない
+func isLimitError(err *object.Error) bool {
+	switch err.Kind {
+	case object.STEP_LIMIT_ERROR, object.MEMORY_LIMIT_ERROR, object.TIMEOUT_ERROR, object.CANCELLED_ERROR:
+		return true
+	default:
+		return false
+	}
+}
+
+func (e *Evaluator) step(node ast.Node) *object.Error {
+	steps := atomic.AddInt64(&e.usage.steps, 1)
+
+	if g := e.grace; g != nil {
+		g.steps--
+		if g.steps < 0 {
+			return g.exceeded(e, tokenOf(node))
+		}
+		e.preempt()
+		return nil
+	}
+
+	if e.limits.MaxSteps > 0 && steps > e.limits.MaxSteps {
+		return e.newError(tokenOf(node), object.STEP_LIMIT_ERROR,
+			"step limit exceeded: %d", e.limits.MaxSteps)
+	}
+	e.preempt()
+
+	// Goの組み込み関数の中で止まっている間は中断できない
+	select {
+	case <-e.ctx.Done():
+		return e.interrupted(tokenOf(node))
+	default:
+		return nil
+	}
+}
+
+// ctxがキャンセルされたか期限を過ぎたときのエラー
+func (e *Evaluator) interrupted(tok token.Token) *object.Error {
+	if e.ctx.Err() == context.DeadlineExceeded {
+		return e.newError(tok, object.TIMEOUT_ERROR, "deadline exceeded")
+	}
+	return e.newError(tok, object.CANCELLED_ERROR, "evaluation cancelled")
+}
+
+func (e *Evaluator) checkDepth(tok token.Token, fn *object.Function) *object.Error {
+	max := e.limits.MaxDepth
+	if max == 0 {
+		max = DefaultMaxDepth
+	}
+
+	if len(e.stack) >= max {
+		return e.newError(tok, object.RECURSION_ERROR,
+			"maximum call depth exceeded: %d calling %s", max, functionName(fn))
+	}
+	return nil
+}
+
+func (e *Evaluator) charge(node ast.Node, size int64) *object.Error {
+	return e.chargeToken(tokenOf(node), size)
+}
+
+func (e *Evaluator) chargeToken(tok token.Token, size int64) *object.Error {
+	alloc := atomic.AddInt64(&e.usage.alloc, size)
+
+	if g := e.grace; g != nil {
+		g.alloc -= size
+		if g.alloc < 0 {
+			return g.exceeded(e, tok)
+		}
+		return nil
+	}
+
+	if e.limits.MaxAlloc > 0 && alloc > e.limits.MaxAlloc {
+		return e.newError(tok, object.MEMORY_LIMIT_ERROR,
+			"allocation limit exceeded: %d bytes", e.limits.MaxAlloc)
+	}
+	return nil
+}
+
+// 評価すると新しいオブジェクトを作るノードか
+// 変数の参照などは既存のオブジェクトを返すだけなので数えない
+func allocates(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.ArrayLiteral, *ast.HashLiteral, *ast.FunctionLiteral,
+		*ast.PrefixExpression, *ast.InfixExpression:
+		return true
+	default:
+		return false
+	}
+}
+
+// オブジェクトのおおよそのサイズ(バイト)。要素の中身は作られたときに数えているので含めない
+func sizeOf(obj object.Object) int64 {
+	switch obj := obj.(type) {
+	case nil:
+		return 0
+	case *object.Boolean, *object.Null:
+		return 0
+	case *object.String:
+		return 16 + int64(len(obj.Value))
+	case *object.Array:
+		return 24 + 16*int64(len(obj.Elements))
+	case *object.Hash:
+		return 48 + 48*int64(len(obj.Pairs))
+	case *object.Function:
+		return 64
+	default:
+		return 16
+	}
+}
+
+// 関数呼び出しで作る環境のおおよそのサイズ
+func envSize(params int) int64 {
+	return 64 + 32*int64(params)
+}
+
+// ast.Nodeは位置を持たないので、ノードのトークンを取り出す
+func tokenOf(node ast.Node) token.Token {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		return node.Token
+	case *ast.ReturnStatement:
+		return node.Token
+	case *ast.ExpressionStatement:
+		return node.Token
+	case *ast.BlockStatement:
+		return node.Token
+	case *ast.ThrowStatement:
+		return node.Token
+	case *ast.Identifier:
+		return node.Token
+	case *ast.IntegerLiteral:
+		return node.Token
+	case *ast.FloatLiteral:
+		return node.Token
+	case *ast.StringLiteral:
+		return node.Token
+	case *ast.Boolean:
+		return node.Token
+	case *ast.ArrayLiteral:
+		return node.Token
+	case *ast.HashLiteral:
+		return node.Token
+	case *ast.HashPair:
+		return node.Token
+	case *ast.PrefixExpression:
+		return node.Token
+	case *ast.InfixExpression:
+		return node.Token
+	case *ast.IfExpression:
+		return node.Token
+	case *ast.TryExpression:
+		return node.Token
+	case *ast.SpawnExpression:
+		return node.Token
+	case *ast.SelectExpression:
+		return node.Token
+	case *ast.SelectCase:
+		return node.Token
+	case *ast.FunctionLiteral:
+		return node.Token
+	case *ast.CallExpression:
+		return node.Token
+	case *ast.IndexExpression:
+		return node.Token
+	case *ast.ImportStatement:
+		return node.Token
+	case *ast.ExportStatement:
+		return node.Token
+	case *ast.MemberExpression:
+		return node.Token
+	default:
+		return token.Token{}
+	}
+}
@@ -0,0 +1,385 @@
+package evaluator
+
+import (
+	"errors"
+	"io/ioutil"
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// import "fs" as fs; で読み込むファイル操作のモジュール
+// スクリプトに勝手にホストのファイルを触らせないように、RegisterModuleでは登録しない
+// 使う側がModuleLoader.Sandbox(importで読むファイルもまとめて制限する)か、
+// ModuleLoader.Register("fs", FSExports(...))で、ファイルシステムと触れてよいディレクトリを選んで登録する
+
+// fsモジュールが読み書きするファイルシステム
+// パスはAbsで絶対パスにしてから渡す
+type FileSystem interface {
+	// 相対パスを絶対パスにする。rootsと比べるのはこのパス
+	Abs(name string) (string, error)
+
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte) error
+
+	// ディレクトリの中の名前を辞書順に返す
+	ReadDir(name string) ([]string, error)
+
+	Exists(name string) (bool, error)
+
+	// 途中のディレクトリもまとめて作る。すでにあればなにもしない
+	MkdirAll(name string) error
+}
+
+// OSのファイルシステム
+type OSFileSystem struct{}
+
+// シンボリックリンクをたどった先のパスを返すので、リンクを使ってrootsの外には出られない
+// まだないファイルは、あるディレクトリまで遡ってたどる
+func (OSFileSystem) Abs(name string) (string, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+
+	dir, rest := abs, ""
+	for {
+		real, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return abs, nil
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+		dir = parent
+	}
+}
+
+func (OSFileSystem) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+
+func (OSFileSystem) WriteFile(name string, data []byte) error {
+	return ioutil.WriteFile(name, data, 0666)
+}
+
+func (OSFileSystem) ReadDir(name string) ([]string, error) {
+	infos, err := ioutil.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+	}
+	return names, nil
+}
+
+func (OSFileSystem) Exists(name string) (bool, error) {
+	_, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (OSFileSystem) MkdirAll(name string) error {
+	return os.MkdirAll(name, 0777)
+}
+
+// どのファイルにも触れられないファイルシステム。monkey.Newの既定で、読み書きはすべて権限のエラーになる
+type NoFileSystem struct{}
+
+func (NoFileSystem) Abs(name string) (string, error) {
+	return filepath.Abs(name)
+}
+
+func (NoFileSystem) ReadFile(name string) ([]byte, error) {
+	return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+}
+
+func (NoFileSystem) WriteFile(name string, data []byte) error {
+	return &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+}
+
+func (NoFileSystem) ReadDir(name string) ([]string, error) {
+	return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+}
+
+func (NoFileSystem) Exists(name string) (bool, error) {
+	return false, &os.PathError{Op: "stat", Path: name, Err: os.ErrPermission}
+}
+
+func (NoFileSystem) MkdirAll(name string) error {
+	return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrPermission}
+}
+
+var (
+	errIsDir  = errors.New("is a directory")
+	errNotDir = errors.New("not a directory")
+)
+
+// メモリ上のファイルシステム。テストや、スクリプトにディスクを触らせたくないときに使う
+// 最初はルートディレクトリだけがある
+type MemFS struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+	dirs  map[string]bool
+}
+
+func NewMemFS() *MemFS {
+	return &MemFS{
+		files: map[string][]byte{},
+		dirs:  map[string]bool{string(filepath.Separator): true},
+	}
+}
+
+// 相対パスはルートディレクトリから数える
+func (m *MemFS) Abs(name string) (string, error) {
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(string(filepath.Separator), name)
+	}
+	return filepath.Clean(name), nil
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.dirs[name] {
+		return nil, &os.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+	data, ok := m.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (m *MemFS) WriteFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.dirs[name] {
+		return &os.PathError{Op: "open", Path: name, Err: errIsDir}
+	}
+	if !m.dirs[filepath.Dir(name)] {
+		return &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	m.files[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.dirs[name] {
+		if _, ok := m.files[name]; ok {
+			return nil, &os.PathError{Op: "readdirent", Path: name, Err: errNotDir}
+		}
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+
+	var names []string
+	for file := range m.files {
+		if filepath.Dir(file) == name {
+			names = append(names, filepath.Base(file))
+		}
+	}
+	for dir := range m.dirs {
+		if dir != name && filepath.Dir(dir) == name {
+			names = append(names, filepath.Base(dir))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *MemFS) Exists(name string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.files[name]
+	return ok || m.dirs[name], nil
+}
+
+func (m *MemFS) MkdirAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var dirs []string
+	for dir := name; !m.dirs[dir]; dir = filepath.Dir(dir) {
+		if _, ok := m.files[dir]; ok {
+			return &os.PathError{Op: "mkdir", Path: dir, Err: errNotDir}
+		}
+		dirs = append(dirs, dir)
+	}
+	for _, dir := range dirs {
+		m.dirs[dir] = true
+	}
+	return nil
+}
+
+// fsモジュールのexportを作る
+// rootsを渡すと、そのディレクトリの中のパスにしか触れられなくなる。外のパスを渡すとPermissionError
+// rootsを省略すると制限しない。importも同じように制限するには、代わりにModuleLoader.Sandboxを使う
+func FSExports(fsys FileSystem, roots ...string) map[string]object.Object {
+	m := &fsModule{fs: fsys, roots: roots}
+	return BuiltinExports(map[string]object.BuiltinFunction{
+		"readFile":  m.readFile,
+		"writeFile": m.writeFile,
+		"readLines": m.readLines,
+		"listDir":   m.listDir,
+		"exists":    m.exists,
+		"mkdir":     m.mkdir,
+	})
+}
+
+type fsModule struct {
+	fs    FileSystem
+	roots []string
+}
+
+// 引数の数と型を検査し、1つ目の引数のパスを絶対パスにして返す
+func (m *fsModule) pathArg(name string, args []object.Object, types ...object.ObjectType) (string, *object.Error) {
+	types = append([]object.ObjectType{object.STRING_OBJ}, types...)
+	if err := object.CheckArgTypes(name, args, types...); err != nil {
+		return "", err
+	}
+
+	path, err := m.fs.Abs(stringArg(args, 0))
+	if err != nil {
+		return "", ioError(name, err)
+	}
+	if !m.allowed(path) {
+		return "", object.NewError(object.PERMISSION_ERROR, "%s: access denied: %s", name, path)
+	}
+	return path, nil
+}
+
+func (m *fsModule) allowed(path string) bool {
+	return withinRoots(m.fs, m.roots, path)
+}
+
+// pathがrootsのどれかの中にあるか。rootsが空なら制限しない
+func withinRoots(fsys FileSystem, roots []string, path string) bool {
+	if len(roots) == 0 {
+		return true
+	}
+
+	for _, root := range roots {
+		root, err := fsys.Abs(root)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(root, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func ioError(name string, err error) *object.Error {
+	return object.NewError(object.IO_ERROR, "%s: %s", name, err)
+}
+
+func (m *fsModule) readFile(args ...object.Object) object.Object {
+	path, err := m.pathArg("fs.readFile", args)
+	if err != nil {
+		return err
+	}
+
+	data, ioErr := m.fs.ReadFile(path)
+	if ioErr != nil {
+		return ioError("fs.readFile", ioErr)
+	}
+	return &object.String{Value: string(data)}
+}
+
+// ファイルがあれば中身を置き換える。ディレクトリは作らないので、先にmkdirしておく
+func (m *fsModule) writeFile(args ...object.Object) object.Object {
+	path, err := m.pathArg("fs.writeFile", args, object.STRING_OBJ)
+	if err != nil {
+		return err
+	}
+
+	if ioErr := m.fs.WriteFile(path, []byte(stringArg(args, 1))); ioErr != nil {
+		return ioError("fs.writeFile", ioErr)
+	}
+	return NULL
+}
+
+// 行ごとに分けた配列を返す。行末の改行(\r\nも)は含まない
+func (m *fsModule) readLines(args ...object.Object) object.Object {
+	path, err := m.pathArg("fs.readLines", args)
+	if err != nil {
+		return err
+	}
+
+	data, ioErr := m.fs.ReadFile(path)
+	if ioErr != nil {
+		return ioError("fs.readLines", ioErr)
+	}
+
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return &object.Array{Elements: []object.Object{}}
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return stringArray(lines)
+}
+
+// ディレクトリの中のファイルとディレクトリの名前を辞書順に返す
+func (m *fsModule) listDir(args ...object.Object) object.Object {
+	path, err := m.pathArg("fs.listDir", args)
+	if err != nil {
+		return err
+	}
+
+	names, ioErr := m.fs.ReadDir(path)
+	if ioErr != nil {
+		return ioError("fs.listDir", ioErr)
+	}
+	return stringArray(names)
+}
+
+func (m *fsModule) exists(args ...object.Object) object.Object {
+	path, err := m.pathArg("fs.exists", args)
+	if err != nil {
+		return err
+	}
+
+	ok, ioErr := m.fs.Exists(path)
+	if ioErr != nil {
+		return ioError("fs.exists", ioErr)
+	}
+	return nativeBoolToBooleanObject(ok)
+}
+
+// 途中のディレクトリもまとめて作る。すでにあればなにもしない
+func (m *fsModule) mkdir(args ...object.Object) object.Object {
+	path, err := m.pathArg("fs.mkdir", args)
+	if err != nil {
+		return err
+	}
+
+	if ioErr := m.fs.MkdirAll(path); ioErr != nil {
+		return ioError("fs.mkdir", ioErr)
+	}
+	return NULL
+}
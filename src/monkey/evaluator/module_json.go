@@ -0,0 +1,185 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"monkey/object"
+	"strings"
+)
+
+// import "json" as json; で読み込むJSONのモジュール
+//
+// JSONとMonkeyの値は次のように対応する
+//
+//	object -> HASH(キーはSTRING)  array -> ARRAY  string -> STRING
+//	整数 -> INTEGER  小数や指数のある数 -> FLOAT  true/false -> BOOLEAN  null -> NULL
+//
+// FLOATは整数の値でも小数点を付けて書き出すので、stringifyしてparseすると同じ型に戻る
+func init() {
+	RegisterModule("json", BuiltinExports(map[string]object.BuiltinFunction{
+		"parse":     jsonParse,
+		"stringify": jsonStringify,
+	}))
+}
+
+func jsonParse(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("json.parse", args, object.STRING_OBJ); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(strings.NewReader(stringArg(args, 0)))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return object.NewError(object.VALUE_ERROR, "json.parse: %s", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return object.NewError(object.VALUE_ERROR, "json.parse: unexpected data after top-level value")
+	}
+
+	return fromJSON(value)
+}
+
+func fromJSON(value interface{}) object.Object {
+	switch value := value.(type) {
+	case nil:
+		return NULL
+	case bool:
+		return nativeBoolToBooleanObject(value)
+	case string:
+		return &object.String{Value: value}
+	case json.Number:
+		// 整数として読めなければ(小数や大きすぎる数)浮動小数点数にする
+		if i, err := value.Int64(); err == nil {
+			return &object.Integer{Value: i}
+		}
+		f, err := value.Float64()
+		if err != nil {
+			return object.NewError(object.VALUE_ERROR, "json.parse: number out of range: %s", value)
+		}
+		return &object.Float{Value: f}
+	case []interface{}:
+		elements := make([]object.Object, len(value))
+		for i, el := range value {
+			elements[i] = fromJSON(el)
+			if isError(elements[i]) {
+				return elements[i]
+			}
+		}
+		return &object.Array{Elements: elements}
+	case map[string]interface{}:
+		pairs := make(map[object.HashKey]object.HashPair, len(value))
+		for k, v := range value {
+			key := &object.String{Value: k}
+			val := fromJSON(v)
+			if isError(val) {
+				return val
+			}
+			pairs[key.HashKey()] = object.HashPair{Key: key, Value: val}
+		}
+		return &object.Hash{Pairs: pairs}
+	default:
+		return NULL
+	}
+}
+
+// 字下げに使える空白の数。字下げは入れ子の深さだけ繰り返すので、大きすぎると文字列がいくらでも長くなる
+const maxJSONIndent = 16
+
+// indentを渡すとその数の空白で字下げして複数行にする。省略するか0なら1行にする。indentは16まで
+// ハッシュのキーは辞書順に並べるので、同じ値からは常に同じ文字列ができる
+func jsonStringify(args ...object.Object) object.Object {
+	if err := object.CheckOptionalArgTypes("json.stringify", args, 1, object.ANY_OBJ, object.INTEGER_OBJ); err != nil {
+		return err
+	}
+
+	var indent int64
+	if len(args) == 2 {
+		indent = args[1].(*object.Integer).Value
+		if indent < 0 {
+			return object.NewError(object.VALUE_ERROR, "json.stringify: negative indent: %d", indent)
+		}
+		if indent > maxJSONIndent {
+			return object.NewError(object.VALUE_ERROR, "json.stringify: indent too large: %d (max %d)", indent, maxJSONIndent)
+		}
+	}
+
+	value, err := toJSON(args[0], map[object.Object]bool{})
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", strings.Repeat(" ", int(indent)))
+	if err := enc.Encode(value); err != nil {
+		return object.NewError(object.VALUE_ERROR, "json.stringify: %s", err)
+	}
+
+	return &object.String{Value: strings.TrimSuffix(out.String(), "\n")}
+}
+
+// Monkeyの値をencoding/jsonで書き出せる値にする
+// seenには今たどっている配列とハッシュが入り、自分自身を含む値を見つけるのに使う
+func toJSON(obj object.Object, seen map[object.Object]bool) (interface{}, *object.Error) {
+	switch obj := obj.(type) {
+	case *object.Null:
+		return nil, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.Float:
+		if math.IsNaN(obj.Value) || math.IsInf(obj.Value, 0) {
+			return nil, object.NewError(object.VALUE_ERROR, "json.stringify: cannot encode %s", obj.Inspect())
+		}
+		// 1.0を1と書くとparseしたときにINTEGERになるので、Inspectと同じく小数点を残す
+		return json.Number(obj.Inspect()), nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Array:
+		if seen[obj] {
+			return nil, object.NewError(object.VALUE_ERROR, "json.stringify: cyclic structure")
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+
+		values := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			value, err := toJSON(el, seen)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	case *object.Hash:
+		if seen[obj] {
+			return nil, object.NewError(object.VALUE_ERROR, "json.stringify: cyclic structure")
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+
+		// encoding/jsonはmapのキーを辞書順に並べて書き出す
+		values := make(map[string]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			key, ok := pair.Key.(*object.String)
+			if !ok {
+				return nil, object.NewError(object.TYPE_ERROR, "json.stringify: hash key must be STRING, got %s",
+					pair.Key.Type())
+			}
+			value, err := toJSON(pair.Value, seen)
+			if err != nil {
+				return nil, err
+			}
+			values[key.Value] = value
+		}
+		return values, nil
+	default:
+		return nil, object.NewError(object.TYPE_ERROR, "json.stringify: cannot encode %s", obj.Type())
+	}
+}
@@ -0,0 +1,338 @@
+package evaluator
+
+import (
+	"math"
+	"math/big"
+	"monkey/object"
+	"strings"
+)
+
+// import "math" as m; で読み込む数学関数のモジュール
+// 引数はINTEGERでもFLOATでもよい。定義域の外の値を渡すとValueErrorになる
+func init() {
+	exports := BuiltinExports(map[string]object.BuiltinFunction{
+		"abs":   mathAbs,
+		"min":   mathMin,
+		"max":   mathMax,
+		"clamp": mathClamp,
+		"pow":   mathPow,
+		"sqrt":  floatFunc("math.sqrt", math.Sqrt, func(x float64) bool { return x >= 0 }),
+		"exp":   floatFunc("math.exp", math.Exp, nil),
+		"log":   mathLog,
+		"log2":  floatFunc("math.log2", math.Log2, positive),
+		"log10": floatFunc("math.log10", math.Log10, positive),
+		"sin":   floatFunc("math.sin", math.Sin, finite),
+		"cos":   floatFunc("math.cos", math.Cos, finite),
+		"tan":   floatFunc("math.tan", math.Tan, finite),
+		"asin":  floatFunc("math.asin", math.Asin, unitRange),
+		"acos":  floatFunc("math.acos", math.Acos, unitRange),
+		"atan":  floatFunc("math.atan", math.Atan, nil),
+		"atan2": mathAtan2,
+		"floor": roundFunc("math.floor", math.Floor),
+		"ceil":  roundFunc("math.ceil", math.Ceil),
+		"round": roundFunc("math.round", math.Round),
+		"gcd":   mathGcd,
+		"div":   mathDiv,
+		"mod":   mathMod,
+		"rem":   mathRem,
+	})
+	exports["pi"] = &object.Float{Value: math.Pi}
+	exports["e"] = &object.Float{Value: math.E}
+
+	RegisterModule("math", exports)
+}
+
+func positive(x float64) bool  { return x > 0 }
+func finite(x float64) bool    { return !math.IsInf(x, 0) }
+func unitRange(x float64) bool { return -1 <= x && x <= 1 }
+
+// 定義域の外の引数で呼ばれたときのエラー
+func domainError(name string, args ...object.Object) *object.Error {
+	return object.NewError(object.VALUE_ERROR, "math domain error: %s", callString(name, args))
+}
+
+// 結果が大きすぎて表せないときのエラー
+func rangeError(name string, args ...object.Object) *object.Error {
+	return object.NewError(object.VALUE_ERROR, "math range error: %s", callString(name, args))
+}
+
+func overflowError(name string, args ...object.Object) *object.Error {
+	return object.NewError(object.VALUE_ERROR, "integer overflow: %s", callString(name, args))
+}
+
+func callString(name string, args []object.Object) string {
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = arg.Inspect()
+	}
+	return name + "(" + strings.Join(values, ", ") + ")"
+}
+
+// 引数の数と、すべてがINTEGERかFLOATであることを検査する
+func checkNumbers(name string, args []object.Object, min, max int) *object.Error {
+	if err := object.CheckArgRange(name, args, min, max); err != nil {
+		return err
+	}
+
+	for i, arg := range args {
+		if !isNumber(arg) {
+			return object.NewError(object.TYPE_ERROR, "argument %d to %s must be INTEGER or FLOAT, got %s",
+				i+1, name, arg.Type())
+		}
+	}
+	return nil
+}
+
+// 浮動小数点数を1つ受け取ってFLOATを返す関数を作る
+// inDomainがfalseを返す引数や、結果がNaNになる引数は定義域エラーにする
+func floatFunc(name string, f func(float64) float64, inDomain func(float64) bool) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if err := checkNumbers(name, args, 1, 1); err != nil {
+			return err
+		}
+
+		x, _ := toFloat(args[0])
+		if inDomain != nil && !inDomain(x) {
+			return domainError(name, args...)
+		}
+		return floatResult(name, f(x), args)
+	}
+}
+
+func floatResult(name string, result float64, args []object.Object) object.Object {
+	if math.IsNaN(result) {
+		return domainError(name, args...)
+	}
+	if math.IsInf(result, 0) {
+		return rangeError(name, args...)
+	}
+	return &object.Float{Value: result}
+}
+
+func mathAbs(args ...object.Object) object.Object {
+	if err := checkNumbers("math.abs", args, 1, 1); err != nil {
+		return err
+	}
+
+	switch arg := args[0].(type) {
+	case *object.Integer:
+		if arg.Value == math.MinInt64 {
+			return overflowError("math.abs", args...)
+		}
+		if arg.Value < 0 {
+			return &object.Integer{Value: -arg.Value}
+		}
+		return arg
+	default:
+		x, _ := toFloat(arg)
+		return &object.Float{Value: math.Abs(x)}
+	}
+}
+
+// 引数のうち最小(最大)のものをそのまま返す。INTEGERとFLOATを混ぜてもよい
+func extremeFunc(name string, better func(x, y float64) bool) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if err := checkNumbers(name, args, 1, -1); err != nil {
+			return err
+		}
+
+		result := args[0]
+		best, _ := toFloat(result)
+		for _, arg := range args[1:] {
+			if x, _ := toFloat(arg); better(x, best) {
+				result, best = arg, x
+			}
+		}
+		return result
+	}
+}
+
+var (
+	mathMin = extremeFunc("math.min", func(x, y float64) bool { return x < y })
+	mathMax = extremeFunc("math.max", func(x, y float64) bool { return x > y })
+)
+
+// xをlo以上hi以下に収める
+func mathClamp(args ...object.Object) object.Object {
+	if err := checkNumbers("math.clamp", args, 3, 3); err != nil {
+		return err
+	}
+
+	x, _ := toFloat(args[0])
+	lo, _ := toFloat(args[1])
+	hi, _ := toFloat(args[2])
+	switch {
+	case lo > hi:
+		return object.NewError(object.VALUE_ERROR, "math.clamp: lower bound %s is greater than upper bound %s",
+			args[1].Inspect(), args[2].Inspect())
+	case x < lo:
+		return args[1]
+	case x > hi:
+		return args[2]
+	default:
+		return args[0]
+	}
+}
+
+// 整数の0以上の整数乗はINTEGER、それ以外はFLOATを返す
+func mathPow(args ...object.Object) object.Object {
+	if err := checkNumbers("math.pow", args, 2, 2); err != nil {
+		return err
+	}
+
+	base, baseIsInt := args[0].(*object.Integer)
+	exp, expIsInt := args[1].(*object.Integer)
+	if baseIsInt && expIsInt && exp.Value >= 0 {
+		return intPow(base.Value, exp.Value, args)
+	}
+
+	x, _ := toFloat(args[0])
+	y, _ := toFloat(args[1])
+	if x == 0 && y < 0 {
+		return object.NewError(object.ZERO_DIVISION_ERROR, "zero to a negative power: %s",
+			callString("math.pow", args))
+	}
+	return floatResult("math.pow", math.Pow(x, y), args)
+}
+
+func intPow(base, exp int64, args []object.Object) object.Object {
+	// 2以上の数の64乗以上は必ず溢れるので、大きな数を計算する前に弾く
+	if exp >= 64 && (base < -1 || base > 1) {
+		return overflowError("math.pow", args...)
+	}
+
+	result := new(big.Int).Exp(big.NewInt(base), big.NewInt(exp), nil)
+	if !result.IsInt64() {
+		return overflowError("math.pow", args...)
+	}
+	return &object.Integer{Value: result.Int64()}
+}
+
+// 底を省略すると自然対数
+func mathLog(args ...object.Object) object.Object {
+	if err := checkNumbers("math.log", args, 1, 2); err != nil {
+		return err
+	}
+
+	x, _ := toFloat(args[0])
+	if x <= 0 {
+		return domainError("math.log", args...)
+	}
+	if len(args) == 1 {
+		return floatResult("math.log", math.Log(x), args)
+	}
+
+	base, _ := toFloat(args[1])
+	if base <= 0 || base == 1 {
+		return domainError("math.log", args...)
+	}
+	return floatResult("math.log", math.Log(x)/math.Log(base), args)
+}
+
+func mathAtan2(args ...object.Object) object.Object {
+	if err := checkNumbers("math.atan2", args, 2, 2); err != nil {
+		return err
+	}
+
+	y, _ := toFloat(args[0])
+	x, _ := toFloat(args[1])
+	return floatResult("math.atan2", math.Atan2(y, x), args)
+}
+
+// 浮動小数点数を整数に丸めてINTEGERを返す関数を作る。整数はそのまま返す
+// roundは0.5を0から遠いほうに丸める
+func roundFunc(name string, round func(float64) float64) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if err := checkNumbers(name, args, 1, 1); err != nil {
+			return err
+		}
+
+		if i, ok := args[0].(*object.Integer); ok {
+			return i
+		}
+
+		x := round(args[0].(*object.Float).Value)
+		if math.IsNaN(x) || x >= math.MaxInt64 || x < math.MinInt64 {
+			return object.NewError(object.VALUE_ERROR, "cannot convert %s to integer", args[0].Inspect())
+		}
+		return &object.Integer{Value: int64(x)}
+	}
+}
+
+// 最大公約数。結果は0以上で、gcd(0, 0)は0
+func mathGcd(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("math.gcd", args, object.INTEGER_OBJ, object.INTEGER_OBJ); err != nil {
+		return err
+	}
+
+	a := args[0].(*object.Integer).Value
+	b := args[1].(*object.Integer).Value
+	for b != 0 {
+		a, b = b, a%b
+	}
+	if a == math.MinInt64 {
+		return overflowError("math.gcd", args...)
+	}
+	if a < 0 {
+		a = -a
+	}
+	return &object.Integer{Value: a}
+}
+
+// 整数の割り算の引数を検査する。/演算子と同じく0で割るとZeroDivisionError
+func checkIntDivision(name string, args []object.Object) (int64, int64, *object.Error) {
+	if err := object.CheckArgTypes(name, args, object.INTEGER_OBJ, object.INTEGER_OBJ); err != nil {
+		return 0, 0, err
+	}
+
+	a := args[0].(*object.Integer).Value
+	b := args[1].(*object.Integer).Value
+	if b == 0 {
+		return 0, 0, object.NewError(object.ZERO_DIVISION_ERROR, "division by zero: %s", callString(name, args))
+	}
+	return a, b, nil
+}
+
+// 負の無限大の方向に丸める割り算。/演算子は0の方向に丸めるので、負の数では結果が違う
+// div(-7, 2)は-4
+func mathDiv(args ...object.Object) object.Object {
+	a, b, err := checkIntDivision("math.div", args)
+	if err != nil {
+		return err
+	}
+	// 剰余は0になるのでmodとremでは検査しない
+	if a == math.MinInt64 && b == -1 {
+		return overflowError("math.div", args...)
+	}
+
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return &object.Integer{Value: q}
+}
+
+// divと組になる剰余。結果の符号はbと同じで、a == div(a, b) * b + mod(a, b)
+// mod(-7, 2)は1
+func mathMod(args ...object.Object) object.Object {
+	a, b, err := checkIntDivision("math.mod", args)
+	if err != nil {
+		return err
+	}
+
+	r := a % b
+	if r != 0 && ((r < 0) != (b < 0)) {
+		r += b
+	}
+	return &object.Integer{Value: r}
+}
+
+// /演算子と組になる剰余。結果の符号はaと同じで、a == (a / b) * b + rem(a, b)
+// rem(-7, 2)は-1
+func mathRem(args ...object.Object) object.Object {
+	a, b, err := checkIntDivision("math.rem", args)
+	if err != nil {
+		return err
+	}
+	return &object.Integer{Value: a % b}
+}
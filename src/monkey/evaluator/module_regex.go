@@ -0,0 +1,186 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"regexp"
+	"strings"
+)
+
+// import "regex" as re; で読み込む正規表現のモジュール。構文はGoのregexpと同じ
+// パターンを受け取る引数にはre.compileで作ったREGEXのほか、その場でコンパイルするSTRINGも渡せる
+func init() {
+	RegisterModule("regex", BuiltinExports(map[string]object.BuiltinFunction{
+		"compile":      regexCompile,
+		"match":        regexMatch,
+		"find":         regexFind,
+		"findAll":      regexFindAll,
+		"findSubmatch": regexFindSubmatch,
+		"groups":       regexGroups,
+		"replace":      regexReplace,
+		"split":        regexSplit,
+	}))
+}
+
+func compileRegex(name, pattern string) (*regexp.Regexp, *object.Error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, object.NewError(object.VALUE_ERROR, "%s: %s", name, err)
+	}
+	return re, nil
+}
+
+// 引数の数と型を検査し、1つ目の引数の正規表現を返す
+// typesは2つ目以降の引数の型で、最初のmin個(パターンを含む)が必須
+func regexArgs(name string, args []object.Object, min int, types ...object.ObjectType) (*regexp.Regexp, *object.Error) {
+	types = append([]object.ObjectType{object.ANY_OBJ}, types...)
+	if err := object.CheckOptionalArgTypes(name, args, min, types...); err != nil {
+		return nil, err
+	}
+
+	switch pattern := args[0].(type) {
+	case *object.Regex:
+		return pattern.Regexp, nil
+	case *object.String:
+		return compileRegex(name, pattern.Value)
+	default:
+		return nil, object.NewError(object.TYPE_ERROR, "argument 1 to %s must be REGEX or STRING, got %s",
+			name, args[0].Type())
+	}
+}
+
+// 省略できる個数の引数。省略するとすべて(-1)
+func countArg(args []object.Object, i int) int {
+	if len(args) > i {
+		return int(args[i].(*object.Integer).Value)
+	}
+	return -1
+}
+
+func regexCompile(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("regex.compile", args, object.STRING_OBJ); err != nil {
+		return err
+	}
+
+	re, err := compileRegex("regex.compile", stringArg(args, 0))
+	if err != nil {
+		return err
+	}
+	return &object.Regex{Regexp: re}
+}
+
+// sのどこかにマッチすればtrue
+func regexMatch(args ...object.Object) object.Object {
+	re, err := regexArgs("regex.match", args, 2, object.STRING_OBJ)
+	if err != nil {
+		return err
+	}
+	return nativeBoolToBooleanObject(re.MatchString(stringArg(args, 1)))
+}
+
+// 最初にマッチした部分。マッチしなければnull
+func regexFind(args ...object.Object) object.Object {
+	re, err := regexArgs("regex.find", args, 2, object.STRING_OBJ)
+	if err != nil {
+		return err
+	}
+
+	loc := re.FindStringIndex(stringArg(args, 1))
+	if loc == nil {
+		return NULL
+	}
+	return &object.String{Value: stringArg(args, 1)[loc[0]:loc[1]]}
+}
+
+// マッチした部分をすべて配列で返す。nを渡すと最初のn個まで
+func regexFindAll(args ...object.Object) object.Object {
+	re, err := regexArgs("regex.findAll", args, 2, object.STRING_OBJ, object.INTEGER_OBJ)
+	if err != nil {
+		return err
+	}
+	return stringArray(re.FindAllString(stringArg(args, 1), countArg(args, 2)))
+}
+
+// 最初のマッチ全体と、各グループにマッチした部分を配列で返す
+// マッチしなければnull、マッチに使われなかったグループはnullになる
+func regexFindSubmatch(args ...object.Object) object.Object {
+	re, err := regexArgs("regex.findSubmatch", args, 2, object.STRING_OBJ)
+	if err != nil {
+		return err
+	}
+
+	s := stringArg(args, 1)
+	loc := re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return NULL
+	}
+
+	elements := make([]object.Object, len(loc)/2)
+	for i := range elements {
+		elements[i] = submatch(s, loc, i)
+	}
+	return &object.Array{Elements: elements}
+}
+
+// 名前つきグループ(?P<name>...)にマッチした部分を、名前をキーにしたハッシュで返す
+// マッチしなければnull、マッチに使われなかったグループの値はnullになる
+func regexGroups(args ...object.Object) object.Object {
+	re, err := regexArgs("regex.groups", args, 2, object.STRING_OBJ)
+	if err != nil {
+		return err
+	}
+
+	s := stringArg(args, 1)
+	loc := re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return NULL
+	}
+
+	pairs := make(map[object.HashKey]object.HashPair)
+	for i, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		key := &object.String{Value: name}
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: submatch(s, loc, i)}
+	}
+	return &object.Hash{Pairs: pairs}
+}
+
+func submatch(s string, loc []int, i int) object.Object {
+	if loc[2*i] < 0 {
+		return NULL
+	}
+	return &object.String{Value: s[loc[2*i]:loc[2*i+1]]}
+}
+
+// マッチした部分をすべてreplで置き換える
+// replの中の$1や${name}はグループにマッチした部分になる。$そのものは$$と書く
+func regexReplace(args ...object.Object) object.Object {
+	re, err := regexArgs("regex.replace", args, 3, object.STRING_OBJ, object.STRING_OBJ)
+	if err != nil {
+		return err
+	}
+	s, repl := stringArg(args, 1), stringArg(args, 2)
+
+	// 置き換えた結果の長さの上限を見積もる。$で始まる参照は、どれもマッチした部分より長くはならない
+	// 見積もりのために作る文字列はsより長くならない
+	refs := int64(strings.Count(repl, "$"))
+	length := int64(len(s))
+	re.ReplaceAllStringFunc(s, func(match string) string {
+		length += int64(len(repl)) + refs*int64(len(match)) - int64(len(match))
+		return ""
+	})
+	if err := checkStringLength("regex.replace", length); err != nil {
+		return err
+	}
+	return &object.String{Value: re.ReplaceAllString(s, repl)}
+}
+
+// マッチした部分で区切った配列を返す。nを渡すと最大n個に分ける
+func regexSplit(args ...object.Object) object.Object {
+	re, err := regexArgs("regex.split", args, 2, object.STRING_OBJ, object.INTEGER_OBJ)
+	if err != nil {
+		return err
+	}
+	return stringArray(re.Split(stringArg(args, 1), countArg(args, 2)))
+}
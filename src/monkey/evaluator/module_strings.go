@@ -0,0 +1,301 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// import "strings" as s; で読み込む文字列操作のモジュール
+// 長さや位置はバイトではなく文字(rune)で数える
+func init() {
+	RegisterModule("strings", BuiltinExports(map[string]object.BuiltinFunction{
+		"split":      stringsSplit,
+		"join":       stringsJoin,
+		"trim":       stringsTrim,
+		"trimLeft":   stringsTrimLeft,
+		"trimRight":  stringsTrimRight,
+		"trimPrefix": stringsTrimPrefix,
+		"trimSuffix": stringsTrimSuffix,
+		"contains":   stringsContains,
+		"index":      stringsIndex,
+		"replace":    stringsReplace,
+		"upper":      stringsUpper,
+		"lower":      stringsLower,
+		"repeat":     stringsRepeat,
+		"startsWith": stringsStartsWith,
+		"endsWith":   stringsEndsWith,
+		"padLeft":    stringsPadLeft,
+		"padRight":   stringsPadRight,
+		"len":        stringsLen,
+		"slice":      stringsSlice,
+	}))
+}
+
+func stringArg(args []object.Object, i int) string {
+	return args[i].(*object.String).Value
+}
+
+func stringArray(values []string) *object.Array {
+	elements := make([]object.Object, len(values))
+	for i, v := range values {
+		elements[i] = &object.String{Value: v}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// sepが空文字列なら1文字ずつに分ける
+func stringsSplit(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("strings.split", args, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+		return err
+	}
+
+	return stringArray(strings.Split(stringArg(args, 0), stringArg(args, 1)))
+}
+
+func stringsJoin(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("strings.join", args, object.ARRAY_OBJ, object.STRING_OBJ); err != nil {
+		return err
+	}
+
+	elements := args[0].(*object.Array).Elements
+	values := make([]string, len(elements))
+	for i, el := range elements {
+		str, ok := el.(*object.String)
+		if !ok {
+			return object.NewError(object.TYPE_ERROR, "element %d to strings.join must be STRING, got %s",
+				i, el.Type())
+		}
+		values[i] = str.Value
+	}
+
+	sep := stringArg(args, 1)
+	if len(values) > 0 {
+		length := int64(len(sep)) * int64(len(values)-1)
+		for _, v := range values {
+			length += int64(len(v))
+		}
+		if err := checkStringLength("strings.join", length); err != nil {
+			return err
+		}
+	}
+	return &object.String{Value: strings.Join(values, sep)}
+}
+
+// cutsetを省略すると空白を取り除く
+func trimFunc(name string, trim func(s, cutset string) string, trimSpace func(string) string) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if err := object.CheckOptionalArgTypes(name, args, 1, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+			return err
+		}
+
+		if len(args) == 1 {
+			return &object.String{Value: trimSpace(stringArg(args, 0))}
+		}
+		return &object.String{Value: trim(stringArg(args, 0), stringArg(args, 1))}
+	}
+}
+
+var (
+	stringsTrim = trimFunc("strings.trim", strings.Trim, strings.TrimSpace)
+
+	stringsTrimLeft = trimFunc("strings.trimLeft", strings.TrimLeft, func(s string) string {
+		return strings.TrimLeftFunc(s, unicode.IsSpace)
+	})
+
+	stringsTrimRight = trimFunc("strings.trimRight", strings.TrimRight, func(s string) string {
+		return strings.TrimRightFunc(s, unicode.IsSpace)
+	})
+)
+
+// 2つの文字列を受け取って値を返す関数をまとめて作る
+func stringPairFunc(name string, f func(s, t string) object.Object) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if err := object.CheckArgTypes(name, args, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+			return err
+		}
+		return f(stringArg(args, 0), stringArg(args, 1))
+	}
+}
+
+var (
+	stringsTrimPrefix = stringPairFunc("strings.trimPrefix", func(s, prefix string) object.Object {
+		return &object.String{Value: strings.TrimPrefix(s, prefix)}
+	})
+
+	stringsTrimSuffix = stringPairFunc("strings.trimSuffix", func(s, suffix string) object.Object {
+		return &object.String{Value: strings.TrimSuffix(s, suffix)}
+	})
+
+	stringsContains = stringPairFunc("strings.contains", func(s, substr string) object.Object {
+		return nativeBoolToBooleanObject(strings.Contains(s, substr))
+	})
+
+	stringsStartsWith = stringPairFunc("strings.startsWith", func(s, prefix string) object.Object {
+		return nativeBoolToBooleanObject(strings.HasPrefix(s, prefix))
+	})
+
+	stringsEndsWith = stringPairFunc("strings.endsWith", func(s, suffix string) object.Object {
+		return nativeBoolToBooleanObject(strings.HasSuffix(s, suffix))
+	})
+
+	// 見つかった位置を文字数で返す。見つからなければ-1
+	stringsIndex = stringPairFunc("strings.index", func(s, substr string) object.Object {
+		i := strings.Index(s, substr)
+		if i < 0 {
+			return &object.Integer{Value: -1}
+		}
+		return &object.Integer{Value: int64(utf8.RuneCountInString(s[:i]))}
+	})
+)
+
+// nを省略するとすべて置き換える
+func stringsReplace(args ...object.Object) object.Object {
+	if err := object.CheckOptionalArgTypes("strings.replace", args, 3,
+		object.STRING_OBJ, object.STRING_OBJ, object.STRING_OBJ, object.INTEGER_OBJ); err != nil {
+		return err
+	}
+
+	s, old, repl := stringArg(args, 0), stringArg(args, 1), stringArg(args, 2)
+	n := -1
+	if len(args) == 4 {
+		n = int(args[3].(*object.Integer).Value)
+	}
+
+	// oldが空なら、各文字の前と末尾に入れる
+	count := strings.Count(s, old)
+	if n >= 0 && n < count {
+		count = n
+	}
+	length := int64(len(s)) + int64(count)*(int64(len(repl))-int64(len(old)))
+	if err := checkStringLength("strings.replace", length); err != nil {
+		return err
+	}
+	return &object.String{Value: strings.Replace(s, old, repl, n)}
+}
+
+func stringsUpper(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("strings.upper", args, object.STRING_OBJ); err != nil {
+		return err
+	}
+	return &object.String{Value: strings.ToUpper(stringArg(args, 0))}
+}
+
+func stringsLower(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("strings.lower", args, object.STRING_OBJ); err != nil {
+		return err
+	}
+	return &object.String{Value: strings.ToLower(stringArg(args, 0))}
+}
+
+// repeatやpadLeftで一度に作れる文字列のバイト数。作る前に検査して、ホストのメモリを使い果たさないようにする
+// MaxAllocは作ったあとで数えるので、1回のGoの呼び出しで大きな文字列を作られると間に合わない
+const maxStringLength = 1 << 28
+
+// 作ろうとしている文字列の長さlengthを確かめる
+func checkStringLength(name string, length int64) *object.Error {
+	if length > maxStringLength {
+		return object.NewError(object.VALUE_ERROR, "%s: result too long: %d bytes", name, length)
+	}
+	return nil
+}
+
+func stringsRepeat(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("strings.repeat", args, object.STRING_OBJ, object.INTEGER_OBJ); err != nil {
+		return err
+	}
+
+	count := args[1].(*object.Integer).Value
+	if count < 0 {
+		return object.NewError(object.VALUE_ERROR, "negative repeat count: %d", count)
+	}
+	s := stringArg(args, 0)
+	if len(s) > 0 && count > maxStringLength/int64(len(s)) {
+		return object.NewError(object.VALUE_ERROR, "repeat result too long: %d * %d bytes", count, len(s))
+	}
+	return &object.String{Value: strings.Repeat(s, int(count))}
+}
+
+// 文字数がwidthになるまでpad(省略すると空白)を繰り返して詰める
+func padFunc(name string, left bool) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if err := object.CheckOptionalArgTypes(name, args, 2,
+			object.STRING_OBJ, object.INTEGER_OBJ, object.STRING_OBJ); err != nil {
+			return err
+		}
+
+		s := stringArg(args, 0)
+		pad := " "
+		if len(args) == 3 {
+			pad = stringArg(args, 2)
+		}
+		if pad == "" {
+			return object.NewError(object.VALUE_ERROR, "%s: pad must not be empty", name)
+		}
+
+		width := args[1].(*object.Integer).Value
+		if width > maxStringLength/utf8.UTFMax {
+			return object.NewError(object.VALUE_ERROR, "%s: width too large: %d", name, width)
+		}
+
+		n := int(width) - utf8.RuneCountInString(s)
+		if n <= 0 {
+			return &object.String{Value: s}
+		}
+
+		padRunes := []rune(strings.Repeat(pad, n/utf8.RuneCountInString(pad)+1))[:n]
+		if left {
+			return &object.String{Value: string(padRunes) + s}
+		}
+		return &object.String{Value: s + string(padRunes)}
+	}
+}
+
+var (
+	stringsPadLeft  = padFunc("strings.padLeft", true)
+	stringsPadRight = padFunc("strings.padRight", false)
+)
+
+// 組み込みのlenと違い、バイト数ではなく文字数を返す
+func stringsLen(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("strings.len", args, object.STRING_OBJ); err != nil {
+		return err
+	}
+	return &object.Integer{Value: int64(utf8.RuneCountInString(stringArg(args, 0)))}
+}
+
+// start文字目からend文字目の手前までを返す。endを省略すると最後まで
+// 負の位置は末尾から数え、範囲外の位置は端に丸める
+func stringsSlice(args ...object.Object) object.Object {
+	if err := object.CheckOptionalArgTypes("strings.slice", args, 2,
+		object.STRING_OBJ, object.INTEGER_OBJ, object.INTEGER_OBJ); err != nil {
+		return err
+	}
+
+	runes := []rune(stringArg(args, 0))
+	length := int64(len(runes))
+
+	start := clampIndex(args[1].(*object.Integer).Value, length)
+	end := length
+	if len(args) == 3 {
+		end = clampIndex(args[2].(*object.Integer).Value, length)
+	}
+	if start >= end {
+		return &object.String{Value: ""}
+	}
+	return &object.String{Value: string(runes[start:end])}
+}
+
+func clampIndex(i, length int64) int64 {
+	if i < 0 {
+		i += length
+	}
+	if i < 0 {
+		return 0
+	}
+	if i > length {
+		return length
+	}
+	return i
+}
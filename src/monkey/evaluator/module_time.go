@@ -0,0 +1,283 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"time"
+
+	// OSにタイムゾーンのデータがなくても同じように動くよう、データを埋め込む
+	_ "time/tzdata"
+)
+
+// import "time" as time; で読み込む時刻のモジュール
+// 時刻はTIME、時間の長さはDURATIONで表し、+や-、比較の演算子も使える
+// 書式はGoのtimeパッケージと同じく、2006-01-02T15:04:05Z07:00を例にして書く
+// RegisterModuleで登録されるのはOSの時計を使うもので、
+// 組み込む側はModuleLoader.Registerで、TimeExportsに別の時計を渡したものに差し替えられる
+func init() {
+	RegisterModule("time", TimeExports(time.Now))
+}
+
+// timeモジュールのexportを作る。now()やsince()はclockの返す時刻を使う
+func TimeExports(clock func() time.Time) map[string]object.Object {
+	m := &timeModule{clock: clock}
+	exports := BuiltinExports(map[string]object.BuiltinFunction{
+		"now":           m.now,
+		"since":         m.since,
+		"date":          timeDate,
+		"parse":         timeParse,
+		"format":        timeFormat,
+		"unix":          timeUnix,
+		"unixMilli":     timeUnixMilli,
+		"fromUnix":      timeFromUnix,
+		"fromUnixMilli": timeFromUnixMilli,
+		"in":            timeIn,
+		"zone":          timeZone,
+		"year":          timeField("time.year", func(t time.Time) int { return t.Year() }),
+		"month":         timeField("time.month", func(t time.Time) int { return int(t.Month()) }),
+		"day":           timeField("time.day", time.Time.Day),
+		"hour":          timeField("time.hour", time.Time.Hour),
+		"minute":        timeField("time.minute", time.Time.Minute),
+		"second":        timeField("time.second", time.Time.Second),
+		"weekday":       timeWeekday,
+		"addDate":       timeAddDate,
+		"truncate":      timeTruncate,
+		"duration":      timeDuration,
+		"toSeconds":     timeToSeconds,
+		"toMillis":      timeToMillis,
+	})
+
+	// 定数はGoと同じく大文字で始める。2 * time.Hourのように使う
+	constants := map[string]object.Object{
+		"Nanosecond":  &object.Duration{Value: time.Nanosecond},
+		"Microsecond": &object.Duration{Value: time.Microsecond},
+		"Millisecond": &object.Duration{Value: time.Millisecond},
+		"Second":      &object.Duration{Value: time.Second},
+		"Minute":      &object.Duration{Value: time.Minute},
+		"Hour":        &object.Duration{Value: time.Hour},
+		"RFC3339":     &object.String{Value: time.RFC3339},
+		"RFC3339Nano": &object.String{Value: time.RFC3339Nano},
+		"RFC1123":     &object.String{Value: time.RFC1123},
+		"Kitchen":     &object.String{Value: time.Kitchen},
+		"DateTime":    &object.String{Value: "2006-01-02 15:04:05"},
+		"DateOnly":    &object.String{Value: "2006-01-02"},
+		"TimeOnly":    &object.String{Value: "15:04:05"},
+	}
+	for name, value := range constants {
+		exports[name] = value
+	}
+
+	return exports
+}
+
+type timeModule struct {
+	clock func() time.Time
+}
+
+func timeArg(args []object.Object, i int) time.Time {
+	return args[i].(*object.Time).Value
+}
+
+func durationArg(args []object.Object, i int) time.Duration {
+	return args[i].(*object.Duration).Value
+}
+
+func intArg(args []object.Object, i int) int64 {
+	return args[i].(*object.Integer).Value
+}
+
+// タイムゾーンの名前("Asia/Tokyo"や"UTC")から場所を探す
+func loadLocation(name, zone string) (*time.Location, *object.Error) {
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, object.NewError(object.VALUE_ERROR, "%s: %s", name, err)
+	}
+	return loc, nil
+}
+
+func (m *timeModule) now(args ...object.Object) object.Object {
+	if err := object.CheckArgCount("time.now", args, 0); err != nil {
+		return err
+	}
+	return &object.Time{Value: m.clock()}
+}
+
+// tから今までの長さ
+func (m *timeModule) since(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("time.since", args, object.TIME_OBJ); err != nil {
+		return err
+	}
+	return &object.Duration{Value: m.clock().Sub(timeArg(args, 0))}
+}
+
+// 日付と時刻から時刻を作る。zoneを省略するとUTC
+// 範囲外の値は繰り上げる(13月は翌年の1月になる)
+func timeDate(args ...object.Object) object.Object {
+	if err := object.CheckOptionalArgTypes("time.date", args, 3,
+		object.INTEGER_OBJ, object.INTEGER_OBJ, object.INTEGER_OBJ,
+		object.INTEGER_OBJ, object.INTEGER_OBJ, object.INTEGER_OBJ, object.STRING_OBJ); err != nil {
+		return err
+	}
+
+	// 年、月、日、時、分、秒。省略した時刻は0
+	var fields [6]int
+	for i := 0; i < len(args) && i < len(fields); i++ {
+		fields[i] = int(intArg(args, i))
+	}
+
+	loc := time.UTC
+	if len(args) == 7 {
+		var err *object.Error
+		if loc, err = loadLocation("time.date", stringArg(args, 6)); err != nil {
+			return err
+		}
+	}
+
+	t := time.Date(fields[0], time.Month(fields[1]), fields[2], fields[3], fields[4], fields[5], 0, loc)
+	return &object.Time{Value: t}
+}
+
+// layoutの書式でsを読む。sにタイムゾーンがなければzoneの時刻とし、zoneも省略するとUTC
+func timeParse(args ...object.Object) object.Object {
+	if err := object.CheckOptionalArgTypes("time.parse", args, 2,
+		object.STRING_OBJ, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+		return err
+	}
+
+	loc := time.UTC
+	if len(args) == 3 {
+		var err *object.Error
+		if loc, err = loadLocation("time.parse", stringArg(args, 2)); err != nil {
+			return err
+		}
+	}
+
+	t, err := time.ParseInLocation(stringArg(args, 0), stringArg(args, 1), loc)
+	if err != nil {
+		return object.NewError(object.VALUE_ERROR, "time.parse: %s", err)
+	}
+	return &object.Time{Value: t}
+}
+
+func timeFormat(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("time.format", args, object.TIME_OBJ, object.STRING_OBJ); err != nil {
+		return err
+	}
+	return &object.String{Value: timeArg(args, 0).Format(stringArg(args, 1))}
+}
+
+// 1970-01-01T00:00:00Zからの秒数
+func timeUnix(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("time.unix", args, object.TIME_OBJ); err != nil {
+		return err
+	}
+	return &object.Integer{Value: timeArg(args, 0).Unix()}
+}
+
+func timeUnixMilli(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("time.unixMilli", args, object.TIME_OBJ); err != nil {
+		return err
+	}
+	return &object.Integer{Value: timeArg(args, 0).UnixNano() / int64(time.Millisecond)}
+}
+
+// unixの逆。結果はUTCの時刻
+func timeFromUnix(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("time.fromUnix", args, object.INTEGER_OBJ); err != nil {
+		return err
+	}
+	return &object.Time{Value: time.Unix(intArg(args, 0), 0).UTC()}
+}
+
+func timeFromUnixMilli(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("time.fromUnixMilli", args, object.INTEGER_OBJ); err != nil {
+		return err
+	}
+	ms := intArg(args, 0)
+	return &object.Time{Value: time.Unix(ms/1000, ms%1000*int64(time.Millisecond)).UTC()}
+}
+
+// 同じ瞬間を、zoneのタイムゾーンで表した時刻
+func timeIn(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("time.in", args, object.TIME_OBJ, object.STRING_OBJ); err != nil {
+		return err
+	}
+
+	loc, err := loadLocation("time.in", stringArg(args, 1))
+	if err != nil {
+		return err
+	}
+	return &object.Time{Value: timeArg(args, 0).In(loc)}
+}
+
+// タイムゾーンの名前
+func timeZone(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("time.zone", args, object.TIME_OBJ); err != nil {
+		return err
+	}
+	return &object.String{Value: timeArg(args, 0).Location().String()}
+}
+
+// 時刻のタイムゾーンでの日付や時刻の値を返す関数を作る
+func timeField(name string, field func(time.Time) int) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if err := object.CheckArgTypes(name, args, object.TIME_OBJ); err != nil {
+			return err
+		}
+		return &object.Integer{Value: int64(field(timeArg(args, 0)))}
+	}
+}
+
+// 曜日の名前("Monday"など)
+func timeWeekday(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("time.weekday", args, object.TIME_OBJ); err != nil {
+		return err
+	}
+	return &object.String{Value: timeArg(args, 0).Weekday().String()}
+}
+
+// 年、月、日を足す。1月31日に1か月足すと3月2日(か3日)になる
+func timeAddDate(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("time.addDate", args,
+		object.TIME_OBJ, object.INTEGER_OBJ, object.INTEGER_OBJ, object.INTEGER_OBJ); err != nil {
+		return err
+	}
+
+	t := timeArg(args, 0).AddDate(int(intArg(args, 1)), int(intArg(args, 2)), int(intArg(args, 3)))
+	return &object.Time{Value: t}
+}
+
+// dの倍数に切り捨てる。倍数はUTCで数えるので、日単位の切り捨てには使えない
+func timeTruncate(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("time.truncate", args, object.TIME_OBJ, object.DURATION_OBJ); err != nil {
+		return err
+	}
+	return &object.Time{Value: timeArg(args, 0).Truncate(durationArg(args, 1))}
+}
+
+// "1h30m"や"250ms"のような文字列を読む
+func timeDuration(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("time.duration", args, object.STRING_OBJ); err != nil {
+		return err
+	}
+
+	d, err := time.ParseDuration(stringArg(args, 0))
+	if err != nil {
+		return object.NewError(object.VALUE_ERROR, "time.duration: %s", err)
+	}
+	return &object.Duration{Value: d}
+}
+
+func timeToSeconds(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("time.toSeconds", args, object.DURATION_OBJ); err != nil {
+		return err
+	}
+	return &object.Float{Value: durationArg(args, 0).Seconds()}
+}
+
+// 端数は切り捨てる
+func timeToMillis(args ...object.Object) object.Object {
+	if err := object.CheckArgTypes("time.toMillis", args, object.DURATION_OBJ); err != nil {
+		return err
+	}
+	return &object.Integer{Value: int64(durationArg(args, 0) / time.Millisecond)}
+}
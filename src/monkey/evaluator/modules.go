@@ -0,0 +1,328 @@
+package evaluator
+
+import (
+	"io/ioutil"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Goで書かれたモジュール。import "strings" as s; のように名前だけで読み込める
+var (
+	modulesMu sync.RWMutex
+	modules   = map[string]*object.Module{}
+)
+
+// Go側からモジュールを追加する。同じ名前で登録すると上書きされる
+// importではファイルより先に探すので、同じ名前のファイルは"./strings"のように書いて読み込む
+func RegisterModule(name string, exports map[string]object.Object) {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+
+	modules[name] = &object.Module{Name: name, Exports: exports}
+}
+
+// Goの関数をモジュールのexportにする
+func BuiltinExports(funcs map[string]object.BuiltinFunction) map[string]object.Object {
+	exports := make(map[string]object.Object, len(funcs))
+	for name, fn := range funcs {
+		exports[name] = &object.Builtin{Fn: fn}
+	}
+	return exports
+}
+
+func LookupModule(name string) (*object.Module, bool) {
+	modulesMu.RLock()
+	defer modulesMu.RUnlock()
+
+	module, ok := modules[name]
+	return module, ok
+}
+
+// importのパスに拡張子がないときに補う拡張子
+const ModuleExt = ".mk"
+
+// import文でファイルを探して読み込む
+// 一度読み込んだモジュールはパスごとにキャッシュし、2回目からは評価し直さない
+// spawnで起動したタスクとも共有するので、キャッシュはmuで守る
+type ModuleLoader struct {
+	// "./"や"../"で始まらないパスを、importしたファイルのディレクトリの次に探すディレクトリ
+	SearchPath []string
+
+	// ファイルを読む関数。テストなどで差し替えられる
+	ReadFile func(name string) ([]byte, error)
+
+	// Sandboxで設定する。fsがnilならOSのパスをそのまま使い、rootsが空なら制限しない
+	fs    FileSystem
+	roots []string
+
+	mu      sync.RWMutex
+	natives map[string]*object.Module
+	cache   map[string]*object.Module
+}
+
+func NewModuleLoader(searchPath ...string) *ModuleLoader {
+	return &ModuleLoader{
+		SearchPath: searchPath,
+		ReadFile:   ioutil.ReadFile,
+		natives:    map[string]*object.Module{},
+		cache:      map[string]*object.Module{},
+	}
+}
+
+// このローダーでだけ使うGoのモジュールを登録する。RegisterModuleで登録したものより先に探す
+// 組み込む側ごとに設定の違うモジュールを渡すのに使う
+//
+//	in.Modules.Register("fs", evaluator.FSExports(evaluator.NewMemFS(), "/data"))
+func (l *ModuleLoader) Register(name string, exports map[string]object.Object) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.natives[name] = &object.Module{Name: name, Exports: exports}
+}
+
+// importで読むファイルをfsysから読み、rootsの中のものに限る。fsモジュールも同じfsysとrootsで登録する
+// fsモジュールだけをRegisterで差し替えても、importはOSのどのファイルでも読めてしまうので、
+// スクリプトをディレクトリの中に閉じ込めたいときはこちらを使う。rootsの外のファイルをimportするとPermissionError
+//
+//	in.Modules.Sandbox(evaluator.OSFileSystem{}, "/srv/scripts")
+func (l *ModuleLoader) Sandbox(fsys FileSystem, roots ...string) {
+	l.Register("fs", FSExports(fsys, roots...))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.fs = fsys
+	l.roots = roots
+	l.ReadFile = fsys.ReadFile
+}
+
+// 環境変数MONKEY_PATHをOSのパス区切り文字で分けた検索パス
+func EnvSearchPath() []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(os.Getenv("MONKEY_PATH")) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// importするファイルの候補
+// 絶対パスはそのまま、"./"と"../"はfromのディレクトリから、
+// それ以外はfromのディレクトリ、SearchPathの順に探す。fromが空ならカレントディレクトリを起点にする
+func (l *ModuleLoader) candidates(path, from string) []string {
+	if filepath.Ext(path) == "" {
+		path += ModuleExt
+	}
+	path = filepath.FromSlash(path)
+
+	dir := "."
+	if from != "" {
+		dir = filepath.Dir(from)
+	}
+
+	if filepath.IsAbs(path) {
+		return []string{path}
+	}
+	if strings.HasPrefix(path, "."+string(filepath.Separator)) || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return []string{filepath.Join(dir, path)}
+	}
+
+	paths := []string{filepath.Join(dir, path)}
+	for _, d := range l.SearchPath {
+		paths = append(paths, filepath.Join(d, path))
+	}
+	return paths
+}
+
+// 候補を順に読み、最初に読めたファイルの絶対パスと中身を返す
+// キャッシュにあればsrcはnilになる。rootsの外の候補は読まずに飛ばし、ほかに見つからなければ権限のエラーを返す
+func (l *ModuleLoader) find(path, from string) (abs string, src []byte, err error) {
+	l.mu.RLock()
+	fsys, roots := l.fs, l.roots
+	l.mu.RUnlock()
+
+	var denied error
+	for _, name := range l.candidates(path, from) {
+		if fsys != nil {
+			abs, err = fsys.Abs(name)
+		} else {
+			abs, err = filepath.Abs(name)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		if fsys != nil && !withinRoots(fsys, roots, abs) {
+			if denied == nil {
+				denied = &os.PathError{Op: "import", Path: abs, Err: os.ErrPermission}
+			}
+			continue
+		}
+		if _, ok := l.cached(abs); ok {
+			return abs, nil, nil
+		}
+
+		src, err = l.ReadFile(abs)
+		if err == nil {
+			return abs, src, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", nil, err
+		}
+	}
+	if denied != nil {
+		return "", nil, denied
+	}
+	return "", nil, os.ErrNotExist
+}
+
+func (l *ModuleLoader) native(name string) (*object.Module, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	module, ok := l.natives[name]
+	return module, ok
+}
+
+func (l *ModuleLoader) cached(abs string) (*object.Module, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	module, ok := l.cache[abs]
+	return module, ok
+}
+
+// 2つのタスクが同時に同じモジュールを読み込んだときは、後から評価し終えたほうが残る
+func (l *ModuleLoader) store(abs string, module *object.Module) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cache[abs] = module
+}
+
+// モジュールの名前。ファイル名から拡張子を除いたもの
+func moduleName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// importしたファイルを読み込んで評価し、モジュールを束縛する
+func (e *Evaluator) evalImportStatement(is *ast.ImportStatement, env *object.Environment) object.Object {
+	module := e.importModule(is, env.File())
+	if isError(module) {
+		return module
+	}
+
+	env.Set(is.Name.Value, module)
+	return nil
+}
+
+func (e *Evaluator) importModule(is *ast.ImportStatement, from string) object.Object {
+	l := e.Modules
+	if module, ok := l.native(is.Path.Value); ok {
+		return module
+	}
+	if module, ok := LookupModule(is.Path.Value); ok {
+		return module
+	}
+
+	abs, src, err := l.find(is.Path.Value, from)
+	if os.IsNotExist(err) {
+		return e.newError(is.Token, object.IMPORT_ERROR, "module not found: %q", is.Path.Value)
+	}
+	if pathErr, ok := err.(*os.PathError); ok && os.IsPermission(err) && pathErr.Op == "import" {
+		return e.newError(is.Token, object.PERMISSION_ERROR, "cannot import %q: access denied: %s", is.Path.Value, pathErr.Path)
+	}
+	if err != nil {
+		return e.newError(is.Token, object.IMPORT_ERROR, "cannot import %q: %s", is.Path.Value, err)
+	}
+
+	for i, loading := range e.loading {
+		if loading == abs {
+			cycle := append(e.loading[i:len(e.loading):len(e.loading)], abs)
+			names := make([]string, len(cycle))
+			for j, p := range cycle {
+				names[j] = moduleName(p)
+			}
+			return e.newError(is.Token, object.IMPORT_ERROR, "import cycle: %s", strings.Join(names, " -> "))
+		}
+	}
+
+	if module, ok := l.cached(abs); ok {
+		return module
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return e.newError(is.Token, object.IMPORT_ERROR, "cannot import %q: %s: %s",
+			is.Path.Value, abs, p.Errors()[0])
+	}
+
+	module := &object.Module{Name: moduleName(abs), Path: abs, Exports: map[string]object.Object{}}
+
+	e.loading = append(e.loading, abs)
+	defer func() { e.loading = e.loading[:len(e.loading)-1] }()
+
+	e.pushFrame(is.Token, "<module "+module.Name+">")
+	defer e.popFrame()
+
+	modEnv := object.NewEnvironment()
+	modEnv.SetFile(abs)
+	if result := e.Eval(program, modEnv); isError(result) {
+		return result
+	}
+
+	for _, stmt := range program.Statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			name := export.Statement.Name.Value
+			if val, ok := modEnv.Get(name); ok {
+				module.Exports[name] = val
+			}
+		}
+	}
+
+	l.store(abs, module)
+	return module
+}
+
+// モジュールならexportされた値を、catchしたエラーならフィールドを取り出す
+// ハッシュならh["name"]と同じで、キーがなければnull
+func (e *Evaluator) evalMemberExpression(me *ast.MemberExpression, env *object.Environment) object.Object {
+	obj := e.Eval(me.Object, env)
+	if isError(obj) {
+		return obj
+	}
+
+	name := me.Member.Value
+	switch obj := obj.(type) {
+	case *object.Module:
+		val, ok := obj.Exports[name]
+		if !ok {
+			return e.newError(me.Token, object.NAME_ERROR, "module %s has no export %q", obj.Name, name)
+		}
+		return val
+	case *object.Hash:
+		pair, ok := obj.Pairs[(&object.String{Value: name}).HashKey()]
+		if !ok {
+			return NULL
+		}
+		return pair.Value
+	case *object.Exception:
+		val, ok := obj.Field(name)
+		if !ok {
+			return e.newError(me.Token, object.INDEX_ERROR, "unknown exception field: %q", name)
+		}
+		if val == nil {
+			return NULL
+		}
+		return val
+	default:
+		return e.newError(me.Token, object.TYPE_ERROR, "member access not supported: %s", obj.Type())
+	}
+}
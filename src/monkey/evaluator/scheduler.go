@@ -0,0 +1,241 @@
+package evaluator
+
+import (
+	"fmt"
+	"math/rand"
+	"monkey/ast"
+	"monkey/object"
+	"sort"
+)
+
+// spawnしたタスクを1つずつ順に実行するスケジューラ。テストで、タスクの実行順を再現できるようにする
+//
+// タスクごとにgoroutineを使うが、同時に動くのはいつも1つだけで、
+// 次にどのタスクを動かすかは、シードから作った乱数でStepが決める。Goのスケジューラには左右されないので、
+// 同じシードで同じプログラムを実行すれば、チャネルの操作やprintの順番は毎回同じになる
+//
+// タスクが順番を譲るのは、spawnとチャネルの操作(send、recv、select)のときと、
+// Quantumを設定していればそのステップ数ごと。すべてのタスクがチャネルを待って止まったら、
+// ふつうのときと同じく、どのタスクがどのチャネルを待っているかを書いたDeadlockErrorになる
+//
+//	s := evaluator.NewScheduler(1)
+//	s.Start(evaluator.New(), program, env)
+//	for {
+//		info, ok := s.Step()
+//		if !ok {
+//			break
+//		}
+//		...
+//	}
+//	result := s.Result()
+type Scheduler struct {
+	// 0でなければ、タスクはこのステップ数ごとにも順番を譲る。Startより前に設定する
+	Quantum int
+
+	rng     *rand.Rand
+	group   *TaskGroup
+	ready   []*task    // 動けるタスク。動いているタスクも含む
+	yielded chan *task // 動いていたタスクが順番を譲ったか、終わったときに送る
+
+	started bool
+	result  object.Object
+	done    chan struct{}
+}
+
+func NewScheduler(seed int64) *Scheduler {
+	s := &Scheduler{
+		rng:     rand.New(rand.NewSource(seed)),
+		yielded: make(chan *task),
+		done:    make(chan struct{}),
+	}
+	s.group = &TaskGroup{sched: s}
+	return s
+}
+
+// Stepで実行したタスクや、Tasksで返すタスクの状態
+type TaskInfo struct {
+	ID      int    // メインは0
+	Name    string // メインは"main"、spawnしたタスクは呼び出した関数の名前
+	Blocked string // 待っているチャネルの操作("recv <chan 1>"など)。待っていなければ空
+	Done    bool   // 終わったか
+}
+
+func (t *task) info(done bool) TaskInfo {
+	info := TaskInfo{ID: t.id, Name: t.name, Done: done}
+	if t.waiting != nil {
+		info.Blocked = t.waiting.describe()
+	}
+	return info
+}
+
+// nodeをeのメインのタスクとして評価する準備をする。評価はStepを呼ぶまで始まらない
+// eのTasksはこのスケジューラのものに置き換える。1つのSchedulerでStartできるのは1回だけ
+func (s *Scheduler) Start(e *Evaluator, node ast.Node, env *object.Environment) {
+	if s.started {
+		panic("evaluator: Scheduler.Start called twice")
+	}
+	s.started = true
+
+	g := s.group
+	e.Tasks = g
+	e.task = nil
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	main := e.current()
+	main.quantum = s.Quantum
+	s.start(main, func() {
+		defer close(s.done)
+		defer func() {
+			if r := recover(); r != nil {
+				s.result = &object.Error{Message: fmt.Sprintf("internal error: %v", r)}
+				g.mu.Lock()
+				if e.task != nil {
+					g.exit(e.task)
+					e.task = nil
+				}
+				g.mu.Unlock()
+			}
+		}()
+		s.result = e.Wait(e.Eval(node, env))
+	})
+}
+
+// 動けるタスクを1つ選び、次に順番を譲るか終わるまで実行する
+// 実行したタスクのその時点の状態を返す。動けるタスクがなければfalse
+func (s *Scheduler) Step() (TaskInfo, bool) {
+	g := s.group
+
+	g.mu.Lock()
+	if len(s.ready) == 0 {
+		g.mu.Unlock()
+		return TaskInfo{}, false
+	}
+	t := s.ready[s.rng.Intn(len(s.ready))]
+	g.mu.Unlock()
+
+	t.resume <- struct{}{}
+	<-s.yielded
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return t.info(!g.has(t)), true
+}
+
+// 評価中のタスクの状態を番号順に返す
+func (s *Scheduler) Tasks() []TaskInfo {
+	g := s.group
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	infos := make([]TaskInfo, len(g.tasks))
+	for i, t := range g.tasks {
+		infos[i] = t.info(false)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// メインのタスクの結果。Evaluator.Waitと同じく、タスクで起きたエラーも返す
+// Stepがfalseを返すまで実行してから呼ぶ
+func (s *Scheduler) Result() object.Object {
+	<-s.done
+	return s.result
+}
+
+// StartしてからStepがfalseを返すまで実行し、結果を返す
+func (s *Scheduler) Run(e *Evaluator, node ast.Node, env *object.Environment) object.Object {
+	s.Start(e, node, env)
+	for {
+		if _, ok := s.Step(); !ok {
+			break
+		}
+	}
+	return s.Result()
+}
+
+func (g *TaskGroup) has(t *task) bool {
+	for _, other := range g.tasks {
+		if other == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Scheduler) isReady(t *task) bool {
+	for _, r := range s.ready {
+		if r == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Scheduler) remove(t *task) {
+	for i, r := range s.ready {
+		if r == t {
+			s.ready = append(s.ready[:i], s.ready[i+1:]...)
+			return
+		}
+	}
+}
+
+// 順番が回ってくるまでgoroutineを止めておく
+func (s *Scheduler) start(t *task, run func()) {
+	t.resume = make(chan struct{})
+	s.ready = append(s.ready, t)
+	go func() {
+		<-t.resume
+		run()
+	}()
+}
+
+// 待ちが終わるまで動けるタスクから外し、Stepに戻る
+// デッドロックで待ちがもう終わっていれば、外さずにそのまま順番を譲る
+func (s *Scheduler) park(e *Evaluator, w *waiter) {
+	if !w.done {
+		s.remove(e.task)
+	}
+	s.yield(e)
+}
+
+func (s *Scheduler) wake(w *waiter) {
+	if !s.isReady(w.task) {
+		s.ready = append(s.ready, w.task)
+	}
+}
+
+// g.muを持ったままStepに戻る。Stepはg.muが外れるのを待ってから状態を読む
+func (s *Scheduler) exit(t *task) {
+	s.remove(t)
+	s.yielded <- t
+}
+
+func (s *Scheduler) yield(e *Evaluator) {
+	t := e.task
+	e.Tasks.mu.Unlock()
+	s.yielded <- t
+	<-t.resume
+	e.Tasks.mu.Lock()
+}
+
+func (s *Scheduler) order(n int) []int {
+	return s.rng.Perm(n)
+}
+
+// Quantumのステップ数ごとに順番を譲る
+func (e *Evaluator) preempt() {
+	t := e.task
+	if t == nil || t.quantum == 0 {
+		return
+	}
+
+	t.steps++
+	if t.steps%t.quantum == 0 {
+		e.Tasks.mu.Lock()
+		e.Tasks.sched.yield(e)
+		e.Tasks.mu.Unlock()
+	}
+}
@@ -0,0 +1,257 @@
+package evaluator
+
+import (
+	"fmt"
+	"math/rand"
+	"monkey/ast"
+	"monkey/object"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// spawn f(x) で起動するタスク
+//
+// タスクの実行のしかたはschedulerが決める。ふつうはそれぞれGoのgoroutineで同時に評価し、
+// テストではScheduler(scheduler.go)で1つずつ決まった順に評価する。呼び出しスタックはタスクごとに持ち、
+// 環境、モジュールのキャッシュ、実行の制限(ステップ数と割り当て)は起動したタスクと共有する
+// 環境はロックで守り、オブジェクトは作ったあとで変更しないので、同じ値を複数のタスクから読んでもよい
+//
+// すべてのタスクがチャネルを待って止まったらデッドロックとして、待っている操作をDeadlockErrorにする
+
+// 同じ実行で起動したタスクと、その中で作ったチャネルをまとめる
+// タスクの数やチャネルの中身はすべてmuで守る
+type TaskGroup struct {
+	mu       sync.Mutex
+	tasks    []*task // 評価中のタスク。メインはspawnかチャネルを使ったときに加わる
+	nextTask int
+	nextChan int
+	running  sync.WaitGroup // spawnしたタスクのうち、終わっていないもの
+	err      *object.Error  // spawnしたタスクで最初に起きた、catchされなかったエラー
+	sched    scheduler
+}
+
+// タスクをそれぞれgoroutineで同時に評価するグループを作る
+// REPLのように何度もEvalするときは、同じグループを渡せば前に作ったチャネルを使い続けられる
+func NewTaskGroup() *TaskGroup {
+	return &TaskGroup{sched: goroutineScheduler{}}
+}
+
+type task struct {
+	id      int // メインは0、spawnしたタスクは1から順に数える
+	name    string
+	waiting *waiter // チャネルを待っている間だけnilでない
+
+	// Schedulerで実行するときだけ使う
+	resume  chan struct{} // 順番が回ってきたら送られる
+	quantum int           // 0でなければ、このステップ数ごとに順番を譲る
+	steps   int
+}
+
+// タスクの実行のしかた。どれもg.muを持って呼ぶ
+type scheduler interface {
+	// tを新しいタスクとして起動し、runを評価させる
+	start(t *task, run func())
+	// e.taskをwが終わるまで止める。止まっている間はg.muを外す
+	park(e *Evaluator, w *waiter)
+	// 止まっているwのタスクを起こす
+	wake(w *waiter)
+	// tが終わった
+	exit(t *task)
+	// 他のタスクに順番を譲る。譲っている間はg.muを外す
+	yield(e *Evaluator)
+	// selectで同時にできる操作を試す順番
+	order(n int) []int
+}
+
+// タスクごとにgoroutineを起動し、Goのスケジューラに任せる
+type goroutineScheduler struct{}
+
+func (goroutineScheduler) start(t *task, run func()) {
+	go run()
+}
+
+// ctxがキャンセルされたら、wが終わっていなくても戻る
+func (goroutineScheduler) park(e *Evaluator, w *waiter) {
+	e.Tasks.mu.Unlock()
+	select {
+	case <-w.wake:
+	case <-e.ctx.Done():
+	}
+	e.Tasks.mu.Lock()
+}
+
+func (goroutineScheduler) wake(w *waiter) {
+	close(w.wake)
+}
+
+func (goroutineScheduler) exit(t *task) {}
+
+func (goroutineScheduler) yield(e *Evaluator) {}
+
+func (goroutineScheduler) order(n int) []int {
+	return rand.Perm(n)
+}
+
+func (t *task) String() string {
+	if t.id == 0 {
+		return "main"
+	}
+	return fmt.Sprintf("task %d (%s)", t.id, t.name)
+}
+
+// このEvaluatorのタスク。メインのタスクはここで初めてグループに加える。g.muを持って呼ぶ
+func (e *Evaluator) current() *task {
+	if e.task == nil {
+		e.task = &task{name: "main"}
+		e.Tasks.tasks = append(e.Tasks.tasks, e.task)
+	}
+	return e.task
+}
+
+// 関数と引数をいまのタスクで評価してから、新しいタスクで呼び出す
+// 関数の戻り値を1つだけ受け取れるチャネルを返す。関数がエラーになったら値を送らずに閉じる
+func (e *Evaluator) evalSpawnExpression(se *ast.SpawnExpression, env *object.Environment) object.Object {
+	call, ok := se.Call.(*ast.CallExpression)
+	if !ok {
+		return e.newError(se.Token, object.TYPE_ERROR, "spawn requires a function call, got %s", se.Call.String())
+	}
+
+	function := e.Eval(call.Function, env)
+	if isError(function) {
+		return function
+	}
+	args := e.evalExpressions(call.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	name := call.Function.String()
+	switch fn := function.(type) {
+	case *object.Function:
+		name = functionName(fn)
+	case *object.Builtin, *taskBuiltin:
+	default:
+		return e.newError(call.Token, object.TYPE_ERROR, "not a function: %s", function.Type())
+	}
+
+	g := e.Tasks
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.nextTask++
+	t := &task{id: g.nextTask, name: name, quantum: e.current().quantum}
+	g.tasks = append(g.tasks, t)
+	result := g.newChannel(1)
+
+	child := &Evaluator{
+		Modules: e.Modules,
+		Tasks:   g,
+		task:    t,
+		ctx:     e.ctx,
+		limits:  e.limits,
+		usage:   e.usage,
+	}
+	g.running.Add(1)
+	g.sched.start(t, func() { child.runTask(call, function, args, result) })
+	g.sched.yield(e)
+
+	return result
+}
+
+func (e *Evaluator) runTask(call *ast.CallExpression, fn object.Object, args []object.Object, result *Channel) {
+	g := e.Tasks
+	defer g.running.Done()
+
+	var value object.Object
+	func() {
+		// goroutineの中のpanicはプロセスごと落とすので、タスクのエラーにする
+		defer func() {
+			if r := recover(); r != nil {
+				value = &object.Error{Message: fmt.Sprintf("internal error: %v", r)}
+			}
+		}()
+		value = e.applyFunction(call.Token, fn, args)
+	}()
+	if value == nil {
+		value = NULL
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if errObj, ok := value.(*object.Error); ok {
+		if g.err == nil {
+			g.err = errObj
+		}
+	} else {
+		// スクリプトが先に送ったり閉じたりしていれば、戻り値は捨てる
+		g.try(chanOp{ch: result, send: true, value: value})
+	}
+	g.closeChannel(result)
+	g.exit(e.task)
+}
+
+// 終わったタスクをグループから外す。残ったタスクがすべて待っていればデッドロック。g.muを持って呼ぶ
+func (g *TaskGroup) exit(t *task) {
+	for i, other := range g.tasks {
+		if other == t {
+			g.tasks = append(g.tasks[:i], g.tasks[i+1:]...)
+			break
+		}
+	}
+	g.checkDeadlock()
+	g.sched.exit(t)
+}
+
+// すべてのタスクがチャネルを待っていれば、待っている操作をすべてDeadlockErrorで終わらせる
+// メッセージにはどのタスクがどのチャネルを待っているかをタスクの番号順に並べる。g.muを持って呼ぶ
+func (g *TaskGroup) checkDeadlock() {
+	if len(g.tasks) == 0 {
+		return
+	}
+	for _, t := range g.tasks {
+		if t.waiting == nil {
+			return
+		}
+	}
+
+	tasks := append([]*task(nil), g.tasks...)
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].id < tasks[j].id })
+
+	blocked := make([]string, len(tasks))
+	for i, t := range tasks {
+		blocked[i] = t.String() + " " + t.waiting.describe()
+	}
+	msg := "all tasks are blocked: " + strings.Join(blocked, "; ")
+
+	for _, t := range tasks {
+		g.complete(t.waiting, -1, nil, object.NewError(object.DEADLOCK_ERROR, "%s", msg))
+	}
+}
+
+// spawnしたタスクがすべて終わるまで待つ。Evalで評価し終えたあとに呼ぶ
+// resultがエラーならそれを、そうでなければタスクで最初に起きたcatchされなかったエラーを返す
+// メインのタスクはここでチャネルを待たなくなるので、残ったタスクがお互いを待っていればデッドロックになる
+func (e *Evaluator) Wait(result object.Object) object.Object {
+	g := e.Tasks
+
+	g.mu.Lock()
+	if e.task != nil {
+		g.exit(e.task)
+		e.task = nil
+	}
+	g.mu.Unlock()
+
+	g.running.Wait()
+
+	g.mu.Lock()
+	err := g.err
+	g.err = nil
+	g.mu.Unlock()
+
+	if err == nil || isError(result) {
+		return result
+	}
+	return err
+}
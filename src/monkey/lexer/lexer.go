@@ -1,21 +1,33 @@
 package lexer
 
-import "monkey/token"
+import (
+	"monkey/token"
+	"strings"
+)
 
 type Lexer struct {
 	input        string
 	position     int  //入力中における現在の位置
 	readPosition int  // これから読み込む位置(初期値は0)
 	ch           byte // 現在検査中の文字
+	line         int  // chがある行(1始まり)
+	column       int  // chがある列(1始まり)
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) readChar() {
+	// 改行を読み終えたら次の行の先頭に進む
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
+	}
+	l.column += 1
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -26,11 +38,16 @@ func (l *Lexer) readChar() {
 	l.readPosition += 1
 }
 
-func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
-
+func (l *Lexer) NextToken() (tok token.Token) {
 	l.skipWhiteSpace()
 
+	// トークンの開始位置を覚えておく
+	line, column := l.line, l.column
+	defer func() {
+		tok.Line = line
+		tok.Column = column
+	}()
+
 	switch l.ch {
 	case '=':
 		// =がきたら次の文字をのぞき見する。次がまた=だったら==トークンとして扱う
@@ -59,6 +76,12 @@ func (l *Lexer) NextToken() token.Token {
 	case '*':
 		tok = newToken(token.ASTERISK, l.ch)
 	case '/':
+		// //から行末まではコメント
+		if l.peekChar() == '/' {
+			tok.Type = token.COMMENT
+			tok.Literal = l.readComment()
+			return tok
+		}
 		tok = newToken(token.SLASH, l.ch)
 	case '<':
 		tok = newToken(token.LT, l.ch)
@@ -76,6 +99,17 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
 		tok = newToken(token.RBRACE, l.ch)
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch)
+	case '.':
+		tok = newToken(token.DOT, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
+	case '"':
+		tok.Type = token.STRING
+		tok.Literal = l.readString()
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -85,8 +119,7 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Type = token.LookupIdent(tok.Literal)
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Type, tok.Literal = l.readNumber()
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -105,7 +138,8 @@ func (l *Lexer) readIdentifier() string {
 	//最初の文字の位置をpositionに保存しておく
 	position := l.position
 	//whileみたいなイメージisLetter()がtrueを返す限りループが継続する
-	for isLetter(l.ch) {
+	//2文字目からはlog10のように数字も使える
+	for isLetter(l.ch) || isDigit(l.ch) {
 		l.readChar()
 	}
 	//最初の文字の位置から最後の文字の位置までをまとめて取得する
@@ -123,14 +157,45 @@ func (l *Lexer) skipWhiteSpace() {
 	}
 }
 
-func (l *Lexer) readNumber() string {
+// 小数点の後ろに数字が続けば浮動小数点数として読む
+// 1.fooのように数字が続かない'.'はメンバーアクセスのDOTとして残す
+func (l *Lexer) readNumber() (token.TokenType, string) {
 	position := l.position
 	for isDigit(l.ch) {
 		l.readChar()
 	}
+	if l.ch != '.' || !isDigit(l.peekChar()) {
+		return token.INT, l.input[position:l.position]
+	}
+
+	l.readChar()
+	for isDigit(l.ch) {
+		l.readChar()
+	}
+	return token.FLOAT, l.input[position:l.position]
+}
+
+// 閉じる"か入力の終わりまでを文字列として読む
+func (l *Lexer) readString() string {
+	position := l.position + 1
+	for {
+		l.readChar()
+		if l.ch == '"' || l.ch == 0 {
+			break
+		}
+	}
 	return l.input[position:l.position]
 }
 
+// 改行の手前までを読む。改行は次のNextTokenで読み飛ばす
+func (l *Lexer) readComment() string {
+	position := l.position
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	return strings.TrimRight(l.input[position:l.position], " \t\r")
+}
+
 func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
@@ -25,6 +25,13 @@ if (5 < 10) {
 
 10 == 10;
 10 != 9;
+"foobar"
+"foo bar"
+a[0];
+try { throw e; } catch (e) {} finally {}
+spawn select case default
+10 / 2 // half  
+// done
 `
 
 	tests := []struct {
@@ -104,6 +111,37 @@ if (5 < 10) {
 		{token.NOT_EQ, "!="},
 		{token.INT, "9"},
 		{token.SEMICOLON, ";"},
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.IDENT, "a"},
+		{token.LBRACKET, "["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.TRY, "try"},
+		{token.LBRACE, "{"},
+		{token.THROW, "throw"},
+		{token.IDENT, "e"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.CATCH, "catch"},
+		{token.LPAREN, "("},
+		{token.IDENT, "e"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.FINALLY, "finally"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.SPAWN, "spawn"},
+		{token.SELECT, "select"},
+		{token.CASE, "case"},
+		{token.DEFAULT, "default"},
+		{token.INT, "10"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.COMMENT, "// half"},
+		{token.COMMENT, "// done"},
 		{token.EOF, ""},
 	}
 	l := New(input)
@@ -122,3 +160,105 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestIdentifiersWithDigits(t *testing.T) {
+	input := `x1 log10 a1b2 1a _9`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "x1"},
+		{token.IDENT, "log10"},
+		{token.IDENT, "a1b2"},
+		{token.INT, "1"}, // 数字から始まるものは識別子ではない
+		{token.IDENT, "a"},
+		{token.IDENT, "_9"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  add(x,
+	10);`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"add", 2, 3},
+		{"(", 2, 6},
+		{"x", 2, 7},
+		{",", 2, 8},
+		{"10", 3, 2},
+		{")", 3, 4},
+		{";", 3, 5},
+		{"", 3, 6},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := `1.5 42 0.25 u.x 7.y 3. log10`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FLOAT, "1.5"},
+		{token.INT, "42"},
+		{token.FLOAT, "0.25"},
+		{token.IDENT, "u"},
+		{token.DOT, "."},
+		{token.IDENT, "x"},
+		{token.INT, "7"},
+		{token.DOT, "."},
+		{token.IDENT, "y"},
+		{token.INT, "3"},
+		{token.DOT, "."},
+		{token.IDENT, "log10"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// Goのプログラムに組み込んでMonkeyのスクリプトを実行するためのパッケージ
+//
+//	in := monkey.New()
+//	in.Set("limit", 10)
+//	result, err := in.Eval("let double = fn(x) { x * 2 }; double(limit)")
+package monkey
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// グローバルな環境を持ち、Evalを呼ぶたびにその環境でスクリプトを評価する
+// 前のEvalでletした値は次のEvalからも見える
+type Interpreter struct {
+	env *object.Environment
+
+	// 1回のEval/Callごとに課す制限。実行のたびに数え直す
+	Limits evaluator.Limits
+
+	// import文でモジュールを探して読み込む。キャッシュはInterpreterが生きている間使い回す
+	// Newの既定ではNoFileSystemでSandboxしてあり、スクリプトはfsモジュールでもimportでもファイルに触れられない
+	// ファイルを使わせるときは、in.Modules.Sandbox(evaluator.OSFileSystem{}, dir)のように触れてよい場所を渡す
+	Modules *evaluator.ModuleLoader
+
+	// spawnで起動したタスクとチャネル。前のEvalで作ったチャネルも使える
+	Tasks *evaluator.TaskGroup
+}
+
+func New() *Interpreter {
+	modules := evaluator.NewModuleLoader()
+	modules.Sandbox(evaluator.NoFileSystem{})
+
+	return &Interpreter{
+		env:     object.NewEnvironment(),
+		Modules: modules,
+		Tasks:   evaluator.NewTaskGroup(),
+	}
+}
+
+// 構文解析のエラー
+type ParseError struct {
+	Errors []string
+}
+
+func (pe *ParseError) Error() string {
+	return "parse errors:\n\t" + strings.Join(pe.Errors, "\n\t")
+}
+
+// sourceを評価して最後の式の値を返す
+// 構文エラーなら*ParseError、実行時エラーなら*object.Errorをerrorとして返す
+func (in *Interpreter) Eval(source string) (object.Object, error) {
+	return in.EvalContext(context.Background(), source)
+}
+
+// ctxがキャンセルされたら評価を打ち切るEval
+func (in *Interpreter) EvalContext(ctx context.Context, source string) (object.Object, error) {
+	l := lexer.New(source)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+
+	return in.run(ctx, func(e *evaluator.Evaluator) object.Object {
+		return e.Eval(program, in.env)
+	})
+}
+
+// pathのファイルを読んで評価する
+// スクリプトの中の相対パスのimportはこのファイルのディレクトリから探す
+// 評価し終えたら元に戻すので、後のEvalには影響しない
+// pathはModulesの制限にかかわらず読む。importするファイルを読ませるにはModules.Sandboxで許可しておく
+func (in *Interpreter) EvalFile(path string) (object.Object, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	prev := in.env.File()
+	in.env.SetFile(abs)
+	defer in.env.SetFile(prev)
+	return in.Eval(string(src))
+}
+
+// Goの値をMonkeyの値に変換してグローバル変数nameに束縛する
+func (in *Interpreter) Set(name string, value interface{}) error {
+	obj, err := ToObject(value)
+	if err != nil {
+		return err
+	}
+	in.env.Set(name, obj)
+	return nil
+}
+
+// グローバル変数nameの値を返す。組み込み関数は含まない
+func (in *Interpreter) Get(name string) (object.Object, bool) {
+	return in.env.Get(name)
+}
+
+// Monkeyの関数(または組み込み関数)をGoの値を引数にして呼び出す
+func (in *Interpreter) Call(fn object.Object, args ...interface{}) (object.Object, error) {
+	return in.CallContext(context.Background(), fn, args...)
+}
+
+// ctxがキャンセルされたら評価を打ち切るCall
+func (in *Interpreter) CallContext(ctx context.Context, fn object.Object, args ...interface{}) (object.Object, error) {
+	objs := make([]object.Object, len(args))
+	for i, arg := range args {
+		obj, err := ToObject(arg)
+		if err != nil {
+			return nil, err
+		}
+		objs[i] = obj
+	}
+
+	return in.run(ctx, func(e *evaluator.Evaluator) object.Object {
+		return e.Apply(fn, objs...)
+	})
+}
+
+// 評価中のGoのpanicはerrorにして返す
+// spawnしたタスクが終わるまで待ってから返る
+func (in *Interpreter) run(ctx context.Context, f func(e *evaluator.Evaluator) object.Object) (result object.Object, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = nil
+			err = fmt.Errorf("internal error: %v", r)
+		}
+	}()
+
+	e := evaluator.NewWithLimits(ctx, in.Limits)
+	e.Modules = in.Modules
+	e.Tasks = in.Tasks
+	evaluated := e.Wait(f(e))
+	if evaluated == nil {
+		return evaluator.NULL, nil
+	}
+	if errObj, ok := evaluated.(*object.Error); ok {
+		return nil, errObj
+	}
+	return evaluated, nil
+}
+
+// Goの値をMonkeyの値に変換する
+// nil, bool, 整数, 浮動小数点数, string, time.Time, time.Duration, スライス, マップ,
+// 組み込み関数として呼べるGoの関数, object.Objectに対応する
+func ToObject(value interface{}) (object.Object, error) {
+	switch v := value.(type) {
+	case nil:
+		return evaluator.NULL, nil
+	case object.Object:
+		return v, nil
+	case bool:
+		if v {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case string:
+		return &object.String{Value: v}, nil
+	case int:
+		return &object.Integer{Value: int64(v)}, nil
+	case int64:
+		return &object.Integer{Value: v}, nil
+	case float64:
+		return &object.Float{Value: v}, nil
+	case float32:
+		return &object.Float{Value: float64(v)}, nil
+	case time.Time:
+		return &object.Time{Value: v}, nil
+	case time.Duration:
+		return &object.Duration{Value: v}, nil
+	case object.BuiltinFunction:
+		return &object.Builtin{Fn: v}, nil
+	case func(args ...object.Object) object.Object:
+		return &object.Builtin{Fn: v}, nil
+	case object.HigherOrderFunction:
+		return &object.Builtin{HigherOrderFn: v}, nil
+	case func(call object.CallFunction, args ...object.Object) object.Object:
+		return &object.Builtin{HigherOrderFn: v}, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	// type ID intのように、名前を付けた型はここで元の種類に合わせて変換する
+	case reflect.Bool:
+		return ToObject(rv.Bool())
+	case reflect.String:
+		return &object.String{Value: rv.String()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: rv.Int()}, nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: rv.Float()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := rv.Uint()
+		if u > 1<<63-1 {
+			return nil, fmt.Errorf("monkey: %d overflows INTEGER", u)
+		}
+		return &object.Integer{Value: int64(u)}, nil
+	case reflect.Slice, reflect.Array:
+		elements := make([]object.Object, rv.Len())
+		for i := range elements {
+			el, err := ToObject(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = el
+		}
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		pairs := make(map[object.HashKey]object.HashPair, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			key, err := ToObject(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("monkey: %s is unusable as hash key", key.Type())
+			}
+			value, err := ToObject(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return &object.Hash{Pairs: pairs}, nil
+	}
+
+	return nil, fmt.Errorf("monkey: cannot convert %T to a Monkey value", value)
+}
+
+// Monkeyの値をGoの値に変換する
+// INTEGERはint64、FLOATはfloat64、BOOLEANはbool、STRINGはstring、NULLはnil、ARRAYは[]interface{}、
+// TIMEはtime.Time、DURATIONはtime.Durationになる
+// HASHはキーがすべてSTRINGならmap[string]interface{}、そうでなければmap[interface{}]interface{}になる
+// それ以外(関数など)はobject.Objectのまま返す
+func FromObject(obj object.Object) interface{} {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value
+	case *object.Float:
+		return obj.Value
+	case *object.Boolean:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	case *object.Null:
+		return nil
+	case *object.Time:
+		return obj.Value
+	case *object.Duration:
+		return obj.Value
+	case *object.Array:
+		values := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			values[i] = FromObject(el)
+		}
+		return values
+	case *object.Hash:
+		return fromHash(obj)
+	default:
+		return obj
+	}
+}
+
+func fromHash(hash *object.Hash) interface{} {
+	stringKeys := true
+	for _, pair := range hash.Pairs {
+		if _, ok := pair.Key.(*object.String); !ok {
+			stringKeys = false
+			break
+		}
+	}
+
+	if stringKeys {
+		values := make(map[string]interface{}, len(hash.Pairs))
+		for _, pair := range hash.Pairs {
+			values[pair.Key.(*object.String).Value] = FromObject(pair.Value)
+		}
+		return values
+	}
+
+	values := make(map[interface{}]interface{}, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		values[FromObject(pair.Key)] = FromObject(pair.Value)
+	}
+	return values
+}
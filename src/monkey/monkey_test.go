@@ -0,0 +1,316 @@
+package monkey
+
+import (
+	"context"
+	"io/ioutil"
+	"monkey/evaluator"
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEval(t *testing.T) {
+	in := New()
+
+	result, err := in.Eval("let add = fn(x, y) { x + y }; add(1, 2)")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if FromObject(result) != int64(3) {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+
+	// 前のEvalで束縛した値が残っている
+	result, err = in.Eval("add(10, 20)")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if FromObject(result) != int64(30) {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+
+	result, err = in.Eval("let x = 1;")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if FromObject(result) != nil {
+		t.Errorf("let should evaluate to null. got=%s", result.Inspect())
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	in := New()
+
+	_, err := in.Eval("let = 1;")
+	parseErr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("err is not *ParseError. got=%T (%v)", err, err)
+	}
+	if len(parseErr.Errors) == 0 {
+		t.Errorf("parse error has no messages")
+	}
+
+	_, err = in.Eval("1 + true")
+	runtimeErr, ok := err.(*object.Error)
+	if !ok {
+		t.Fatalf("err is not *object.Error. got=%T (%v)", err, err)
+	}
+
+	expected := "TypeError at line 1, column 3: type mismatch: INTEGER + BOOLEAN"
+	if runtimeErr.Error() != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, runtimeErr.Error())
+	}
+}
+
+func TestEvalFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "lib.mk"), []byte("export let x = 1;"), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "main.mk"), []byte(`import "./lib" as l; l.x`), 0666)
+
+	in := New()
+	in.Modules.Sandbox(evaluator.OSFileSystem{}, dir)
+	result, err := in.EvalFile(filepath.Join(dir, "main.mk"))
+	if err != nil {
+		t.Fatalf("EvalFile returned error: %s", err)
+	}
+	if result.Inspect() != "1" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+
+	// 後のEvalの相対パスは、評価したファイルではなくカレントディレクトリから探す
+	if _, err = in.Eval(`import "./lib" as l;`); err == nil {
+		t.Errorf("./lib should not be found after EvalFile returned")
+	}
+}
+
+func TestNoFileAccessByDefault(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "lib.mk"), []byte("export let x = 1;"), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "secret.txt"), []byte("s"), 0666)
+
+	in := New()
+	in.Set("dir", dir)
+	tests := []struct {
+		input string
+		kind  string
+	}{
+		{`import "fs" as fs; fs.readFile(dir + "/secret.txt")`, object.IO_ERROR},
+		{`import "fs" as fs; fs.writeFile(dir + "/out.txt", "x")`, object.IO_ERROR},
+		{`import "fs" as fs; fs.mkdir(dir + "/sub")`, object.IO_ERROR},
+		{`import "fs" as fs; fs.listDir(dir)`, object.IO_ERROR},
+		{`import "` + filepath.ToSlash(filepath.Join(dir, "lib")) + `" as lib; lib.x`, object.IMPORT_ERROR},
+	}
+	for _, tt := range tests {
+		_, err := in.Eval(tt.input)
+		errObj, ok := err.(*object.Error)
+		if !ok || errObj.Kind != tt.kind {
+			t.Errorf("%s: expected %s. got=%v", tt.input, tt.kind, err)
+		}
+	}
+
+	names, _ := ioutil.ReadDir(dir)
+	if len(names) != 2 {
+		t.Errorf("script should not create files. got %d entries", len(names))
+	}
+}
+
+func TestInternalError(t *testing.T) {
+	in := New()
+	in.Set("boom", func(args ...object.Object) object.Object { panic("boom") })
+
+	_, err := in.Eval("boom()")
+	if err == nil || err.Error() != "internal error: boom" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestSetAndGet(t *testing.T) {
+	in := New()
+
+	if err := in.Set("limit", 10); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := in.Set("names", []string{"a", "b"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := in.Set("greet", func(args ...object.Object) object.Object {
+		return &object.String{Value: "hello " + args[0].Inspect()}
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, err := in.Eval(`let total = limit * 2; greet(names[1])`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if FromObject(result) != "hello b" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+
+	total, ok := in.Get("total")
+	if !ok {
+		t.Fatalf("total is not bound")
+	}
+	if FromObject(total) != int64(20) {
+		t.Errorf("wrong total. got=%s", total.Inspect())
+	}
+
+	if _, ok := in.Get("undefined"); ok {
+		t.Errorf("undefined should not be bound")
+	}
+
+	if err := in.Set("bad", struct{}{}); err == nil {
+		t.Errorf("expected an error when setting an unsupported value")
+	}
+}
+
+func TestCall(t *testing.T) {
+	in := New()
+
+	_, err := in.Eval(`let add = fn(x, y) { x + y };`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	add, _ := in.Get("add")
+
+	result, err := in.Call(add, 2, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if FromObject(result) != int64(5) {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+
+	_, err = in.Call(add, 2, true)
+	if _, ok := err.(*object.Error); !ok {
+		t.Errorf("err is not *object.Error. got=%T (%v)", err, err)
+	}
+
+	_, err = in.Call(add, 1)
+	if _, ok := err.(*object.Error); !ok {
+		t.Errorf("err is not *object.Error. got=%T (%v)", err, err)
+	}
+
+	// Goの関数からMonkeyの関数を呼び戻す
+	if err := in.Set("twice", func(call object.CallFunction, args ...object.Object) object.Object {
+		return call(args[0], call(args[0], args[1]))
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	result, err = in.Eval(`twice(fn(x) { x * 3 }, 2)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if FromObject(result) != int64(18) {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+}
+
+func TestLimits(t *testing.T) {
+	in := New()
+	in.Limits = evaluator.Limits{MaxSteps: 500}
+
+	_, err := in.Eval(`let f = fn(n) { f(n + 1) }; f(0)`)
+	errObj, ok := err.(*object.Error)
+	if !ok {
+		t.Fatalf("err is not *object.Error. got=%T (%v)", err, err)
+	}
+	if errObj.Kind != object.STEP_LIMIT_ERROR {
+		t.Errorf("wrong error kind. got=%s", errObj.Kind)
+	}
+
+	// 制限は実行のたびに数え直される
+	result, err := in.Eval(`1 + 1`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if FromObject(result) != int64(2) {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	in.Limits = evaluator.Limits{}
+	_, err = in.EvalContext(ctx, `let spin = fn(n) { if (n < 2) { n } else { spin(n - 1) + spin(n - 2) } }; spin(50)`)
+	errObj, ok = err.(*object.Error)
+	if !ok {
+		t.Fatalf("err is not *object.Error. got=%T (%v)", err, err)
+	}
+	if errObj.Kind != object.TIMEOUT_ERROR {
+		t.Errorf("wrong error kind. got=%s", errObj.Kind)
+	}
+}
+
+type (
+	testID    int
+	testCount int64
+	testName  string
+	testFlag  bool
+	testRatio float32
+)
+
+func TestConversions(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected interface{}
+	}{
+		{nil, nil},
+		{true, true},
+		{5, int64(5)},
+		{int32(-5), int64(-5)},
+		{uint8(5), int64(5)},
+		{1.5, 1.5},
+		{float32(0.25), 0.25},
+		{"monkey", "monkey"},
+		{[]int{1, 2}, []interface{}{int64(1), int64(2)}},
+		{[]interface{}{"a", false, nil}, []interface{}{"a", false, nil}},
+		{map[string]int{"a": 1}, map[string]interface{}{"a": int64(1)}},
+		{map[int]bool{1: true}, map[interface{}]interface{}{int64(1): true}},
+		{time.Date(2024, 5, 17, 9, 0, 0, 0, time.UTC), time.Date(2024, 5, 17, 9, 0, 0, 0, time.UTC)},
+		{90 * time.Second, 90 * time.Second},
+		{testID(7), int64(7)},
+		{testCount(-7), int64(-7)},
+		{testName("m"), "m"},
+		{testFlag(true), true},
+		{testRatio(0.5), 0.5},
+		{[]testName{"a"}, []interface{}{"a"}},
+		{map[testName]testID{"a": 1}, map[string]interface{}{"a": int64(1)}},
+	}
+
+	for _, tt := range tests {
+		obj, err := ToObject(tt.input)
+		if err != nil {
+			t.Errorf("ToObject(%v) returned error: %s", tt.input, err)
+			continue
+		}
+
+		got := FromObject(obj)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("round trip of %v wrong. want=%#v, got=%#v", tt.input, tt.expected, got)
+		}
+	}
+
+	if _, err := ToObject(uint64(1 << 63)); err == nil {
+		t.Errorf("expected an overflow error")
+	}
+	if _, err := ToObject(map[float64]int{1.5: 1}); err == nil {
+		t.Errorf("expected an error for an unusable hash key")
+	}
+}
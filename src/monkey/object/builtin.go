@@ -0,0 +1,84 @@
+package object
+
+import "fmt"
+
+// Goで書かれた組み込み関数
+// エラーにしたいときは*Errorを返す。位置とスタックは呼び出し元で埋められる
+type BuiltinFunction func(args ...Object) Object
+
+// 組み込み関数の中から、引数に渡された関数(Monkeyの関数か組み込み関数)を呼び出す
+// 呼び出した関数の中でエラーになると*Errorが返るので、そのまま返せばエラーが伝わる
+type CallFunction func(fn Object, args ...Object) Object
+
+// mapのように、引数に渡された関数を呼び出す組み込み関数
+type HigherOrderFunction func(call CallFunction, args ...Object) Object
+
+type Builtin struct {
+	Fn BuiltinFunction
+
+	// nilでなければFnの代わりに呼ばれる
+	HigherOrderFn HigherOrderFunction
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin function" }
+
+// CheckArgTypesでどの型でもよい引数に使う
+const ANY_OBJ = "ANY"
+
+// 組み込み関数の中から返すためのエラーを作る
+func NewError(kind string, format string, a ...interface{}) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
+
+// 引数の数がちょうどwant個でなければエラーを返す
+func CheckArgCount(name string, args []Object, want int) *Error {
+	if len(args) != want {
+		return NewError(ARGUMENT_ERROR, "wrong number of arguments to %s: want=%d, got=%d",
+			name, want, len(args))
+	}
+	return nil
+}
+
+// 引数の数がmin個以上max個以下でなければエラーを返す。maxが負なら上限なし
+func CheckArgRange(name string, args []Object, min, max int) *Error {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		if max < 0 {
+			return NewError(ARGUMENT_ERROR, "wrong number of arguments to %s: want at least %d, got=%d",
+				name, min, len(args))
+		}
+		return NewError(ARGUMENT_ERROR, "wrong number of arguments to %s: want %d to %d, got=%d",
+			name, min, max, len(args))
+	}
+	return nil
+}
+
+// 引数の数と型をまとめて検査する。typesの要素がANY_OBJならその引数の型は問わない
+func CheckArgTypes(name string, args []Object, types ...ObjectType) *Error {
+	if err := CheckArgCount(name, args, len(types)); err != nil {
+		return err
+	}
+
+	for i, t := range types {
+		if t != ANY_OBJ && args[i].Type() != t {
+			return NewError(TYPE_ERROR, "argument %d to %s must be %s, got %s",
+				i+1, name, t, args[i].Type())
+		}
+	}
+	return nil
+}
+
+// 最初のmin個が必須で残りは省略できる引数の数と型を検査する。typesの要素の意味はCheckArgTypesと同じ
+func CheckOptionalArgTypes(name string, args []Object, min int, types ...ObjectType) *Error {
+	if err := CheckArgRange(name, args, min, len(types)); err != nil {
+		return err
+	}
+
+	for i, arg := range args {
+		if types[i] != ANY_OBJ && arg.Type() != types[i] {
+			return NewError(TYPE_ERROR, "argument %d to %s must be %s, got %s",
+				i+1, name, types[i], arg.Type())
+		}
+	}
+	return nil
+}
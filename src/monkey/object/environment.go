@@ -0,0 +1,73 @@
+package object
+
+import (
+	"sort"
+	"sync"
+)
+
+// 識別子と値の対応を保持する
+// outerには外側のスコープ(関数を定義した環境)が入る
+// クロージャを通して複数のタスクから使われることがあるので、storeはmuで守る
+type Environment struct {
+	mu    sync.RWMutex
+	store map[string]Object
+	outer *Environment
+	file  string // この環境で評価しているファイル。importの相対パスの起点になる
+}
+
+func NewEnvironment() *Environment {
+	s := make(map[string]Object)
+	return &Environment{store: s, outer: nil}
+}
+
+// 関数呼び出しのたびに、関数が定義された環境を包んだ新しい環境を作る
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+// 見つからなければ外側の環境を順にたどる
+func (e *Environment) Get(name string) (Object, bool) {
+	e.mu.RLock()
+	obj, ok := e.store[name]
+	e.mu.RUnlock()
+	if !ok && e.outer != nil {
+		obj, ok = e.outer.Get(name)
+	}
+	return obj, ok
+}
+
+func (e *Environment) Set(name string, val Object) Object {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.store[name] = val
+	return val
+}
+
+// このスコープで束縛されている名前を辞書順で返す(外側の環境は含まない)
+func (e *Environment) Names() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// モジュールのトップレベルの環境に、評価しているファイルのパスを記録する
+func (e *Environment) SetFile(path string) {
+	e.file = path
+}
+
+// 評価しているファイルのパス。外側の環境を順にたどり、見つからなければ空
+func (e *Environment) File() string {
+	if e.file == "" && e.outer != nil {
+		return e.outer.File()
+	}
+	return e.file
+}
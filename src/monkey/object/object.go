@@ -1,15 +1,64 @@
 package object
 
-import "fmt"
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"monkey/ast"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type ObjectType string
 
 const (
-	INTEGER_OBJ = "INTEGER"
-	BOOLEAN_OBJ = "BOOLEAN"
-	NULL_OBJ    = "NULL"
+	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
+	BOOLEAN_OBJ      = "BOOLEAN"
+	NULL_OBJ         = "NULL"
+	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	ERROR_OBJ        = "ERROR"
+	FUNCTION_OBJ     = "FUNCTION"
+	STRING_OBJ       = "STRING"
+	EXCEPTION_OBJ    = "EXCEPTION"
+	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
+	REGEX_OBJ        = "REGEX"
+	TIME_OBJ         = "TIME"
+	DURATION_OBJ     = "DURATION"
+	CHANNEL_OBJ      = "CHANNEL"
+	BUILTIN_OBJ      = "BUILTIN"
+	MODULE_OBJ       = "MODULE"
+)
+
+// エラーの種類。catchしたエラーのkindとして見える
+const (
+	TYPE_ERROR          = "TypeError"
+	NAME_ERROR          = "NameError"
+	ARGUMENT_ERROR      = "ArgumentError"
+	ZERO_DIVISION_ERROR = "ZeroDivisionError"
+	INDEX_ERROR         = "IndexError"
+	VALUE_ERROR         = "ValueError"
+	THROWN_ERROR        = "Error" // throw文で投げられた値
+	IMPORT_ERROR        = "ImportError"
+	IO_ERROR            = "IOError"
+	PERMISSION_ERROR    = "PermissionError" // 許可されていないファイルに触れようとしたとき
+	CHANNEL_ERROR       = "ChannelError"    // 閉じたチャネルに送ったり、2回閉じたりしたとき
+	DEADLOCK_ERROR      = "DeadlockError"   // すべてのタスクがチャネルを待って止まったとき
+
+	// 実行の制限を超えたとき
+	STEP_LIMIT_ERROR   = "StepLimitError"
+	TIMEOUT_ERROR      = "TimeoutError"
+	CANCELLED_ERROR    = "CancelledError"
+	RECURSION_ERROR    = "RecursionError"
+	MEMORY_LIMIT_ERROR = "MemoryLimitError"
 )
 
+// オブジェクトは作ったあとで変更しない(配列やハッシュを変える組み込み関数も新しいものを返す)
+// そのため、spawnで起動した複数のタスクから同時に読んでもよい
 type Object interface {
 	Type() ObjectType
 	Inspect() string
@@ -19,6 +68,10 @@ type Integer struct {
 	Value int64
 }
 
+type Float struct {
+	Value float64
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -33,6 +86,19 @@ func (i *Integer) Type() ObjectType {
 	return INTEGER_OBJ
 }
 
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
+// 整数と見分けがつくように、小数部がなくても"1.0"のように".0"をつける
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
 func (b *Boolean) Type() ObjectType {
 	return BOOLEAN_OBJ
 }
@@ -48,3 +114,266 @@ func (n *Null) Type() ObjectType {
 func (n *Null) Inspect() string {
 	return "null"
 }
+
+// return文の値を包んで、ブロックの評価を途中で打ち切るために使う
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+
+// 呼び出しスタックの1段分
+// Functionは呼び出された関数の名前、Line/Columnは呼び出し式の位置
+type Frame struct {
+	Function string
+	Line     int
+	Column   int
+}
+
+func (f Frame) String() string {
+	return fmt.Sprintf("line %d, column %d, in %s", f.Line, f.Column, f.Function)
+}
+
+// 評価中に起きたエラー
+// Line/Columnはエラーが起きたノードの位置、Stackはその時点の呼び出しスタック(外側から順)
+// throw文で投げられた場合はValueに投げられた値が入る
+type Error struct {
+	Kind    string
+	Message string
+	Line    int
+	Column  int
+	Stack   []Frame
+	Value   Object
+}
+
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+
+// Pythonのトレースバックのような形式で、呼び出しスタックとエラーの内容を返す
+func (e *Error) Traceback() string {
+	var out bytes.Buffer
+
+	if len(e.Stack) > 0 {
+		out.WriteString("Traceback (most recent call last):\n")
+		for _, f := range e.Stack {
+			out.WriteString("  " + f.String() + "\n")
+		}
+	}
+	out.WriteString(e.Error())
+
+	return out.String()
+}
+
+// Goのerrorとしても扱えるようにする
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at line %d, column %d: %s",
+		e.kind(), e.Line, e.Column, e.Message)
+}
+
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+	Name       string // 無名関数なら空
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(f.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+func (e *Error) kind() string {
+	if e.Kind == "" {
+		return THROWN_ERROR
+	}
+	return e.Kind
+}
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+
+// catchで束縛されたエラー
+// Errorと違って評価を打ち切らないので、普通の値として変数に入れたり渡したりできる
+// e["message"], e["kind"], e["trace"] のように添字で中身を取り出す
+type Exception struct {
+	Error *Error
+}
+
+func (ex *Exception) Type() ObjectType { return EXCEPTION_OBJ }
+func (ex *Exception) Inspect() string {
+	return ex.Error.kind() + ": " + ex.Error.Message
+}
+
+// 添字で取り出せるフィールド。存在しないキーならfalseを返す
+// throwされた値がない場合のvalueはnil(Monkeyのnull)になる
+func (ex *Exception) Field(name string) (Object, bool) {
+	switch name {
+	case "message":
+		return &String{Value: ex.Error.Message}, true
+	case "kind":
+		return &String{Value: ex.Error.kind()}, true
+	case "trace":
+		return &String{Value: ex.Error.Traceback()}, true
+	case "line":
+		return &Integer{Value: int64(ex.Error.Line)}, true
+	case "column":
+		return &Integer{Value: int64(ex.Error.Column)}, true
+	case "value":
+		return ex.Error.Value, true
+	default:
+		return nil, false
+	}
+}
+
+type Array struct {
+	Elements []Object
+}
+
+func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
+func (ao *Array) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, e := range ao.Elements {
+		elements = append(elements, e.Inspect())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// importで読み込んだモジュール
+// Exportsにはexportされた束縛だけが入り、u.helperのようにメンバーとして取り出す
+type Module struct {
+	Name    string
+	Path    string // 読み込んだファイルの絶対パス。Goで書かれたモジュールなら空
+	Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "<module " + m.Name + ">" }
+
+// ハッシュのキーとして使える値
+// 値が同じなら別のオブジェクトでも同じHashKeyになる
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+// Inspectで元のキーを表示できるように、キーも値と一緒に持つ
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+type Hash struct {
+	Pairs map[HashKey]HashPair
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+
+// 表示が毎回同じになるようにキーの順に並べる
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range h.SortedPairs() {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// キーの型名、キーのInspectの順に並べた組を返す
+func (h *Hash) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		ki, kj := pairs[i].Key, pairs[j].Key
+		if ki.Type() != kj.Type() {
+			return ki.Type() < kj.Type()
+		}
+		if a, ok := ki.(*Integer); ok {
+			return a.Value < kj.(*Integer).Value
+		}
+		return ki.Inspect() < kj.Inspect()
+	})
+	return pairs
+}
+
+// regex.compileでコンパイルした正規表現。一度コンパイルすれば何度でも使える
+type Regex struct {
+	Regexp *regexp.Regexp
+}
+
+func (r *Regex) Type() ObjectType { return REGEX_OBJ }
+func (r *Regex) Inspect() string  { return "/" + r.Regexp.String() + "/" }
+
+// timeモジュールで扱う時刻。タイムゾーンを持つ
+type Time struct {
+	Value time.Time
+}
+
+func (t *Time) Type() ObjectType { return TIME_OBJ }
+
+// RFC 3339で表す。秒未満があるときだけ小数をつける
+func (t *Time) Inspect() string { return t.Value.Format(time.RFC3339Nano) }
+
+// 時間の長さ。1h30m0sのように表す
+type Duration struct {
+	Value time.Duration
+}
+
+func (d *Duration) Type() ObjectType { return DURATION_OBJ }
+func (d *Duration) Inspect() string  { return d.Value.String() }
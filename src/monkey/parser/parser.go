@@ -12,9 +12,16 @@ type Parser struct {
 	l      *lexer.Lexer
 	errors []string
 
+	// 入力の終わりに達したせいでエラーになったか(REPLで続きの行を読むかどうかに使う)
+	unexpectedEOF bool
+
 	curToken  token.Token
 	peekToken token.Token
 
+	comments []token.Token // 読み飛ばしたコメント
+
+	blockDepth int // 今いるブロックの深さ。exportはトップレベル(0)にしか書けない
+
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
@@ -30,6 +37,10 @@ func New(l *lexer.Lexer) *Parser {
 	// token.IDENTが出現したらp.parseIdentifierが呼ばれる？
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	//boolean用
@@ -46,11 +57,16 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseMemberExpression)
 
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
+	p.registerPrefix(token.SPAWN, p.parseSpawnExpression)
+	p.registerPrefix(token.SELECT, p.parseSelectExpression)
 
 	// 2つのトークンを読み込む。curTokenとpeekTokenの両方がセットされる
 	//p.curToken = nil p.peekToken = 1つ目のトークン
@@ -67,9 +83,14 @@ func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// コメントは構文に関係ないので読み飛ばし、フォーマッタのためにp.commentsにとっておく
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	for p.peekToken.Type == token.COMMENT {
+		p.comments = append(p.comments, p.peekToken)
+		p.peekToken = p.l.NextToken()
+	}
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -85,6 +106,7 @@ func (p *Parser) ParseProgram() *ast.Program {
 		}
 		p.nextToken()
 	}
+	program.Comments = p.comments
 	return program
 }
 
@@ -95,6 +117,12 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -124,6 +152,11 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
+	// let add = fn(x, y) {...} の場合は関数リテラルに名前を覚えさせておく(トレースバック用)
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -157,6 +190,13 @@ func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s insted",
 		t, p.peekToken.Type)
 	p.errors = append(p.errors, msg)
+	p.unexpectedEOF = p.unexpectedEOF || p.peekTokenIs(token.EOF)
+}
+
+// 入力が途中で終わっていたせいで構文エラーになった場合にtrueを返す
+// 続きを読めば正しいプログラムになるかもしれない
+func (p *Parser) UnexpectedEOF() bool {
+	return p.unexpectedEOF
 }
 
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
@@ -245,6 +285,7 @@ const (
 	PRODUCT     // *
 	PREFIX      // -X または !X
 	CALL        // myFunction(X)
+	INDEX       // array[index]
 )
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
@@ -262,9 +303,25 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	defer untrace(trace("parseFloatLiteral"))
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		msg := fmt.Sprintf("could not parse %q as float", p.curToken.Literal)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	lit.Value = value
+
+	return lit
+}
+
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
 	p.errors = append(p.errors, msg)
+	p.unexpectedEOF = p.unexpectedEOF || t == token.EOF
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
@@ -292,6 +349,8 @@ var precedence = map[token.TokenType]int{
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
 	token.LPAREN:   CALL,
+	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
 }
 
 // 次のトークンタイプの優先順位のナンバーを返す
@@ -381,6 +440,9 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
 
+	p.blockDepth++
+	defer func() { p.blockDepth-- }()
+
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
@@ -390,6 +452,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
+	block.Rbrace = p.curToken
 	return block
 }
 
@@ -446,13 +509,15 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	// addをprefixで評価し、leftExpにいれた状態。現在は(。
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
-	exp.Arguments = p.parseCallArguments()
+	exp.Arguments = p.parseExpressionList(token.RPAREN)
 	return exp
 }
-func (p *Parser) parseCallArguments() []ast.Expression {
+
+// 呼び出しの引数や配列の要素のように、endまでカンマ区切りで並んだ式を読む
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	args := []ast.Expression{}
 
-	if p.peekTokenIs(token.RPAREN) {
+	if p.peekTokenIs(end) {
 		p.nextToken()
 		return args
 	}
@@ -473,8 +538,282 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 		args = append(args, p.parseExpression(LOWEST))
 	}
 
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectPeek(end) {
 		return nil
 	}
 	return args
 }
+
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+
+	return array
+}
+
+// {キー: 値, ...} 現在は{
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken, Pairs: []*ast.HashPair{}}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		pair := &ast.HashPair{Token: p.curToken, Key: key}
+
+		p.nextToken()
+		pair.Value = p.parseExpression(LOWEST)
+		hash.Pairs = append(hash.Pairs, pair)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return hash
+}
+
+// leftにはmyArrayとかが渡される。現在は[
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+
+	p.nextToken()
+	exp.Index = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
+// import "path" as name;
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	stmt.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.AS) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// export let x = 5;
+func (p *Parser) parseExportStatement() *ast.ExportStatement {
+	stmt := &ast.ExportStatement{Token: p.curToken}
+
+	if p.blockDepth > 0 {
+		p.errors = append(p.errors, "export is only allowed at the top level")
+	}
+
+	if !p.expectPeek(token.LET) {
+		return nil
+	}
+
+	stmt.Statement = p.parseLetStatement()
+	if stmt.Statement == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+// leftにはモジュールなどが渡される。現在は.
+func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: p.curToken, Object: left}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	exp.Member = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return exp
+}
+
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		// catch (e) のかっこと識別子は省略できない
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		expression.CatchParam = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	if expression.Catch == nil && expression.Finally == nil {
+		msg := fmt.Sprintf("expected catch or finally after try block, got %s insted",
+			p.peekToken.Type)
+		p.errors = append(p.errors, msg)
+		p.unexpectedEOF = p.unexpectedEOF || p.peekTokenIs(token.EOF)
+		return nil
+	}
+
+	return expression
+}
+
+// spawnの後ろには関数呼び出ししか書けない
+func (p *Parser) parseSpawnExpression() ast.Expression {
+	expression := &ast.SpawnExpression{Token: p.curToken}
+
+	p.nextToken()
+	call := p.parseExpression(PREFIX)
+	if call == nil {
+		return nil
+	}
+	if _, ok := call.(*ast.CallExpression); !ok {
+		msg := fmt.Sprintf("expected function call after spawn, got %s insted", call.String())
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	expression.Call = call
+
+	return expression
+}
+
+func (p *Parser) parseSelectExpression() ast.Expression {
+	expression := &ast.SelectExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		switch {
+		case p.peekTokenIs(token.CASE):
+			p.nextToken()
+			c := p.parseSelectCase()
+			if c == nil {
+				return nil
+			}
+			expression.Cases = append(expression.Cases, c)
+		case p.peekTokenIs(token.DEFAULT) && expression.Default == nil:
+			p.nextToken()
+			if !p.expectPeek(token.LBRACE) {
+				return nil
+			}
+			expression.Default = p.parseBlockStatement()
+		default:
+			msg := fmt.Sprintf("expected case or default in select, got %s insted", p.peekToken.Type)
+			p.errors = append(p.errors, msg)
+			p.unexpectedEOF = p.unexpectedEOF || p.peekTokenIs(token.EOF)
+			return nil
+		}
+	}
+	p.nextToken()
+	expression.Rbrace = p.curToken
+
+	return expression
+}
+
+// case let v = recv(ch) { } か case send(ch, v) { }
+func (p *Parser) parseSelectCase() *ast.SelectCase {
+	c := &ast.SelectCase{Token: p.curToken}
+
+	if p.peekTokenIs(token.LET) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		c.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectPeek(token.ASSIGN) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+	operation := p.parseExpression(LOWEST)
+	if operation == nil {
+		return nil
+	}
+	call, ok := operation.(*ast.CallExpression)
+	name := ""
+	if ok {
+		if ident, ok := call.Function.(*ast.Identifier); ok {
+			name = ident.Value
+		}
+	}
+	switch {
+	case name == "recv" && len(call.Arguments) == 1:
+	case name == "send" && len(call.Arguments) == 2 && c.Name == nil:
+	default:
+		msg := fmt.Sprintf("expected recv(ch) or send(ch, value) in select case, got %s insted", operation.String())
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	c.Operation = operation
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	c.Body = p.parseBlockStatement()
+
+	return c
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"reflect"
 	"testing"
 )
 
@@ -143,6 +144,29 @@ func TestIdentifierExpression(t *testing.T) {
 	}
 }
 
+func TestIdentifiersWithDigits(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x1 = 1;", "let x1 = 1;"},
+		{"x1 + y2 * 3", "(x1 + (y2 * 3))"},
+		{"fn(a1, b2) { a1 }(1, 2)", "fn(a1,b2)a1(1, 2)"},
+		{"log10(x)[0]", "(log10(x)[0])"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
 func TestIntegerLiteralExpression(t *testing.T) {
 	input := "5;"
 
@@ -172,6 +196,25 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	l := lexer.New("3.25;")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != 3.25 {
+		t.Errorf("literal.Value not %g. got=%g", 3.25, literal.Value)
+	}
+	if literal.TokenLiteral() != "3.25" {
+		t.Errorf("literal.TokenLiteral not %s. got=%s", "3.25", literal.TokenLiteral())
+	}
+}
+
 // <prefix operator><expression>
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
@@ -383,6 +426,18 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		{
+			"a * e[b * c] * d",
+			"((a * (e[(b * c)])) * d)",
+		},
+		{
+			"-u.x * u.f(1).y",
+			"((-(u.x)) * ((u.f)(1).y))",
+		},
+		{
+			"add(a * e[\"kind\"], f(b)[c])",
+			"add((a * (e[kind])), (f(b)[c]))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -733,3 +788,546 @@ func TestCallExpressionParsing(t *testing.T) {
 	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
 	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
 }
+
+func TestFunctionLiteralWithName(t *testing.T) {
+	input := `let myFunction = fn() { };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T",
+			program.Statements[0])
+	}
+
+	function, ok := stmt.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.FunctionLiteral. got=%T", stmt.Value)
+	}
+
+	if function.Name != "myFunction" {
+		t.Fatalf("function literal name wrong. want 'myFunction', got=%q\n",
+			function.Name)
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello world";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Value != "hello world" {
+		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+	}
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	input := "e[1 + 1]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, indexExp.Left, "e") {
+		return
+	}
+
+	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
+		return
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	input := `throw x;`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ThrowStatement. got=%T", program.Statements[0])
+	}
+
+	if stmt.TokenLiteral() != "throw" {
+		t.Errorf("stmt.TokenLiteral not 'throw', got %q", stmt.TokenLiteral())
+	}
+
+	testIdentifier(t, stmt.Value, "x")
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input      string
+		catchParam string
+		hasFinally bool
+	}{
+		{`try { x } catch (e) { y }`, "e", false},
+		{`try { x } finally { y }`, "", true},
+		{`try { x } catch (err) { y } finally { z }`, "err", true},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.TryExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T", stmt.Expression)
+		}
+
+		if len(exp.Block.Statements) != 1 {
+			t.Errorf("try block is not 1 statements. got=%d", len(exp.Block.Statements))
+		}
+
+		if tt.catchParam == "" {
+			if exp.Catch != nil || exp.CatchParam != nil {
+				t.Errorf("exp.Catch was not nil. got=%+v", exp.Catch)
+			}
+		} else {
+			testIdentifier(t, exp.CatchParam, tt.catchParam)
+			if exp.Catch == nil || len(exp.Catch.Statements) != 1 {
+				t.Errorf("catch block is not 1 statements. got=%+v", exp.Catch)
+			}
+		}
+
+		if (exp.Finally != nil) != tt.hasFinally {
+			t.Errorf("exp.Finally wrong. want present=%t, got=%+v", tt.hasFinally, exp.Finally)
+		}
+	}
+}
+
+func TestTryExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { x }`, "expected catch or finally after try block, got EOF insted"},
+		{`try { x } catch { y }`, "expected next token to be (, got { insted"},
+		{`try { x } catch (1) { y }`, "expected next token to be INDENT, got INT insted"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q, got none", tt.input)
+			continue
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("wrong parser error. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestSpawnExpression(t *testing.T) {
+	input := `spawn worker(1, x)`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.SpawnExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.SpawnExpression. got=%T", stmt.Expression)
+	}
+
+	call, ok := exp.Call.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("exp.Call is not ast.CallExpression. got=%T", exp.Call)
+	}
+	if !testIdentifier(t, call.Function, "worker") {
+		return
+	}
+	if len(call.Arguments) != 2 {
+		t.Errorf("wrong length of arguments. got=%d", len(call.Arguments))
+	}
+}
+
+func TestSelectExpression(t *testing.T) {
+	input := `select {
+  case let v = recv(a) { v }
+  case recv(b) { 1 }
+  case send(c, 2) { }
+  default { 0 }
+}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.SelectExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.SelectExpression. got=%T", stmt.Expression)
+	}
+
+	tests := []struct {
+		name      string
+		operation string
+		body      int
+	}{
+		{"v", "recv(a)", 1},
+		{"", "recv(b)", 1},
+		{"", "send(c, 2)", 0},
+	}
+
+	if len(exp.Cases) != len(tests) {
+		t.Fatalf("select does not have %d cases. got=%d", len(tests), len(exp.Cases))
+	}
+	for i, tt := range tests {
+		c := exp.Cases[i]
+		if tt.name == "" {
+			if c.Name != nil {
+				t.Errorf("cases[%d].Name was not nil. got=%+v", i, c.Name)
+			}
+		} else {
+			testIdentifier(t, c.Name, tt.name)
+		}
+		if c.Operation.String() != tt.operation {
+			t.Errorf("cases[%d].Operation wrong. expected=%q, got=%q", i, tt.operation, c.Operation.String())
+		}
+		if len(c.Body.Statements) != tt.body {
+			t.Errorf("cases[%d] body is not %d statements. got=%d", i, tt.body, len(c.Body.Statements))
+		}
+	}
+
+	if exp.Default == nil || len(exp.Default.Statements) != 1 {
+		t.Errorf("default block is not 1 statements. got=%+v", exp.Default)
+	}
+}
+
+func TestSpawnAndSelectErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`spawn f`, "expected function call after spawn, got f insted"},
+		{`spawn 1 + 2`, "expected function call after spawn, got 1 insted"},
+		{`select { case f(a) { } }`, "expected recv(ch) or send(ch, value) in select case, got f(a) insted"},
+		{`select { case recv(a, b) { } }`, "expected recv(ch) or send(ch, value) in select case, got recv(a, b) insted"},
+		{`select { case let v = send(a, 1) { } }`, "expected recv(ch) or send(ch, value) in select case, got send(a, 1) insted"},
+		{`select { case let 1 = recv(a) { } }`, "expected next token to be INDENT, got INT insted"},
+		{`select { default { } default { } }`, "expected case or default in select, got DEFAULT insted"},
+		{`select { 1 }`, "expected case or default in select, got INT insted"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q, got none", tt.input)
+			continue
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("wrong parser error. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestParsingArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestUnexpectedEOF(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let x = 5;", false},
+		{"let x =", true},
+		{"let", true},
+		{"fn(x, y) {", false},
+		{"add(1,", true},
+		{"5 +", true},
+		{"try { 1 }", true},
+		{"let = 5;", false},
+		{"let x 5;", false},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if p.UnexpectedEOF() != tt.expected {
+			t.Errorf("UnexpectedEOF() wrong for %q. want=%t, got=%t (errors=%q)",
+				tt.input, tt.expected, p.UnexpectedEOF(), p.Errors())
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// header
+let x = 5; // five
+let add = fn(a, b) {
+  // body
+  a + b
+};`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+
+	expected := []struct {
+		literal string
+		line    int
+		column  int
+	}{
+		{"// header", 1, 1},
+		{"// five", 2, 12},
+		{"// body", 4, 3},
+	}
+
+	if len(program.Comments) != len(expected) {
+		t.Fatalf("wrong number of comments. want=%d, got=%d", len(expected), len(program.Comments))
+	}
+
+	for i, want := range expected {
+		c := program.Comments[i]
+		if c.Literal != want.literal || c.Line != want.line || c.Column != want.column {
+			t.Errorf("comments[%d] wrong. want=%q at %d:%d, got=%q at %d:%d",
+				i, want.literal, want.line, want.column, c.Literal, c.Line, c.Column)
+		}
+	}
+
+	fn := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if fn.Body.Rbrace.Line != 6 || fn.Body.Rbrace.Column != 1 {
+		t.Errorf("wrong Rbrace position. got=%d:%d", fn.Body.Rbrace.Line, fn.Body.Rbrace.Column)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	input := `// fibonacci
+let fib = fn(n) {
+  if (n < 2) { return n; } else { fib(n - 1) + fib(n - 2) }
+};
+let xs = [fib(10), -1 * 2, !true, "s"][0];
+try { throw xs; } catch (e) { e["message"] } finally { print("done") }
+let t = spawn fib(5);
+select { case let v = recv(t) { v } case send(c, 1) {} default { 0 } }
+fn() {}()`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	data, err := ast.EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("EncodeJSON returned error: %s", err)
+	}
+
+	decoded, err := ast.DecodeJSON(data)
+	if err != nil {
+		t.Fatalf("DecodeJSON returned error: %s", err)
+	}
+
+	if decoded.String() != program.String() {
+		t.Errorf("String() differs.\nwant=%q\ngot=%q", program.String(), decoded.String())
+	}
+	if !reflect.DeepEqual(decoded, program) {
+		t.Errorf("decoded program is not equal to the parsed one.\njson=%s", data)
+	}
+}
+
+func TestImportStatement(t *testing.T) {
+	input := `import "lib/util" as u;`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ImportStatement)
+	if !ok {
+		t.Fatalf("stmt is not *ast.ImportStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Path.Value != "lib/util" {
+		t.Errorf("stmt.Path.Value not %q. got=%q", "lib/util", stmt.Path.Value)
+	}
+	if stmt.Name.Value != "u" {
+		t.Errorf("stmt.Name.Value not %q. got=%q", "u", stmt.Name.Value)
+	}
+}
+
+func TestExportStatement(t *testing.T) {
+	input := `export let helper = fn(x) { x };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExportStatement)
+	if !ok {
+		t.Fatalf("stmt is not *ast.ExportStatement. got=%T", program.Statements[0])
+	}
+	if !testLetStatement(t, stmt.Statement, "helper") {
+		return
+	}
+
+	fn, ok := stmt.Statement.Value.(*ast.FunctionLiteral)
+	if !ok || fn.Name != "helper" {
+		t.Errorf("exported function should be named helper. got=%v", stmt.Statement.Value)
+	}
+}
+
+func TestModuleSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import util as u;`, "expected next token to be STRING, got INDENT insted"},
+		{`import "util";`, "expected next token to be AS, got ; insted"},
+		{`import "util" as "u";`, "expected next token to be INDENT, got STRING insted"},
+		{`export fn(x) { x };`, "expected next token to be LET, got FUNCTION insted"},
+		{`fn() { export let x = 1; }`, "export is only allowed at the top level"},
+		{`u.1`, "expected next token to be INDENT, got INT insted"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong parser error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestMemberExpression(t *testing.T) {
+	input := "u.helper(1)"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	call, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("exp is not *ast.CallExpression. got=%T", stmt.Expression)
+	}
+
+	member, ok := call.Function.(*ast.MemberExpression)
+	if !ok {
+		t.Fatalf("call.Function is not *ast.MemberExpression. got=%T", call.Function)
+	}
+	if !testIdentifier(t, member.Object, "u") {
+		return
+	}
+	if member.Member.Value != "helper" {
+		t.Errorf("member.Member.Value not %q. got=%q", "helper", member.Member.Value)
+	}
+}
+
+func TestParsingHashLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{}`, `{}`},
+		{`{"one": 1, "two": 2}`, `{one:1, two:2}`},
+		{`{"one": 0 + 1, two: 10 - 8, 3: a.b}`, `{one:(0 + 1), two:(10 - 8), 3:(a.b)}`},
+		{`{true: {"x": 1}}["k"]`, `({true:{x:1}}[k])`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if got := stmt.Expression.String(); got != tt.expected {
+			t.Errorf("wrong hash literal for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	for _, input := range []string{`{"a" 1}`, `{"a": 1 "b": 2}`, `{"a": 1,`} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parse errors for %q", input)
+		}
+	}
+}
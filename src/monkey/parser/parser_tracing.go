@@ -5,6 +5,9 @@ import (
 	"strings"
 )
 
+// Tracingがtrueの場合だけ構文解析の過程を標準出力に書き出す
+var Tracing = false
+
 var traceLevel int = 0
 
 const traceIdentPlaceholder string = "\t"
@@ -14,6 +17,9 @@ func identLevel() string {
 }
 
 func tracePrint(fs string) {
+	if !Tracing {
+		return
+	}
 	fmt.Printf("%s%s\n", identLevel(), fs)
 }
 
@@ -0,0 +1,431 @@
+// 構文木からMonkeyのソースコードを書き出すパッケージ(monkey fmtで使う)
+//
+// 文は1行ずつ、ブロックの中は2スペースで字下げして書き出す
+// 演算子の優先順位から必要な括弧だけをつけるので、何度フォーマットしても結果は変わらない
+// コメントは文の前か行末に書き出す。式の途中にあったコメントはその文の後ろに移る
+package printer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"strings"
+)
+
+const indentString = "  "
+
+// 演算子の優先順位(parser.goと同じ並び)。primaryは括弧のいらない式
+const (
+	_ int = iota
+	lowest
+	equals      // ==
+	lessgreater // > または <
+	sum         // +
+	product     // *
+	prefix      // -X または !X
+	call        // myFunction(X)
+	index       // array[index]
+	primary
+)
+
+var precedences = map[string]int{
+	"==": equals,
+	"!=": equals,
+	"<":  lessgreater,
+	">":  lessgreater,
+	"+":  sum,
+	"-":  sum,
+	"/":  product,
+	"*":  product,
+}
+
+// ソースを構文解析してフォーマットし直す
+func Format(src []byte) ([]byte, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	var out bytes.Buffer
+	if err := Fprint(&out, program); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// programをソースコードとしてoutに書き出す。program.Commentsも位置に合わせて書き出す
+func Fprint(out io.Writer, program *ast.Program) error {
+	p := &printer{comments: program.Comments}
+	p.statements(program.Statements)
+	p.flushComments(token.Token{Line: int(^uint(0) >> 1)})
+	if p.buf.Len() > 0 {
+		p.write("\n")
+	}
+
+	_, err := out.Write(p.buf.Bytes())
+	return err
+}
+
+type printer struct {
+	buf    bytes.Buffer
+	indent int
+
+	comments []token.Token // まだ書き出していないコメント
+	lastLine int           // 最後に書き出したトークンの元のソースでの行
+	atStart  bool          // ブロックの先頭で、まだ何も書き出していない
+}
+
+func (p *printer) write(s string) {
+	p.buf.WriteString(s)
+}
+
+// 改行して次の行の字下げを書く
+func (p *printer) newline() {
+	p.write("\n")
+	p.write(strings.Repeat(indentString, p.indent))
+}
+
+// ソース上の位置を記録する。行番号のないノード(プログラムで組み立てたもの)は無視する
+func (p *printer) mark(tok token.Token) {
+	if tok.Line > p.lastLine {
+		p.lastLine = tok.Line
+	}
+}
+
+// 1行ずつ文を書き出す。元のソースにあった空行は1行だけ残す
+func (p *printer) statements(stmts []ast.Statement) {
+	p.atStart = true
+
+	for i, s := range stmts {
+		start := startOf(s)
+		p.flushComments(start)
+		p.lineBreak(start.Line)
+		p.mark(start)
+
+		var next ast.Statement
+		if i+1 < len(stmts) {
+			next = stmts[i+1]
+		}
+		// トップレベルの式文には常に;をつける
+		p.statement(s, next == nil && p.indent > 0, next)
+		p.trailingComment(next)
+	}
+}
+
+// 新しい行を始める。前の行との間に空行があれば1行だけ残す
+func (p *printer) lineBreak(line int) {
+	if !p.atStart {
+		if line > p.lastLine+1 && p.lastLine > 0 {
+			p.write("\n")
+		}
+		p.newline()
+	} else if p.buf.Len() > 0 {
+		p.newline()
+	}
+	p.atStart = false
+}
+
+// posより前にあるコメントをそれぞれ1行として書き出す
+func (p *printer) flushComments(pos token.Token) {
+	for len(p.comments) > 0 && before(p.comments[0], pos) {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+
+		p.lineBreak(c.Line)
+		p.write(c.Literal)
+		p.mark(c)
+	}
+}
+
+// 直前に書いたトークンと同じ行にあるコメントは行末に書く
+// 同じ行にまだ次の文が続くときは、その文の後ろまで待つ
+func (p *printer) trailingComment(next ast.Statement) {
+	if len(p.comments) == 0 || p.lastLine == 0 {
+		return
+	}
+
+	c := p.comments[0]
+	if c.Line != p.lastLine {
+		return
+	}
+	if next != nil && !before(c, startOf(next)) {
+		return
+	}
+
+	p.write(" " + c.Literal)
+	p.comments = p.comments[1:]
+}
+
+func before(c, pos token.Token) bool {
+	return c.Line < pos.Line || c.Line == pos.Line && c.Column < pos.Column
+}
+
+func startOf(s ast.Statement) token.Token {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		return s.Token
+	case *ast.ReturnStatement:
+		return s.Token
+	case *ast.ThrowStatement:
+		return s.Token
+	case *ast.ExpressionStatement:
+		return s.Token
+	case *ast.BlockStatement:
+		return s.Token
+	case *ast.ImportStatement:
+		return s.Token
+	case *ast.ExportStatement:
+		return s.Token
+	}
+	return token.Token{}
+}
+
+// last: ブロックの最後の文か。最後の式文はブロックの値になるので;をつけない
+func (p *printer) statement(s ast.Statement, last bool, next ast.Statement) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		p.write("let " + s.Name.Value + " = ")
+		p.expression(s.Value, lowest)
+		p.write(";")
+	case *ast.ImportStatement:
+		p.write(`import "` + s.Path.Value + `" as ` + s.Name.Value + ";")
+	case *ast.ExportStatement:
+		p.write("export ")
+		p.statement(s.Statement, last, next)
+	case *ast.ReturnStatement:
+		p.write("return")
+		if s.ReturnValue != nil {
+			p.write(" ")
+			p.expression(s.ReturnValue, lowest)
+		}
+		p.write(";")
+	case *ast.ThrowStatement:
+		p.write("throw ")
+		p.expression(s.Value, lowest)
+		p.write(";")
+	case *ast.ExpressionStatement:
+		p.expression(s.Expression, lowest)
+		if needsSemicolon(s, last, next) {
+			p.write(";")
+		}
+	case *ast.BlockStatement:
+		p.block(s)
+	}
+}
+
+// ifやtry、selectの後ろは、次の文が続きの演算子として読まれてしまう場合だけ;をつける
+func needsSemicolon(s *ast.ExpressionStatement, last bool, next ast.Statement) bool {
+	switch s.Expression.(type) {
+	case *ast.IfExpression, *ast.TryExpression, *ast.SelectExpression:
+		es, ok := next.(*ast.ExpressionStatement)
+		if !ok {
+			return false
+		}
+		switch es.Token.Type {
+		case token.LPAREN, token.LBRACKET, token.MINUS:
+			return true
+		}
+		return false
+	}
+	return !last
+}
+
+func (p *printer) block(b *ast.BlockStatement) {
+	p.mark(b.Token)
+	p.write("{")
+
+	if len(b.Statements) == 0 && !p.hasCommentBefore(b.Rbrace) {
+		p.write("}")
+		p.mark(b.Rbrace)
+		return
+	}
+
+	p.indent++
+	p.statements(b.Statements)
+	p.flushComments(b.Rbrace)
+	p.indent--
+
+	p.newline()
+	p.write("}")
+	p.mark(b.Rbrace)
+}
+
+func (p *printer) hasCommentBefore(pos token.Token) bool {
+	return len(p.comments) > 0 && before(p.comments[0], pos)
+}
+
+func precedenceOf(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		if prec, ok := precedences[e.Operator]; ok {
+			return prec
+		}
+		return lowest
+	case *ast.PrefixExpression, *ast.SpawnExpression:
+		return prefix
+	}
+	return primary
+}
+
+// 外側の演算子の優先順位precより弱い式は括弧で囲む
+func (p *printer) expression(e ast.Expression, prec int) {
+	if precedenceOf(e) < prec {
+		p.write("(")
+		p.expression(e, lowest)
+		p.write(")")
+		return
+	}
+
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.mark(e.Token)
+		p.write(e.Value)
+	case *ast.IntegerLiteral:
+		p.mark(e.Token)
+		p.write(e.Token.Literal)
+	case *ast.FloatLiteral:
+		p.mark(e.Token)
+		p.write(e.Token.Literal)
+	case *ast.StringLiteral:
+		p.mark(e.Token)
+		p.write(`"` + e.Value + `"`)
+	case *ast.Boolean:
+		p.mark(e.Token)
+		if e.Value {
+			p.write("true")
+		} else {
+			p.write("false")
+		}
+	case *ast.ArrayLiteral:
+		p.mark(e.Token)
+		p.write("[")
+		p.expressionList(e.Elements)
+		p.write("]")
+	case *ast.HashLiteral:
+		p.mark(e.Token)
+		p.write("{")
+		for i, pair := range e.Pairs {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(pair.Key, lowest)
+			p.write(": ")
+			p.expression(pair.Value, lowest)
+		}
+		p.write("}")
+	case *ast.PrefixExpression:
+		p.mark(e.Token)
+		p.write(e.Operator)
+		p.expression(e.Right, prefix)
+	case *ast.InfixExpression:
+		// 左結合なので、同じ優先順位の式は右側だけ括弧で囲む
+		opPrec := precedenceOf(e)
+		p.expression(e.Left, opPrec)
+		p.mark(e.Token)
+		p.write(" " + e.Operator + " ")
+		p.expression(e.Right, opPrec+1)
+	case *ast.IfExpression:
+		p.mark(e.Token)
+		p.write("if (")
+		p.expression(e.Condition, lowest)
+		p.write(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.write(" else ")
+			p.block(e.Alternative)
+		}
+	case *ast.TryExpression:
+		p.mark(e.Token)
+		p.write("try ")
+		p.block(e.Block)
+		if e.Catch != nil {
+			p.write(" catch (" + e.CatchParam.Value + ") ")
+			p.block(e.Catch)
+		}
+		if e.Finally != nil {
+			p.write(" finally ")
+			p.block(e.Finally)
+		}
+	case *ast.SpawnExpression:
+		p.mark(e.Token)
+		p.write("spawn ")
+		p.expression(e.Call, prefix)
+	case *ast.SelectExpression:
+		p.selectExpression(e)
+	case *ast.FunctionLiteral:
+		p.mark(e.Token)
+		params := make([]string, len(e.Parameters))
+		for i, param := range e.Parameters {
+			params[i] = param.Value
+		}
+		p.write("fn(" + strings.Join(params, ", ") + ") ")
+		p.block(e.Body)
+	case *ast.CallExpression:
+		p.expression(e.Function, call)
+		p.mark(e.Token)
+		p.write("(")
+		p.expressionList(e.Arguments)
+		p.write(")")
+	case *ast.IndexExpression:
+		p.expression(e.Left, index)
+		p.mark(e.Token)
+		p.write("[")
+		p.expression(e.Index, lowest)
+		p.write("]")
+	case *ast.MemberExpression:
+		p.expression(e.Object, index)
+		p.mark(e.Token)
+		p.write("." + e.Member.Value)
+	}
+}
+
+// ケースは1つずつ別の行に書く
+func (p *printer) selectExpression(e *ast.SelectExpression) {
+	p.mark(e.Token)
+	if len(e.Cases) == 0 && e.Default == nil && !p.hasCommentBefore(e.Rbrace) {
+		p.write("select {}")
+		p.mark(e.Rbrace)
+		return
+	}
+
+	p.write("select {")
+	p.indent++
+	for _, c := range e.Cases {
+		p.flushComments(c.Token)
+		p.newline()
+		p.mark(c.Token)
+		p.write("case ")
+		if c.Name != nil {
+			p.write("let " + c.Name.Value + " = ")
+		}
+		p.expression(c.Operation, lowest)
+		p.write(" ")
+		p.block(c.Body)
+	}
+	if e.Default != nil {
+		p.flushComments(e.Default.Token)
+		p.newline()
+		p.write("default ")
+		p.block(e.Default)
+	}
+	p.flushComments(e.Rbrace)
+	p.indent--
+
+	p.newline()
+	p.write("}")
+	p.mark(e.Rbrace)
+}
+
+func (p *printer) expressionList(exps []ast.Expression) {
+	for i, e := range exps {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expression(e, lowest)
+	}
+}
@@ -0,0 +1,139 @@
+package printer
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=5", "let x = 5;\n"},
+		{"1+2*3;(1+2)*3;1-(2-3);(1-2)-3", "1 + 2 * 3;\n(1 + 2) * 3;\n1 - (2 - 3);\n1 - 2 - 3;\n"},
+		{"-(a+b);!-a;(-a)[0];-a[0]", "-(a + b);\n!-a;\n(-a)[0];\n-a[0];\n"},
+		{"a<b==b>c;(a==b)<c", "a < b == b > c;\n(a == b) < c;\n"},
+		{"add(1,2*3)[0]", "add(1, 2 * 3)[0];\n"},
+		{`let h={"a":1,b:[2],3:{}};h["a"]`, "let h = {\"a\": 1, b: [2], 3: {}};\nh[\"a\"];\n"},
+		{"import \"lib/util\" as u\nexport let x=u.f(1).y;(-u).z", "import \"lib/util\" as u;\nexport let x = u.f(1).y;\n(-u).z;\n"},
+		{`let s=["a",  "b"];s[1]`, "let s = [\"a\", \"b\"];\ns[1];\n"},
+		{
+			"let add=fn(x,y){x+y};",
+			"let add = fn(x, y) {\n  x + y\n};\n",
+		},
+		{
+			"let f=fn(){};f()",
+			"let f = fn() {};\nf();\n",
+		},
+		{
+			"if(x<y){x}else{y}",
+			"if (x < y) {\n  x\n} else {\n  y\n}\n",
+		},
+		{
+			"if (x) { 1 };\n-1",
+			"if (x) {\n  1\n};\n-1;\n",
+		},
+		{
+			"if (x) { 1 }\nlet y = 2;",
+			"if (x) {\n  1\n}\nlet y = 2;\n",
+		},
+		{
+			"fn(n){if(n<2){return n;} throw \"x\"; n}",
+			"fn(n) {\n  if (n < 2) {\n    return n;\n  }\n  throw \"x\";\n  n\n};\n",
+		},
+		{
+			"try{f()}catch(e){e[\"message\"]}finally{g()}",
+			"try {\n  f()\n} catch (e) {\n  e[\"message\"]\n} finally {\n  g()\n}\n",
+		},
+		{
+			"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;",
+			"let a = 1;\n\nlet b = 2;\nlet c = 3;\n",
+		},
+		{
+			"// header\n\nlet x = 1;   // one\nlet y = 2; // two\n// tail",
+			"// header\n\nlet x = 1; // one\nlet y = 2; // two\n// tail\n",
+		},
+		{
+			"let f = fn() { // opening\n  1\n  // before close\n}; // after close",
+			"let f = fn() {\n  // opening\n  1\n  // before close\n}; // after close\n",
+		},
+		{
+			"let f = fn() {\n  // only a comment\n};",
+			"let f = fn() {\n  // only a comment\n};\n",
+		},
+		{"let t=spawn f(1);-spawn g()", "let t = spawn f(1);\n-spawn g();\n"},
+		{
+			"select{case let v=recv(a){v}case send(b,1){}default{0}}",
+			"select {\n  case let v = recv(a) {\n    v\n  }\n  case send(b, 1) {}\n  default {\n    0\n  }\n}\n",
+		},
+		{"select{}", "select {}\n"},
+		{
+			"a; b; // c",
+			"a;\nb; // c\n",
+		},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Format([]byte(tt.input))
+		if err != nil {
+			t.Errorf("Format(%q) returned error: %s", tt.input, err)
+			continue
+		}
+
+		if string(formatted) != tt.expected {
+			t.Errorf("wrong output for %q.\nwant=%q\ngot=%q", tt.input, tt.expected, formatted)
+		}
+	}
+}
+
+// フォーマットしても構文木は変わらず、2回フォーマットしても結果が変わらない
+func TestFormatIsStable(t *testing.T) {
+	inputs := []string{
+		"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10)",
+		"let x = -(1 - -2) * (3 + 4) / 5 == !true",
+		"f(1)(2)[3]; fn(x) { x }(1); [1, [2, 3]][1][0]",
+		"if (a) { 1 } else { 2 } + 3",
+		"if (a) { 1 }\n(2)",
+		"try { throw 1; } catch (e) {}\n[1]",
+		"let a = 1; // a\n\n\n// b\nlet b = fn() {\n// c\n  a // d\n  // e\n};\n// f",
+		"add(1, // one\n  2) // two\nlet x = 1;",
+		"fn() { return 1; }",
+		"let x = select { case let v = recv(a) { v } // got\n  // none\n  default { 0 } }\n(1)",
+		"let z = select { case let v = recv(c) { v } default { 0 } };\nlet y = 2;\nlet w = 3;",
+		"let z = select {\n  case let v = recv(c) { v }\n  // last\n}\nlet y = 2;",
+		"select { // none\n}\nlet y = 2;",
+	}
+
+	for _, input := range inputs {
+		first, err := Format([]byte(input))
+		if err != nil {
+			t.Errorf("Format(%q) returned error: %s", input, err)
+			continue
+		}
+
+		second, err := Format(first)
+		if err != nil {
+			t.Errorf("formatted source does not parse: %s\n%s", err, first)
+			continue
+		}
+		if string(first) != string(second) {
+			t.Errorf("formatting is not idempotent for %q.\nfirst=%q\nsecond=%q", input, first, second)
+		}
+
+		if parse(t, input) != parse(t, string(first)) {
+			t.Errorf("formatting changed the program %q.\nwant=%s\ngot=%s", input, parse(t, input), parse(t, string(first)))
+		}
+	}
+}
+
+func parse(t *testing.T, input string) string {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program.String()
+}
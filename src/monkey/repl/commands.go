@@ -0,0 +1,170 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/token"
+	"path/filepath"
+	"strings"
+)
+
+// :から始まるREPLのコマンド
+type command struct {
+	name string
+	args string // :helpに出す引数の説明
+	help string
+	code bool // 引数がMonkeyのコードか(括弧が閉じるまで続きの行を読む)
+	run  func(s *Session, arg string, out io.Writer)
+}
+
+var commands []command
+
+// :helpがcommandsを参照するので、初期化の循環を避けるためにinitで組み立てる
+func init() {
+	commands = []command{
+		{name: ":help", help: "show this list of commands", run: runHelp},
+		{name: ":tokens", args: "<code>", help: "print the tokens produced by the lexer", code: true, run: runTokens},
+		{name: ":ast", args: "[--tree|--dot] <code>", help: "print the syntax tree produced by the parser", code: true, run: runAST},
+		{name: ":type", args: "<expr>", help: "evaluate an expression and print its type", code: true, run: runType},
+		{name: ":load", args: "<file>", help: "evaluate a script file into the session", run: runLoad},
+		{name: ":env", help: "list the bindings in the session", run: runEnv},
+		{name: ":reset", help: "remove all bindings and cached modules from the session", run: runReset},
+	}
+}
+
+func lookupCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+func commandTakesCode(name string) bool {
+	c, ok := lookupCommand(name)
+	return ok && c.code
+}
+
+func (s *Session) runCommand(input string, out io.Writer) {
+	fields := strings.SplitN(input, " ", 2)
+	name := fields[0]
+	arg := ""
+	if len(fields) == 2 {
+		arg = strings.TrimSpace(fields[1])
+	}
+
+	c, ok := lookupCommand(name)
+	if !ok {
+		fmt.Fprintf(out, "unknown command %s. type :help for a list of commands\n", name)
+		return
+	}
+
+	if c.args != "" && arg == "" {
+		fmt.Fprintf(out, "usage: %s %s\n", c.name, c.args)
+		return
+	}
+
+	c.run(s, arg, out)
+}
+
+func runHelp(s *Session, arg string, out io.Writer) {
+	for _, c := range commands {
+		usage := c.name
+		if c.args != "" {
+			usage += " " + c.args
+		}
+		fmt.Fprintf(out, "  %-16s %s\n", usage, c.help)
+	}
+}
+
+func runTokens(s *Session, arg string, out io.Writer) {
+	l := lexer.New(arg)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(out, "%d:%d\t%s\t%q\n", tok.Line, tok.Column, tok.Type, tok.Literal)
+	}
+}
+
+// --treeなら罫線つきの木、--dotならGraphvizのDOT形式で書き出す
+func runAST(s *Session, arg string, out io.Writer) {
+	fprint := ast.Fprint
+	for _, f := range []struct {
+		flag   string
+		fprint func(io.Writer, ast.Node)
+	}{{"--tree", ast.FprintTree}, {"--dot", ast.FprintDot}} {
+		if strings.HasPrefix(arg, f.flag+" ") || arg == f.flag {
+			fprint = f.fprint
+			arg = strings.TrimSpace(strings.TrimPrefix(arg, f.flag))
+		}
+	}
+	if arg == "" {
+		c, _ := lookupCommand(":ast")
+		fmt.Fprintf(out, "usage: %s %s\n", c.name, c.args)
+		return
+	}
+
+	program, ok := parse(arg, out)
+	if !ok {
+		return
+	}
+	fprint(out, program)
+}
+
+func runType(s *Session, arg string, out io.Writer) {
+	program, ok := parse(arg, out)
+	if !ok {
+		return
+	}
+
+	evaluated := s.Eval(program)
+	if evaluated == nil {
+		evaluated = evaluator.NULL
+	}
+	if errObj, ok := evaluated.(*object.Error); ok {
+		printRuntimeError(out, errObj)
+		return
+	}
+	io.WriteString(out, string(evaluated.Type())+"\n")
+}
+
+// ファイルの中の相対パスのimportは、monkey runと同じくそのファイルのディレクトリから探す
+func runLoad(s *Session, arg string, out io.Writer) {
+	source, err := ioutil.ReadFile(arg)
+	if err != nil {
+		fmt.Fprintf(out, "could not load %s: %s\n", arg, err)
+		return
+	}
+	abs, err := filepath.Abs(arg)
+	if err != nil {
+		fmt.Fprintf(out, "could not load %s: %s\n", arg, err)
+		return
+	}
+
+	prev := s.env.File()
+	s.env.SetFile(abs)
+	defer s.env.SetFile(prev)
+	s.evalAndPrint(string(source), out)
+}
+
+func runEnv(s *Session, arg string, out io.Writer) {
+	for _, name := range s.env.Names() {
+		val, _ := s.env.Get(name)
+		fmt.Fprintf(out, "%s = %s\n", name, oneLine(val.Inspect()))
+	}
+}
+
+func runReset(s *Session, arg string, out io.Writer) {
+	s.env = object.NewEnvironment()
+	s.modules = newModuleLoader()
+	s.tasks = evaluator.NewTaskGroup()
+}
+
+// 関数のInspectは複数行になるので1行にまとめる
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
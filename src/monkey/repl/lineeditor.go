@@ -0,0 +1,511 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Ctrl-Cで入力中の行を捨てたときにReadLineが返す
+var ErrInterrupted = errors.New("interrupted")
+
+// 覚えておく履歴の最大の行数。履歴ファイルはこの2倍を超えたら、新しいほうからこの行数に切り詰めて書き直す
+const maxHistory = 1000
+
+// キーの入力
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyBackspace = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// エスケープシーケンスはruneとして有効な値と重ならないように割り当てる
+const (
+	keyUp = unicode.MaxRune + 1 + iota
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDeleteForward
+)
+
+// 端末を生モードにして1キーずつ読む行エディタ
+// 矢印キーでの移動と履歴、Ctrl-Rでの履歴の逆方向検索、Tabでの補完ができる
+// 生モードにするのは呼び出し側の仕事で、ここではinから読んだバイト列をキー入力として扱う
+type LineEditor struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	history      []string
+	historyFile  string // 空なら履歴を保存しない
+	historyLines int    // 履歴ファイルの行数
+
+	// 補完の候補を返す関数。nilなら補完しない
+	Complete func() []string
+
+	// 編集中の行
+	buf []rune
+	pos int
+}
+
+func NewLineEditor(in io.Reader, out io.Writer) *LineEditor {
+	return &LineEditor{in: bufio.NewReader(in), out: out}
+}
+
+// 履歴ファイルを読み込み、以後入力した行をそこに追記する
+// ファイルがまだなければ最初の書き込みで作る
+func (le *LineEditor) LoadHistory(path string) error {
+	le.historyFile = path
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			le.history = append(le.history, line)
+			le.historyLines++
+		}
+	}
+	if len(le.history) > maxHistory {
+		le.history = le.history[len(le.history)-maxHistory:]
+	}
+	return scanner.Err()
+}
+
+// 既定の履歴ファイルの場所。$MONKEY_HISTORYがあればそれを使う
+func DefaultHistoryFile() string {
+	if path := os.Getenv("MONKEY_HISTORY"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".monkey_history")
+}
+
+func (le *LineEditor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if n := len(le.history); n > 0 && le.history[n-1] == line {
+		return
+	}
+	le.history = append(le.history, line)
+	if len(le.history) > maxHistory {
+		le.history = le.history[len(le.history)-maxHistory:]
+	}
+
+	if le.historyFile == "" {
+		return
+	}
+	if le.historyLines >= 2*maxHistory {
+		le.rewriteHistory()
+		return
+	}
+	f, err := os.OpenFile(le.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+	le.historyLines++
+}
+
+// 履歴ファイルをいまの履歴だけで書き直す。途中で失敗しても元のファイルが残るように、別のファイルに書いてから置き換える
+func (le *LineEditor) rewriteHistory() {
+	f, err := ioutil.TempFile(filepath.Dir(le.historyFile), filepath.Base(le.historyFile)+".*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	for _, line := range le.history {
+		fmt.Fprintln(w, line)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return
+	}
+	if err := f.Close(); err != nil {
+		return
+	}
+	if err := os.Rename(f.Name(), le.historyFile); err != nil {
+		return
+	}
+	le.historyLines = len(le.history)
+}
+
+// promptを表示して1行読む
+// 空の行でCtrl-Dを押すとio.EOF、Ctrl-Cを押すとErrInterruptedを返す
+func (le *LineEditor) ReadLine(prompt string) (string, error) {
+	le.buf = le.buf[:0]
+	le.pos = 0
+
+	// 履歴を上下に移動している間の位置。len(history)は編集中の新しい行
+	histIdx := len(le.history)
+	current := ""
+
+	le.refresh(prompt)
+	for {
+		key, err := le.readKey()
+		if err != nil {
+			if err == io.EOF && len(le.buf) > 0 {
+				// 改行なしで入力が終わったら、そこまでを1行として返す
+				break
+			}
+			return "", err
+		}
+
+		switch key {
+		case keyEnter, '\n':
+			le.finish()
+			line := string(le.buf)
+			le.addHistory(line)
+			return line, nil
+		case keyCtrlC:
+			io.WriteString(le.out, "^C")
+			le.finish()
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(le.buf) == 0 {
+				le.finish()
+				return "", io.EOF
+			}
+			le.deleteForward()
+		case keyBackspace, keyDelete:
+			if le.pos > 0 {
+				le.buf = append(le.buf[:le.pos-1], le.buf[le.pos:]...)
+				le.pos -= 1
+			}
+		case keyDeleteForward:
+			le.deleteForward()
+		case keyLeft, keyCtrlB:
+			if le.pos > 0 {
+				le.pos -= 1
+			}
+		case keyRight, keyCtrlF:
+			if le.pos < len(le.buf) {
+				le.pos += 1
+			}
+		case keyHome, keyCtrlA:
+			le.pos = 0
+		case keyEnd, keyCtrlE:
+			le.pos = len(le.buf)
+		case keyCtrlK:
+			le.buf = le.buf[:le.pos]
+		case keyCtrlU:
+			le.buf = append(le.buf[:0], le.buf[le.pos:]...)
+			le.pos = 0
+		case keyCtrlW:
+			// 直前の空白と単語をまとめて消す
+			end := le.pos
+			for le.pos > 0 && unicode.IsSpace(le.buf[le.pos-1]) {
+				le.pos -= 1
+			}
+			start := le.wordStart(func(r rune) bool { return !unicode.IsSpace(r) })
+			le.buf = append(le.buf[:start], le.buf[end:]...)
+			le.pos = start
+		case keyCtrlL:
+			io.WriteString(le.out, "\x1b[H\x1b[2J")
+		case keyUp, keyCtrlP:
+			if histIdx > 0 {
+				if histIdx == len(le.history) {
+					current = string(le.buf)
+				}
+				histIdx -= 1
+				le.setLine(le.history[histIdx])
+			}
+		case keyDown, keyCtrlN:
+			if histIdx < len(le.history) {
+				histIdx += 1
+				if histIdx == len(le.history) {
+					le.setLine(current)
+				} else {
+					le.setLine(le.history[histIdx])
+				}
+			}
+		case keyTab:
+			le.complete(prompt)
+		case keyCtrlR:
+			line, accepted, err := le.reverseSearch()
+			if err != nil {
+				return "", err
+			}
+			le.setLine(line)
+			if accepted {
+				le.refresh(prompt)
+				le.finish()
+				le.addHistory(line)
+				return line, nil
+			}
+		default:
+			if key >= ' ' && key <= unicode.MaxRune {
+				le.insert(key)
+			}
+		}
+
+		le.refresh(prompt)
+	}
+
+	le.finish()
+	line := string(le.buf)
+	le.addHistory(line)
+	return line, nil
+}
+
+// キーを1つ読む。矢印キーなどのエスケープシーケンスはkeyUpなどに変換する
+func (le *LineEditor) readKey() (rune, error) {
+	r, _, err := le.in.ReadRune()
+	if err != nil || r != keyEscape {
+		return r, err
+	}
+
+	// ESC単体のあとに続きがなければそのまま返す
+	if le.in.Buffered() == 0 {
+		return keyEscape, nil
+	}
+	next, _, err := le.in.ReadRune()
+	if err != nil {
+		return keyEscape, nil
+	}
+	if next != '[' && next != 'O' {
+		return keyEscape, nil
+	}
+
+	code, _, err := le.in.ReadRune()
+	if err != nil {
+		return keyEscape, nil
+	}
+	switch code {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	case 'C':
+		return keyRight, nil
+	case 'D':
+		return keyLeft, nil
+	case 'H':
+		return keyHome, nil
+	case 'F':
+		return keyEnd, nil
+	}
+
+	// ESC [ 3 ~ のように数字と~で終わるもの
+	if code >= '0' && code <= '9' {
+		for {
+			r, _, err := le.in.ReadRune()
+			if err != nil || r == '~' {
+				break
+			}
+		}
+		switch code {
+		case '1', '7':
+			return keyHome, nil
+		case '4', '8':
+			return keyEnd, nil
+		case '3':
+			return keyDeleteForward, nil
+		}
+	}
+	return keyEscape, nil
+}
+
+func (le *LineEditor) insert(r rune) {
+	le.buf = append(le.buf, 0)
+	copy(le.buf[le.pos+1:], le.buf[le.pos:])
+	le.buf[le.pos] = r
+	le.pos += 1
+}
+
+func (le *LineEditor) deleteForward() {
+	if le.pos < len(le.buf) {
+		le.buf = append(le.buf[:le.pos], le.buf[le.pos+1:]...)
+	}
+}
+
+func (le *LineEditor) setLine(line string) {
+	le.buf = []rune(line)
+	le.pos = len(le.buf)
+}
+
+// カーソルの直前から、inWordを満たす文字が続く先頭の位置を返す
+func (le *LineEditor) wordStart(inWord func(rune) bool) int {
+	start := le.pos
+	for start > 0 && inWord(le.buf[start-1]) {
+		start -= 1
+	}
+	return start
+}
+
+// 行を書き直してカーソルを正しい位置に置く
+func (le *LineEditor) refresh(prompt string) {
+	fmt.Fprintf(le.out, "\r%s%s\x1b[K", prompt, string(le.buf))
+	if back := len(le.buf) - le.pos; back > 0 {
+		fmt.Fprintf(le.out, "\x1b[%dD", back)
+	}
+}
+
+func (le *LineEditor) finish() {
+	io.WriteString(le.out, "\r\n")
+}
+
+// 2文字目からは数字も使える
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// カーソルの前の単語を補完する
+// 候補が1つならそれを入れ、複数なら共通の部分まで入れて、それ以上進めなければ候補を一覧表示する
+func (le *LineEditor) complete(prompt string) {
+	if le.Complete == nil {
+		return
+	}
+
+	start := le.wordStart(isIdentRune)
+	for start < le.pos && unicode.IsDigit(le.buf[start]) {
+		start++
+	}
+	if start == le.pos {
+		return
+	}
+	prefix := string(le.buf[start:le.pos])
+
+	matches := []string{}
+	seen := map[string]bool{}
+	for _, candidate := range le.Complete() {
+		if strings.HasPrefix(candidate, prefix) && !seen[candidate] {
+			matches = append(matches, candidate)
+			seen[candidate] = true
+		}
+	}
+	sort.Strings(matches)
+
+	switch len(matches) {
+	case 0:
+		return
+	case 1:
+		for _, r := range matches[0][len(prefix):] {
+			le.insert(r)
+		}
+		return
+	}
+
+	common := commonPrefix(matches)
+	if len(common) > len(prefix) {
+		for _, r := range common[len(prefix):] {
+			le.insert(r)
+		}
+		return
+	}
+
+	le.finish()
+	io.WriteString(le.out, strings.Join(matches, "  "))
+	le.finish()
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// Ctrl-Rで履歴を新しい方から検索する
+// 文字を打つと検索語に加え、もう一度Ctrl-Rを押すとさらに古い一致を探す
+// Enterで見つけた行を実行し、Ctrl-GかESCで元の行に戻る。それ以外のキーでは見つけた行の編集に戻る
+func (le *LineEditor) reverseSearch() (string, bool, error) {
+	original := string(le.buf)
+	query := []rune{}
+	match := ""
+	idx := len(le.history)
+
+	search := func(from int) {
+		for i := from; i >= 0; i-- {
+			if strings.Contains(le.history[i], string(query)) {
+				match = le.history[i]
+				idx = i
+				return
+			}
+		}
+	}
+
+	for {
+		fmt.Fprintf(le.out, "\r(reverse-i-search)`%s': %s\x1b[K", string(query), match)
+
+		key, err := le.readKey()
+		if err != nil {
+			return "", false, err
+		}
+
+		switch {
+		case key == keyEnter || key == '\n':
+			if match == "" {
+				return original, false, nil
+			}
+			return match, true, nil
+		case key == keyCtrlG || key == keyEscape || key == keyCtrlC:
+			return original, false, nil
+		case key == keyCtrlR:
+			if idx > 0 {
+				search(idx - 1)
+			}
+		case key == keyBackspace || key == keyDelete:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				match = ""
+				search(len(le.history) - 1)
+			}
+		case key >= ' ' && key <= unicode.MaxRune:
+			query = append(query, key)
+			match = ""
+			// 今の一致がまだ検索語を含んでいればそこから探す
+			from := idx
+			if from >= len(le.history) {
+				from = len(le.history) - 1
+			}
+			search(from)
+		default:
+			if match == "" {
+				return original, false, nil
+			}
+			return match, false, nil
+		}
+	}
+}
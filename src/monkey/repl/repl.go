@@ -4,33 +4,239 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"monkey/ast"
+	"monkey/evaluator"
 	"monkey/lexer"
+	"monkey/object"
 	"monkey/parser"
+	"monkey/token"
+	"os"
+	"strings"
 )
 
 const PROMPT = ">>"
 
+// 括弧が閉じていないなど、入力が続いているときのプロンプト
+const CONTINUE_PROMPT = ".."
+
+// REPLを起動している間保持する状態
+// 前の行でletした値を次の行から参照できるように、グローバルな環境を使い回す
+type Session struct {
+	env     *object.Environment
+	modules *evaluator.ModuleLoader // importしたモジュールを次の入力でも使い回す
+	tasks   *evaluator.TaskGroup    // 前の入力で作ったチャネルも使えるようにする
+}
+
+func NewSession() *Session {
+	return &Session{
+		env:     object.NewEnvironment(),
+		modules: newModuleLoader(),
+		tasks:   evaluator.NewTaskGroup(),
+	}
+}
+
+// REPLでは手元のファイルを扱えるように、fsモジュールとimportにOSのファイルシステムを制限なしに使わせる
+func newModuleLoader() *evaluator.ModuleLoader {
+	l := evaluator.NewModuleLoader(evaluator.EnvSearchPath()...)
+	l.Sandbox(evaluator.OSFileSystem{})
+	return l
+}
+
+// セッションの環境でプログラムを評価し、spawnしたタスクが終わるまで待つ
+// 評価中にGoのpanicが起きてもREPLごと落ちないようにエラーに変換する
+func (s *Session) Eval(program *ast.Program) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = &object.Error{Message: fmt.Sprintf("internal error: %v", r)}
+		}
+	}()
+	e := evaluator.New()
+	e.Modules = s.modules
+	e.Tasks = s.tasks
+	return e.Wait(e.Eval(program, s.env))
+}
+
+// 補完の候補。キーワード、組み込み関数、セッションで束縛した名前
+func (s *Session) completions() []string {
+	names := token.Keywords()
+	names = append(names, evaluator.BuiltinNames()...)
+	names = append(names, s.env.Names()...)
+	return names
+}
+
+// inが端末なら行エディタで、そうでなければbufio.Scannerで1行ずつ読む
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	session := NewSession()
+	reader := newLineReader(in, out, session)
 	for {
-		fmt.Printf(PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		input, ok := readInput(reader)
+		if !ok {
 			return
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
-
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParseErrors(out, p.Errors())
+		// :から始まる行はREPL自体へのコマンド(commands.go)
+		if strings.HasPrefix(strings.TrimSpace(input), ":") {
+			session.runCommand(strings.TrimSpace(input), out)
 			continue
 		}
-		io.WriteString(out, program.String())
-		io.WriteString(out, "\n")
+
+		session.evalAndPrint(input, out)
+	}
+}
+
+// inputを構文解析して評価し、結果かエラーをoutに書き出す
+func (s *Session) evalAndPrint(input string, out io.Writer) {
+	program, ok := parse(input, out)
+	if !ok {
+		return
+	}
+
+	evaluated := s.Eval(program)
+	if evaluated == nil {
+		return
+	}
+	if errObj, ok := evaluated.(*object.Error); ok {
+		printRuntimeError(out, errObj)
+		return
+	}
+	io.WriteString(out, evaluated.Inspect())
+	io.WriteString(out, "\n")
+}
+
+// 構文エラーがあればoutに書き出してfalseを返す
+func parse(input string, out io.Writer) (*ast.Program, bool) {
+	l := lexer.New(input)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParseErrors(out, p.Errors())
+		return nil, false
+	}
+	return program, true
+}
+
+// プロンプトを出して1行読む。入力が終わったらio.EOFを返す
+type lineReader interface {
+	readLine(prompt string) (string, error)
+}
+
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *scannerReader) readLine(prompt string) (string, error) {
+	io.WriteString(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// 1行読む間だけ端末を生モードにする。評価結果の出力は普通のモードで行う
+type editorReader struct {
+	editor *LineEditor
+	fd     int
+}
+
+func (r *editorReader) readLine(prompt string) (string, error) {
+	restore, err := makeRaw(r.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	return r.editor.ReadLine(prompt)
+}
+
+func newLineReader(in io.Reader, out io.Writer, session *Session) lineReader {
+	if f, ok := in.(*os.File); ok && isTerminal(int(f.Fd())) {
+		editor := NewLineEditor(in, out)
+		editor.Complete = session.completions
+		if path := DefaultHistoryFile(); path != "" {
+			editor.LoadHistory(path)
+		}
+		return &editorReader{editor: editor, fd: int(f.Fd())}
+	}
+
+	return &scannerReader{scanner: bufio.NewScanner(in), out: out}
+}
+
+// 1つのプログラムになるまで行を読む
+// 括弧が閉じていない間と、入力が途中で終わっていると構文解析器が判断した間は続きの行を読む
+// 後者の場合は空行を入力すればそこまでで打ち切れる。Ctrl-Cを押すと入力中のプログラムを捨てる
+func readInput(reader lineReader) (string, bool) {
+	input, err := reader.readLine(PROMPT)
+	if err == ErrInterrupted {
+		return "", true
+	}
+	if err != nil {
+		return "", false
+	}
+
+	for {
+		code := codeOf(input)
+		depth := bracketDepth(code)
+		if depth <= 0 && !unexpectedEOF(code) {
+			break
+		}
+
+		line, err := reader.readLine(CONTINUE_PROMPT)
+		if err == ErrInterrupted {
+			return "", true
+		}
+		if err != nil {
+			// 入力が終わったら、そこまでを評価してエラーを見せる
+			break
+		}
+		if line == "" && depth <= 0 {
+			break
+		}
+		input += "\n" + line
+	}
+
+	return input, true
+}
+
+// :ast fn(x) { のようなコマンドは引数の部分だけを見て続きを読むか決める
+func codeOf(input string) string {
+	trimmed := strings.TrimSpace(input)
+	if !strings.HasPrefix(trimmed, ":") {
+		return input
+	}
+
+	fields := strings.SplitN(trimmed, " ", 2)
+	if len(fields) < 2 || !commandTakesCode(fields[0]) {
+		return ""
+	}
+	return fields[1]
+}
+
+// 閉じていない括弧の数を返す。文字列の中の括弧は字句解析器が数えないようにしてくれる
+func bracketDepth(input string) int {
+	depth := 0
+
+	l := lexer.New(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth += 1
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth -= 1
+		}
 	}
+
+	return depth
+}
+
+func unexpectedEOF(input string) bool {
+	p := parser.New(lexer.New(input))
+	p.ParseProgram()
+	return p.UnexpectedEOF()
 }
 
 const MONKEY_FACE = `            __,__
@@ -54,3 +260,8 @@ func printParseErrors(out io.Writer, errors []string) {
 		io.WriteString(out, "\t"+msg+"\n")
 	}
 }
+
+func printRuntimeError(out io.Writer, err *object.Error) {
+	io.WriteString(out, err.Traceback())
+	io.WriteString(out, "\n")
+}
@@ -0,0 +1,318 @@
+package repl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMultiLineInput(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"1 + 2\n",
+			">>3\n>>",
+		},
+		{
+			"let add = fn(x, y) {\n\n  x + y\n}; add(1,\n2)\n",
+			">>........3\n>>",
+		},
+		{
+			"[1,\n 2,\n 3]\n",
+			">>....[1, 2, 3]\n>>",
+		},
+		{
+			"let s = \"{\"; s\n",
+			">>{\n>>",
+		},
+		{
+			"5 +\n5\n",
+			">>..10\n>>",
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+
+		if !strings.HasPrefix(out.String(), tt.expected) {
+			t.Errorf("wrong output for %q.\nwant prefix=%q\ngot=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestIncompleteInputAtEOF(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader("fn(x) {\n  x\n"), &out)
+
+	if !strings.HasPrefix(out.String(), ">>....fn(x) {") {
+		t.Errorf("incomplete input at EOF should still be evaluated. got=%q", out.String())
+	}
+}
+
+func TestBlankLineEndsContinuation(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader("5 +\n\n1\n"), &out)
+
+	if !strings.Contains(out.String(), "parse errors:") {
+		t.Errorf("blank line should end the continuation. got=%q", out.String())
+	}
+	if !strings.HasSuffix(out.String(), "1\n>>") {
+		t.Errorf("repl should keep reading after the parse error. got=%q", out.String())
+	}
+}
+
+func TestSessionKeepsBindings(t *testing.T) {
+	input := `let x = 5;
+let add = fn(a, b) { a + b };
+add(x, 10)
+let y = x + true;
+x
+y
+`
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	lines := strings.Split(out.String(), ">>")
+	expected := []string{
+		"",
+		"",
+		"",
+		"15\n",
+		"TypeError at line 1, column 11: type mismatch: INTEGER + BOOLEAN\n",
+		"5\n",
+	}
+	for i, want := range expected {
+		if lines[i] != want {
+			t.Errorf("output[%d] wrong. want=%q, got=%q", i, want, lines[i])
+		}
+	}
+
+	// エラーになったletは束縛されない
+	if !strings.Contains(lines[len(expected)], "identifier not found: y") {
+		t.Errorf("y should not be bound. got=%q", lines[len(expected)])
+	}
+}
+
+func TestCommands(t *testing.T) {
+	script, err := ioutil.TempFile("", "monkey-load")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(script.Name())
+	script.WriteString("let loaded = 42;\n")
+	script.Close()
+
+	dir, err := ioutil.TempDir("", "monkey-load")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "lib.mk"), []byte("export let x = 7;"), 0666)
+	main := filepath.Join(dir, "main.mk")
+	ioutil.WriteFile(main, []byte(`import "./lib" as lib; let loaded = lib.x;`), 0666)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":tokens let x = 5;", ">>1:1\tLET\t\"let\"\n1:5\tINDENT\t\"x\"\n1:7\t=\t\"=\"\n1:9\tINT\t\"5\"\n1:10\t;\t\";\"\n>>"},
+		{":ast -1 + 2", ">>Program\n  ExpressionStatement\n    InfixExpression +\n      PrefixExpression -\n        IntegerLiteral 1\n      IntegerLiteral 2\n>>"},
+		{":ast fn(x) {\nx\n}", ">>....Program\n  ExpressionStatement\n    FunctionLiteral\n      Identifier x\n      BlockStatement\n        ExpressionStatement\n          Identifier x\n>>"},
+		{":ast --tree -1 + 2", ">>Program\n`-- ExpressionStatement\n    `-- InfixExpression +\n        |-- PrefixExpression -\n        |   `-- IntegerLiteral 1\n        `-- IntegerLiteral 2\n>>"},
+		{":ast --dot x", ">>digraph AST {\n  graph [ordering=out];\n  node [shape=box, fontname=\"monospace\"];\n  n0 [label=\"Program\"];\n  n1 [label=\"ExpressionStatement\"];\n  n2 [label=\"Identifier x\"];\n  n1 -> n2;\n  n0 -> n1;\n}\n>>"},
+		{":ast --tree", ">>usage: :ast [--tree|--dot] <code>\n>>"},
+		{":type \"a\"", ">>STRING\n>>"},
+		{"let a = 1;\n:type a", ">>>>INTEGER\n>>"},
+		{"let b = 2; let a = fn(x) {\nx\n};\n:env", ">>....>>a = fn(x) { x }\nb = 2\n>>"},
+		{"let a = 1;\n:reset\n:env\na", ">>>>>>>>NameError at line 1, column 1: identifier not found: a\n>>"},
+		{":load " + script.Name() + "\nloaded", ">>>>42\n>>"},
+		{":load " + main + "\nloaded", ">>>>7\n>>"},
+		{":load", ">>usage: :load <file>\n>>"},
+		{":nope", ">>unknown command :nope. type :help for a list of commands\n>>"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input+"\n"), &out)
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong output for %q.\nwant=%q\ngot=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestHelpListsAllCommands(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader(":help\n"), &out)
+
+	for _, name := range []string{":help", ":tokens", ":ast", ":type", ":load", ":env", ":reset"} {
+		if !strings.Contains(out.String(), name) {
+			t.Errorf(":help does not mention %s. got=%q", name, out.String())
+		}
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"abc\r", "abc"},
+		{"ac\x1b[Db\r", "abc"},
+		{"bc\x01a\x05d\r", "abcd"},
+		{"abd\x7fc\r", "abc"},
+		{"abXc\x02\x02\x1b[3~\r", "abc"},
+		{"foo bar  \x17\r", "foo "},
+		{"abcdef\x02\x02\x0b\r", "abcd"},
+		{"abcdef\x02\x02\x15\r", "ef"},
+		{"pu\t(1)\r", "push(1)"},
+		{"fi\t\r", "first"},
+		{"le\tt\r", "let"},
+		{"m.log1\t\r", "m.log10"},
+		{"x1\t\r", "x1"},
+		{"1l\t\r", "1l"},
+		{"ab", "ab"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		editor := NewLineEditor(strings.NewReader(tt.input), &out)
+		editor.Complete = func() []string { return []string{"let", "len", "push", "first", "first", "log10", "x12", "x13"} }
+
+		line, err := editor.ReadLine(">>")
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", tt.input, err)
+			continue
+		}
+		if line != tt.expected {
+			t.Errorf("wrong line for %q. want=%q, got=%q", tt.input, tt.expected, line)
+		}
+	}
+}
+
+func TestLineEditorControlKeys(t *testing.T) {
+	var out bytes.Buffer
+
+	editor := NewLineEditor(strings.NewReader("abc\x03"), &out)
+	if _, err := editor.ReadLine(">>"); err != ErrInterrupted {
+		t.Errorf("Ctrl-C should interrupt. got=%v", err)
+	}
+
+	editor = NewLineEditor(strings.NewReader("\x04"), &out)
+	if _, err := editor.ReadLine(">>"); err != io.EOF {
+		t.Errorf("Ctrl-D on an empty line should be EOF. got=%v", err)
+	}
+
+	editor = NewLineEditor(strings.NewReader("ab\x02\x04\r"), &out)
+	if line, _ := editor.ReadLine(">>"); line != "a" {
+		t.Errorf("Ctrl-D should delete under the cursor. got=%q", line)
+	}
+}
+
+func TestLineEditorHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history")
+
+	input := "let x = 1;\rprint(x)\r\x1b[A\x1b[A\r\x1b[A\x1b[B\r\x12let\r\x12x\x12\x07\r"
+	var out bytes.Buffer
+	editor := NewLineEditor(strings.NewReader(input), &out)
+	if err := editor.LoadHistory(path); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"let x = 1;",
+		"print(x)",
+		"let x = 1;", // 上矢印2回
+		"",           // 上矢印のあと下矢印で編集中の行に戻る
+		"let x = 1;", // Ctrl-Rで検索してEnter
+		"",           // Ctrl-Gで検索をやめる
+	}
+	for i, want := range expected {
+		line, err := editor.ReadLine(">>")
+		if err != nil {
+			t.Fatalf("line %d: unexpected error: %s", i, err)
+		}
+		if line != want {
+			t.Errorf("line %d wrong. want=%q, got=%q", i, want, line)
+		}
+	}
+
+	// 連続した重複は履歴に入れない
+	saved, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != "let x = 1;\nprint(x)\nlet x = 1;\n" {
+		t.Errorf("wrong history file. got=%q", saved)
+	}
+
+	editor = NewLineEditor(strings.NewReader("\x1b[A\r"), &out)
+	editor.LoadHistory(path)
+	if line, _ := editor.ReadLine(">>"); line != "let x = 1;" {
+		t.Errorf("history was not loaded from the file. got=%q", line)
+	}
+}
+
+func TestLineEditorHistoryLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history")
+
+	editor := NewLineEditor(strings.NewReader(""), ioutil.Discard)
+	editor.LoadHistory(path)
+	for i := 0; i < 2*maxHistory+1; i++ {
+		editor.addHistory(fmt.Sprintf("line %d", i))
+	}
+
+	if len(editor.history) != maxHistory {
+		t.Errorf("history should be trimmed to %d lines. got=%d", maxHistory, len(editor.history))
+	}
+	if last := editor.history[len(editor.history)-1]; last != fmt.Sprintf("line %d", 2*maxHistory) {
+		t.Errorf("wrong last line. got=%q", last)
+	}
+
+	// 2倍を超えたところで書き直す
+	saved, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(saved), "\n"), "\n")
+	if len(lines) != maxHistory || lines[0] != fmt.Sprintf("line %d", maxHistory+1) {
+		t.Errorf("history file should be rewritten with the last %d lines. got %d lines from %q", maxHistory, len(lines), lines[0])
+	}
+}
+
+func TestCompletions(t *testing.T) {
+	session := NewSession()
+	session.evalAndPrint("let myValue = 1;", ioutil.Discard)
+
+	names := session.completions()
+	for _, want := range []string{"let", "finally", "len", "push", "myValue"} {
+		found := false
+		for _, name := range names {
+			if name == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("completions do not include %q. got=%v", want, names)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package repl
+
+import "errors"
+
+// 端末の制御に対応していない環境では、常にbufio.Scannerで1行ずつ読む
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw mode is not supported on this platform")
+}
@@ -1,20 +1,27 @@
 package token
 
+import "sort"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int // トークンの先頭がある行(1始まり)
+	Column  int // トークンの先頭がある列(1始まり)
 }
 
 // Type = IDENT Literal = "myVar" みたいな感じ
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT" // 行末までの//コメント
 
 	// 識別子+リテラル
-	IDENT = "INDENT" // add, foobr, x, y
-	INT   = "INT"    // 123456
+	IDENT  = "INDENT" // add, foobr, x, y
+	INT    = "INT"    // 123456
+	FLOAT  = "FLOAT"  // 1.5
+	STRING = "STRING" // "foobar"
 
 	// 演算子
 	ASSIGN   = "="
@@ -33,11 +40,15 @@ const (
 	// デリミタ
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
 
-	LPAREN = "("
-	RPAREN = ")"
-	LBRACE = "{"
-	RBRACE = "}"
+	LPAREN   = "("
+	RPAREN   = ")"
+	LBRACE   = "{"
+	RBRACE   = "}"
+	LBRACKET = "["
+	RBRACKET = "]"
+	DOT      = "."
 
 	//キーワード
 	FUNCTION = "FUNCTION"
@@ -47,16 +58,38 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
+	AS       = "AS"
+	SPAWN    = "SPAWN"
+	SELECT   = "SELECT"
+	CASE     = "CASE"
+	DEFAULT  = "DEFAULT"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":      FUNCTION,
+	"let":     LET,
+	"true":    TRUE,
+	"false":   FALSE,
+	"if":      IF,
+	"else":    ELSE,
+	"return":  RETURN,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"throw":   THROW,
+	"import":  IMPORT,
+	"export":  EXPORT,
+	"as":      AS,
+	"spawn":   SPAWN,
+	"select":  SELECT,
+	"case":    CASE,
+	"default": DEFAULT,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -65,3 +98,13 @@ func LookupIdent(ident string) TokenType {
 	}
 	return IDENT
 }
+
+// キーワードの一覧を辞書順で返す(REPLの補完用)
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}